@@ -1,42 +1,202 @@
 package main
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"flag"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"net/url"
 	"io/ioutil"
 	"aidalinfo/ansible-lite/internal/config"
+	"aidalinfo/ansible-lite/internal/facts"
+	"aidalinfo/ansible-lite/internal/repos"
 	"encoding/json"
 	"github.com/olekukonko/tablewriter"
 	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // Structure pour stocker les détails des exécutions récupérées depuis l'API
 type ExecutionDetail struct {
+	ID         int64  `json:"ID"`
+	JobKind    string `json:"JobKind"`
 	RepoName   string `json:"RepoName"`
 	RepoURL    string `json:"RepoURL"`
+	Trigger    string `json:"Trigger"`
 	CommitID   string `json:"CommitID"`
 	ExecutedAt string `json:"ExecutedAt"`
+	DurationMs int64  `json:"DurationMs"`
+	ExitCode   *int           `json:"ExitCode"`
+	Status     string         `json:"Status"`
+	Recap      *PlaybookRecap `json:"Recap"`
+	Agent      string         `json:"Agent"`
 }
 
-// Fonction pour exécuter la commande "repos list"
-func reposListCommand(cfg *config.GlobalConfig) {
-	// Construire l'URL avec le port provenant de la configuration
-	apiURL := fmt.Sprintf("http://localhost:%d/executions", cfg.Global.Port)
+// Récapitulatif d'une exécution de playbook
+type PlaybookRecap struct {
+	Hosts []struct {
+		Host        string `json:"Host"`
+		Ok          int    `json:"Ok"`
+		Changed     int    `json:"Changed"`
+		Failed      int    `json:"Failed"`
+		Unreachable int    `json:"Unreachable"`
+		Skipped     int    `json:"Skipped"`
+		Rescued     int    `json:"Rescued"`
+		Ignored     int    `json:"Ignored"`
+	} `json:"Hosts"`
+	Tasks []struct {
+		Play    string `json:"Play"`
+		Task    string `json:"Task"`
+		Host    string `json:"Host"`
+		Status  string `json:"Status"`
+		Message string `json:"Message"`
+	} `json:"Tasks"`
+}
+
+// Totaux de tous les hôtes d'un playbook (vide pour un script)
+func formatRecap(recap *PlaybookRecap) string {
+	if recap == nil {
+		return ""
+	}
+	var ok, changed, failed, unreachable int
+	for _, host := range recap.Hosts {
+		ok += host.Ok
+		changed += host.Changed
+		failed += host.Failed
+		unreachable += host.Unreachable
+	}
+	return fmt.Sprintf("ok=%d changed=%d failed=%d unreachable=%d", ok, changed, failed, unreachable)
+}
+
+// Structure pour le détail complet d'une exécution (avec la sortie du script)
+type Execution struct {
+	ID         int64  `json:"ID"`
+	JobKind    string `json:"JobKind"`
+	JobName    string `json:"JobName"`
+	Source     string `json:"Source"`
+	Trigger    string `json:"Trigger"`
+	Commit     string `json:"Commit"`
+	StartedAt  string `json:"StartedAt"`
+	FinishedAt string `json:"FinishedAt"`
+	DurationMs int64  `json:"DurationMs"`
+	ExitCode   *int   `json:"ExitCode"`
+	Status     string         `json:"Status"`
+	Output     string         `json:"Output"`
+	Recap      *PlaybookRecap `json:"Recap"`
+	Agent      string         `json:"Agent"`
+}
+
+// Structure pour un agent inscrit auprès du serveur
+type AgentStatus struct {
+	Name          string            `json:"Name"`
+	Labels        map[string]string `json:"Labels"`
+	LastSeen      string            `json:"LastSeen"`
+	ConfigVersion string            `json:"ConfigVersion"`
+	ConfigError   string            `json:"ConfigError"`
+	Jobs          []string          `json:"Jobs"`
+	Online        bool              `json:"Online"`
+	InSync        bool              `json:"InSync"`
+}
+
+// Structure pour l'état d'une tâche planifiée
+type JobStatus struct {
+	Kind                string `json:"Kind"`
+	Name                string `json:"Name"`
+	Running             bool   `json:"Running"`
+	Disabled            bool   `json:"Disabled"`
+	Paused              bool   `json:"Paused"`
+	ConsecutiveFailures int    `json:"ConsecutiveFailures"`
+	LastError           string `json:"LastError"`
+}
+
+// Token nommé passé par --token ou ALCLI_TOKEN, à la place de credentials
+var tokenFlag string
+
+func apiToken(cfg *config.GlobalConfig) string {
+	if tokenFlag != "" {
+		return tokenFlag
+	}
+	if value := os.Getenv("ALCLI_TOKEN"); value != "" {
+		return value
+	}
+	return cfg.Global.Credentials
+}
+
+// Client HTTP de l'API, configuré par --ca, --cert, --key et --server-name lorsque l'API est servie en HTTPS
+var apiClient = &http.Client{}
+
+// URL de l'API donnée par --url ou ALCLI_URL, à la place de celle déduite de la configuration
+var urlFlag string
+
+// Construire le client HTTPS : CA du certificat du serveur (autorités du système par défaut),
+// certificat client pour l'authentification mTLS (client_ca) et nom attendu dans le certificat
+// du serveur s'il diffère de l'hôte contacté
+func newAPIClient(caPath, certPath, keyPath, serverName string) (*http.Client, error) {
+	tlsCfg := &tls.Config{MinVersion: tls.VersionTLS12, ServerName: serverName}
+	if caPath != "" {
+		data, err := ioutil.ReadFile(caPath)
+		if err != nil {
+			return nil, err
+		}
+		tlsCfg.RootCAs = x509.NewCertPool()
+		if !tlsCfg.RootCAs.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("aucun certificat PEM trouvé dans %s", caPath)
+		}
+	}
+	if certPath != "" || keyPath != "" {
+		if certPath == "" || keyPath == "" {
+			return nil, fmt.Errorf("--cert et --key doivent être utilisés ensemble")
+		}
+		cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+		if err != nil {
+			return nil, err
+		}
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsCfg
+	return &http.Client{Transport: transport}, nil
+}
+
+// URL de l'API : --url ou ALCLI_URL, sinon HTTPS si ssl est activé, sur bind_address si l'API
+// n'écoute pas sur toutes les interfaces
+func apiBaseURL(cfg *config.GlobalConfig) string {
+	if urlFlag != "" {
+		return strings.TrimSuffix(urlFlag, "/")
+	}
+	scheme := "http"
+	if cfg.Global.SSL {
+		scheme = "https"
+	}
+	host := cfg.Global.BindAddress
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "localhost"
+	}
+	return fmt.Sprintf("%s://%s", scheme, net.JoinHostPort(host, strconv.Itoa(cfg.Global.Port)))
+}
+
+// Envoyer une requête authentifiée à l'API et renvoyer le corps de la réponse
+func apiRequest(cfg *config.GlobalConfig, method, path string) []byte {
+	// Construire l'URL avec l'adresse et le port provenant de la configuration
+	apiURL := apiBaseURL(cfg) + path
 
 	// Préparer la requête avec le token depuis la configuration
-	req, err := http.NewRequest("GET", apiURL, nil)
+	req, err := http.NewRequest(method, apiURL, nil)
 	if err != nil {
 		log.Fatalf("Erreur lors de la création de la requête : %v", err)
 	}
 
-	// Ajouter l'en-tête Authorization avec le token d'API
-	req.Header.Add("Authorization", cfg.Global.Credentials)
+	// Ajouter l'en-tête Authorization avec le token d'API (--token, credentials par défaut)
+	req.Header.Add("Authorization", "Bearer "+apiToken(cfg))
 
 	// Envoyer la requête
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := apiClient.Do(req)
 	if err != nil {
 		log.Fatalf("Erreur lors de l'envoi de la requête : %v", err)
 	}
@@ -52,6 +212,28 @@ func reposListCommand(cfg *config.GlobalConfig) {
 	if resp.StatusCode != http.StatusOK {
 		log.Fatalf("Erreur de l'API : %s", string(body))
 	}
+	return body
+}
+
+// Formater le code de sortie (vide si l'exécution est en cours)
+func formatExitCode(code *int) string {
+	if code == nil {
+		return ""
+	}
+	return strconv.Itoa(*code)
+}
+
+// Raccourcir un SHA de commit pour l'affichage en tableau
+func shortSHA(sha string) string {
+	if len(sha) > 12 {
+		return sha[:12]
+	}
+	return sha
+}
+
+// Fonction pour exécuter la commande "executions list"
+func reposListCommand(cfg *config.GlobalConfig) {
+	body := apiRequest(cfg, "GET", "/executions")
 
 	// Parser le JSON de la réponse en une slice de ExecutionDetail
 	var executionDetails []ExecutionDetail
@@ -61,42 +243,320 @@ func reposListCommand(cfg *config.GlobalConfig) {
 
 	// Afficher les données dans un tableau formaté
 	table := tablewriter.NewWriter(os.Stdout)
-	table.SetHeader([]string{"Repo Name", "Repo URL", "Commit ID", "Executed At"})
+	table.SetHeader([]string{"ID", "Agent", "Kind", "Name", "Source", "Trigger", "Commit", "Executed At", "Duration", "Exit", "Status", "Recap"})
 
 	for _, exec := range executionDetails {
-		table.Append([]string{exec.RepoName, exec.RepoURL, exec.CommitID, exec.ExecutedAt})
+		duration := (time.Duration(exec.DurationMs) * time.Millisecond).String()
+		table.Append([]string{strconv.FormatInt(exec.ID, 10), exec.Agent, exec.JobKind, exec.RepoName, exec.RepoURL, exec.Trigger, shortSHA(exec.CommitID), exec.ExecutedAt, duration, formatExitCode(exec.ExitCode), exec.Status, formatRecap(exec.Recap)})
 	}
 
 	table.Render() // Afficher le tableau dans le terminal
 }
 
-// Fonction pour exécuter la commande "status"
-func statusCommand(cfg *config.GlobalConfig) {
-	// Construire l'URL avec le port provenant de la configuration
-	apiURL := fmt.Sprintf("http://localhost:%d/status", cfg.Global.Port)
+// Fonction pour exécuter la commande "executions show <id>"
+func executionShowCommand(cfg *config.GlobalConfig, id string) {
+	body := apiRequest(cfg, "GET", "/executions/"+id)
 
-	// Préparer la requête avec le token depuis la configuration
-	req, err := http.NewRequest("GET", apiURL, nil)
-	if err != nil {
-		log.Fatalf("Erreur lors de la création de la requête : %v", err)
+	var execution Execution
+	if err := json.Unmarshal(body, &execution); err != nil {
+		log.Fatalf("Erreur lors du parsing du JSON : %v", err)
 	}
 
-	// Ajouter l'en-tête Authorization avec le token d'API
-	req.Header.Add("Authorization", cfg.Global.Credentials)
+	fmt.Printf("ID:          %d\n", execution.ID)
+	fmt.Printf("Job:         %s %s\n", execution.JobKind, execution.JobName)
+	if execution.Agent != "" {
+		fmt.Printf("Agent:       %s\n", execution.Agent)
+	}
+	fmt.Printf("Source:      %s\n", execution.Source)
+	fmt.Printf("Trigger:     %s\n", execution.Trigger)
+	fmt.Printf("Commit:      %s\n", execution.Commit)
+	fmt.Printf("Started at:  %s\n", execution.StartedAt)
+	fmt.Printf("Finished at: %s\n", execution.FinishedAt)
+	fmt.Printf("Duration:    %s\n", time.Duration(execution.DurationMs)*time.Millisecond)
+	fmt.Printf("Exit code:   %s\n", formatExitCode(execution.ExitCode))
+	fmt.Printf("Status:      %s\n", execution.Status)
+	if execution.Recap != nil {
+		fmt.Println("Recap:")
+		table := tablewriter.NewWriter(os.Stdout)
+		table.SetHeader([]string{"Host", "Ok", "Changed", "Failed", "Unreachable", "Skipped", "Rescued", "Ignored"})
+		for _, h := range execution.Recap.Hosts {
+			table.Append([]string{h.Host, strconv.Itoa(h.Ok), strconv.Itoa(h.Changed), strconv.Itoa(h.Failed), strconv.Itoa(h.Unreachable), strconv.Itoa(h.Skipped), strconv.Itoa(h.Rescued), strconv.Itoa(h.Ignored)})
+		}
+		table.Render()
 
-	// Envoyer la requête
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		log.Fatalf("Erreur lors de l'envoi de la requête : %v", err)
+		fmt.Println("Tasks:")
+		table = tablewriter.NewWriter(os.Stdout)
+		table.SetHeader([]string{"Play", "Task", "Host", "Status", "Message"})
+		for _, t := range execution.Recap.Tasks {
+			table.Append([]string{t.Play, t.Task, t.Host, t.Status, t.Message})
+		}
+		table.Render()
 	}
-	defer resp.Body.Close()
+	fmt.Println("Output:")
+	fmt.Println(execution.Output)
+}
 
-	// Lire la réponse
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		log.Fatalf("Erreur lors de la lecture de la réponse : %v", err)
+// Fonction pour exécuter la commande "jobs list"
+func jobsListCommand(cfg *config.GlobalConfig) {
+	body := apiRequest(cfg, "GET", "/jobs")
+
+	var jobs []JobStatus
+	if err := json.Unmarshal(body, &jobs); err != nil {
+		log.Fatalf("Erreur lors du parsing du JSON : %v", err)
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Kind", "Name", "Running", "Disabled", "Paused", "Failures", "Last Error"})
+
+	for _, job := range jobs {
+		table.Append([]string{job.Kind, job.Name, strconv.FormatBool(job.Running), strconv.FormatBool(job.Disabled), strconv.FormatBool(job.Paused), strconv.Itoa(job.ConsecutiveFailures), job.LastError})
+	}
+
+	table.Render()
+}
+
+// Fonction pour exécuter la commande "jobs run <nom> [--force]"
+func jobsRunCommand(cfg *config.GlobalConfig, args []string) {
+	runFlags := flag.NewFlagSet("jobs run", flag.ExitOnError)
+	force := runFlags.Bool("force", false, "Exécuter le script même si rien n'a changé")
+	// Le nom de la tâche peut précéder ou suivre --force
+	name := args[0]
+	if strings.HasPrefix(name, "-") {
+		runFlags.Parse(args)
+		name = runFlags.Arg(0)
+	} else {
+		runFlags.Parse(args[1:])
+	}
+	if name == "" {
+		log.Fatal("Nom de tâche manquant. Exemple : alcli jobs run <nom> --force")
+	}
+
+	path := "/jobs/" + name + "/run"
+	if *force {
+		path += "?force=true"
+	}
+	fmt.Println(string(apiRequest(cfg, "POST", path)))
+}
+
+// Fonction pour exécuter la commande "reload"
+func reloadCommand(cfg *config.GlobalConfig) {
+	body := apiRequest(cfg, "POST", "/reload")
+
+	var result struct {
+		Added   []string `json:"Added"`
+		Updated []string `json:"Updated"`
+		Removed []string `json:"Removed"`
+		Failed  []string `json:"Failed"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		log.Fatalf("Erreur lors du parsing du JSON : %v", err)
+	}
+
+	fmt.Println("Configuration des dépôts rechargée")
+	fmt.Printf("Ajoutées:   %s\n", strings.Join(result.Added, ", "))
+	fmt.Printf("Modifiées:  %s\n", strings.Join(result.Updated, ", "))
+	fmt.Printf("Supprimées: %s\n", strings.Join(result.Removed, ", "))
+	for _, failed := range result.Failed {
+		fmt.Printf("Non planifiée : %s\n", failed)
+	}
+}
+
+// Fonction pour exécuter la commande "facts" (--json pour le document complet, --refresh pour une nouvelle collecte)
+func factsCommand(cfg *config.GlobalConfig, args []string) {
+	flags := flag.NewFlagSet("facts", flag.ExitOnError)
+	asJSON := flags.Bool("json", false, "Afficher le document JSON complet")
+	refresh := flags.Bool("refresh", false, "Collecter à nouveau les faits avant de les afficher")
+	flags.Parse(args)
+
+	path := "/facts"
+	if *refresh {
+		path += "?refresh=true"
+	}
+	body := apiRequest(cfg, "GET", path)
+	if *asJSON {
+		fmt.Println(string(body))
+		return
+	}
+
+	var f facts.Facts
+	if err := json.Unmarshal(body, &f); err != nil {
+		log.Fatalf("Erreur lors du parsing du JSON : %v", err)
+	}
+	values := f.Flatten()
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Fact", "Value"})
+	for _, key := range keys {
+		table.Append([]string{key, values[key]})
+	}
+	table.Render()
+}
+
+// Fonction pour exécuter la commande "agents list" (mode serveur)
+func agentsListCommand(cfg *config.GlobalConfig) {
+	body := apiRequest(cfg, "GET", "/agents")
+
+	var agents []AgentStatus
+	if err := json.Unmarshal(body, &agents); err != nil {
+		log.Fatalf("Erreur lors du parsing du JSON : %v", err)
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Name", "Labels", "Last Seen", "Online", "In Sync", "Jobs", "Error"})
+	for _, agent := range agents {
+		labels := make([]string, 0, len(agent.Labels))
+		for key, value := range agent.Labels {
+			labels = append(labels, key+"="+value)
+		}
+		sort.Strings(labels)
+		table.Append([]string{agent.Name, strings.Join(labels, ","), agent.LastSeen, strconv.FormatBool(agent.Online), strconv.FormatBool(agent.InSync), strings.Join(agent.Jobs, ", "), agent.ConfigError})
+	}
+	table.Render()
+}
+
+// Fonction pour exécuter la commande "log-level" : afficher le niveau de log ou le changer,
+// temporairement avec --for
+func logLevelCommand(cfg *config.GlobalConfig, args []string) {
+	flags := flag.NewFlagSet("log-level", flag.ExitOnError)
+	duration := flags.String("for", "", "Rétablir le niveau de config.yaml après ce délai (ex. 15m)")
+	// Le niveau peut précéder ou suivre --for
+	level := ""
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		level = args[0]
+		flags.Parse(args[1:])
+	} else {
+		flags.Parse(args)
+		level = flags.Arg(0)
+	}
+
+	method, path := "GET", "/log-level"
+	if level != "" {
+		method = "POST"
+		query := url.Values{"level": {level}}
+		if *duration != "" {
+			query.Set("duration", *duration)
+		}
+		path += "?" + query.Encode()
+	} else if *duration != "" {
+		log.Fatal("Niveau manquant. Exemple : alcli log-level debug --for 15m")
+	}
+
+	var state struct {
+		Level      string `json:"level"`
+		Configured string `json:"configured"`
+		ExpiresAt  string `json:"expires_at"`
+	}
+	if err := json.Unmarshal(apiRequest(cfg, method, path), &state); err != nil {
+		log.Fatalf("Erreur lors du parsing du JSON : %v", err)
+	}
+	fmt.Printf("Niveau de log : %s\n", state.Level)
+	if state.ExpiresAt != "" {
+		fmt.Printf("Retour à %s le %s\n", state.Configured, state.ExpiresAt)
+	}
+}
+
+// Token de l'API tel que renvoyé par GET /tokens
+type APIToken struct {
+	Name       string   `json:"Name"`
+	Scopes     []string `json:"Scopes"`
+	CreatedAt  string   `json:"CreatedAt"`
+	ExpiresAt  string   `json:"ExpiresAt"`
+	LastUsedAt string   `json:"LastUsedAt"`
+	Token      string   `json:"Token"` // À la création et à la rotation uniquement
+}
+
+// Afficher un token créé ou renouvelé : le token en clair n'est plus consultable ensuite
+func printNewToken(body []byte) {
+	var t APIToken
+	if err := json.Unmarshal(body, &t); err != nil {
+		log.Fatalf("Erreur lors du parsing du JSON : %v", err)
+	}
+	fmt.Printf("Token %s (%s)", t.Name, strings.Join(t.Scopes, ","))
+	if t.ExpiresAt != "" {
+		fmt.Printf(", expire le %s", t.ExpiresAt)
+	}
+	fmt.Println(" :")
+	fmt.Println(t.Token)
+	fmt.Fprintln(os.Stderr, "Conservez-le maintenant, il ne pourra plus être affiché.")
+}
+
+// Fonction pour exécuter la commande "tokens" : create <nom> --scopes read,trigger [--expires 90d],
+// list, revoke <nom> et rotate <nom> [--expires 90d]
+func tokensCommand(cfg *config.GlobalConfig, args []string) {
+	if len(args) == 0 {
+		fmt.Println("Sous-commande manquante pour 'tokens'. Utilisez 'list', 'create <nom> --scopes read,trigger [--expires 90d]', 'revoke <nom>' ou 'rotate <nom> [--expires 90d]'.")
+		return
+	}
+	flags := flag.NewFlagSet("tokens "+args[0], flag.ExitOnError)
+	scopes := flags.String("scopes", "read", "Droits du token : read, trigger, admin (séparés par des virgules)")
+	expires := flags.String("expires", "", "Durée de validité (ex. 90d, 720h), sans expiration par défaut")
+	// Le nom du token peut précéder ou suivre les options
+	name := ""
+	if len(args) > 1 && !strings.HasPrefix(args[1], "-") {
+		name = args[1]
+		flags.Parse(args[2:])
+	} else {
+		flags.Parse(args[1:])
+		name = flags.Arg(0)
+	}
+
+	switch args[0] {
+	case "list":
+		var tokens []APIToken
+		if err := json.Unmarshal(apiRequest(cfg, "GET", "/tokens"), &tokens); err != nil {
+			log.Fatalf("Erreur lors du parsing du JSON : %v", err)
+		}
+		table := tablewriter.NewWriter(os.Stdout)
+		table.SetHeader([]string{"Name", "Scopes", "Created At", "Expires At", "Last Used At"})
+		for _, t := range tokens {
+			table.Append([]string{t.Name, strings.Join(t.Scopes, ","), t.CreatedAt, t.ExpiresAt, t.LastUsedAt})
+		}
+		table.Render()
+		return
+	case "create", "revoke", "rotate":
+	default:
+		fmt.Println("Sous-commande inconnue pour 'tokens'. Utilisez 'list', 'create <nom>', 'revoke <nom>' ou 'rotate <nom>'.")
+		return
+	}
+	if name == "" {
+		log.Fatalf("Nom de token manquant. Exemple : alcli tokens %s <nom>", args[0])
+	}
+
+	switch args[0] {
+	case "create":
+		query := url.Values{"name": {name}, "scopes": {*scopes}, "expires": {*expires}}
+		printNewToken(apiRequest(cfg, "POST", "/tokens?"+query.Encode()))
+	case "rotate":
+		path := "/tokens/" + url.PathEscape(name) + "/rotate"
+		if *expires != "" {
+			path += "?" + url.Values{"expires": {*expires}}.Encode()
+		}
+		printNewToken(apiRequest(cfg, "POST", path))
+	case "revoke":
+		fmt.Println(string(apiRequest(cfg, "POST", "/tokens/"+url.PathEscape(name)+"/revoke")))
 	}
+}
+
+// Fonction pour exécuter la commande "config validate"
+func configValidateCommand(configPath string) {
+	issues := repos.CheckConfig(configPath)
+	for _, issue := range issues {
+		fmt.Fprintln(os.Stderr, issue)
+	}
+	if len(issues) > 0 {
+		os.Exit(1)
+	}
+	fmt.Println("Configuration valide")
+}
+
+// Fonction pour exécuter la commande "status"
+func statusCommand(cfg *config.GlobalConfig) {
+	body := apiRequest(cfg, "GET", "/status")
 
 	// Afficher la réponse
 	fmt.Println(string(body))
@@ -105,14 +565,37 @@ func statusCommand(cfg *config.GlobalConfig) {
 func main() {
 	// Définir l'argument --config pour spécifier le chemin du fichier de configuration
 	configPath := flag.String("config", "config.yaml", "Chemin vers le fichier de configuration")
+	caPath := flag.String("ca", "", "CA du certificat de l'API (HTTPS)")
+	certPath := flag.String("cert", "", "Certificat client présenté à l'API (mTLS)")
+	keyPath := flag.String("key", "", "Clé du certificat client")
+	serverName := flag.String("server-name", "", "Nom attendu dans le certificat de l'API, s'il diffère de l'hôte contacté")
+	flag.StringVar(&urlFlag, "url", os.Getenv("ALCLI_URL"), "URL de l'API, ex. https://ansible-lite.example.com:8443 (ALCLI_URL, déduite de la configuration par défaut)")
+	flag.StringVar(&tokenFlag, "token", "", "Token de l'API (ALCLI_TOKEN, credentials de la configuration par défaut)")
 	flag.Parse() // Analyser les flags avant de récupérer les arguments
 
+	// La validation ne nécessite ni configuration valide ni service démarré
+	if args := flag.Args(); len(args) > 1 && args[0] == "config" && args[1] == "validate" {
+		configValidateCommand(*configPath)
+		return
+	}
+
 	// Charger la configuration depuis le fichier spécifié
 	cfg, err := config.LoadConfig(*configPath)
 	if err != nil {
 		log.Fatalf("Erreur lors du chargement de la configuration : %v", err)
 	}
 
+	if urlFlag != "" {
+		if u, err := url.Parse(urlFlag); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			log.Fatalf("URL de l'API invalide %q (exemple : https://ansible-lite.example.com:8443)", urlFlag)
+		}
+	}
+	if *caPath != "" || *certPath != "" || *keyPath != "" || *serverName != "" {
+		if apiClient, err = newAPIClient(*caPath, *certPath, *keyPath, *serverName); err != nil {
+			log.Fatalf("Erreur dans les options TLS : %v", err)
+		}
+	}
+
 	// Récupérer la sous-commande (par exemple "repos list")
 	args := flag.Args()
 	if len(args) < 1 {
@@ -123,13 +606,43 @@ func main() {
 	switch args[0] {
 	case "status":
 		statusCommand(cfg)
+	case "reload":
+		reloadCommand(cfg)
+	case "facts":
+		factsCommand(cfg, args[1:])
+	case "log-level":
+		logLevelCommand(cfg, args[1:])
+	case "tokens":
+		tokensCommand(cfg, args[1:])
+	case "agents":
+		if len(args) > 1 && args[1] == "list" {
+			agentsListCommand(cfg)
+		} else if len(args) > 2 && args[1] == "remove" {
+			fmt.Println(string(apiRequest(cfg, "POST", "/agents/"+url.PathEscape(args[2])+"/remove")))
+		} else {
+			fmt.Println("Sous-commande inconnue pour 'agents'. Utilisez 'list' ou 'remove <nom>' après 'agents'.")
+		}
 	case "version":
 		fmt.Println("Bêta version : 0.0.4")
 	case "executions":
 		if len(args) > 1 && args[1] == "list" {
 			reposListCommand(cfg)
+		} else if len(args) > 2 && args[1] == "show" {
+			executionShowCommand(cfg, args[2])
+		} else if len(args) > 2 && args[1] == "cancel" {
+			fmt.Println(string(apiRequest(cfg, "POST", "/executions/"+args[2]+"/cancel")))
+		} else {
+			fmt.Println("Sous-commande inconnue pour 'executions'. Utilisez 'list', 'show <id>' ou 'cancel <id>' après 'executions'.")
+		}
+	case "jobs":
+		if len(args) > 1 && args[1] == "list" {
+			jobsListCommand(cfg)
+		} else if len(args) > 2 && (args[1] == "enable" || args[1] == "pause" || args[1] == "resume") {
+			fmt.Println(string(apiRequest(cfg, "POST", "/jobs/"+args[2]+"/"+args[1])))
+		} else if len(args) > 2 && args[1] == "run" {
+			jobsRunCommand(cfg, args[2:])
 		} else {
-			fmt.Println("Sous-commande inconnue pour 'repos'. Utilisez 'list' après 'repos'.")
+			fmt.Println("Sous-commande inconnue pour 'jobs'. Utilisez 'list', 'run <nom> [--force]', 'pause <nom>', 'resume <nom>' ou 'enable <nom>' après 'jobs'.")
 		}
 	default:
 		fmt.Println("Commande inconnue. Utilisez 'status' ou 'repos list'.")
@@ -2,16 +2,38 @@ package main
 
 import (
     "flag"
+    "fmt"
+    "os"
+    "os/signal"
+    "syscall"
+    "aidalinfo/ansible-lite/internal/config"
+    "aidalinfo/ansible-lite/internal/facts"
+    "aidalinfo/ansible-lite/internal/fleet"
     "aidalinfo/ansible-lite/internal/initapp"
     "aidalinfo/ansible-lite/internal/repos"
     "aidalinfo/ansible-lite/internal/logger"
+    "aidalinfo/ansible-lite/internal/notify"
 )
 
 func main() {
     // Définir l'argument --config pour spécifier le chemin du fichier de configuration
     configPath := flag.String("config", "config.yaml", "Chemin vers le fichier de configuration")
+    check := flag.Bool("check", false, "Valider config.yaml et repos.yaml puis quitter")
     flag.Parse()
 
+    // Mode validation : afficher les erreurs et quitter avec un code non nul (utilisable en CI)
+    if *check {
+        issues := repos.CheckConfig(*configPath)
+        for _, issue := range issues {
+            fmt.Fprintln(os.Stderr, issue)
+        }
+        if len(issues) > 0 {
+            os.Exit(1)
+        }
+        fmt.Println("Configuration valide")
+        return
+    }
+
     // Initialiser l'application avec le fichier de configuration spécifié
     cfg, err := initapp.InitApp(*configPath)
     if err != nil {
@@ -19,16 +41,62 @@ func main() {
         return
     }
 
-    // Charger la configuration des dépôts (repos.yaml)
-    reposConfig, err := repos.LoadReposConfig(cfg.Global.ReposConfig, cfg.Global.DBPath, cfg.Global.GithubToken)
-    if err != nil {
-        logger.Log("ERROR", "Erreur lors du chargement des dépôts : %v", err)
+    // Appliquer les réglages globaux des tâches (timeouts...)
+    if err := repos.Configure(cfg); err != nil {
+        logger.Log("ERROR", "Erreur dans la configuration : %v", err)
+        return
+    }
+
+    // Collecter les faits de la machine et les rafraîchir périodiquement
+    if err := facts.Configure(cfg); err != nil {
+        logger.Log("ERROR", "Erreur dans la configuration : %v", err)
         return
     }
+    go facts.Watch()
 
-    // Démarrer la surveillance des dépôts (scheduling) avec le chemin de la base de données
-    repos.ScheduleRepos(reposConfig, cfg.Global.DBPath, cfg.Global.GithubToken)
+    // Notifications envoyées à la fin des exécutions, sans bloquer les tâches
+    notify.Start(cfg)
 
-    // Garder l'application active
-    select {}
+    // Mode serveur : le catalogue de tâches est distribué aux agents au lieu d'être planifié localement
+    reload := repos.ReloadReposConfig
+    if cfg.Global.Type == config.TypeServer {
+        if err := fleet.LoadCatalogue(cfg); err != nil {
+            logger.Log("ERROR", "Erreur lors du chargement du catalogue : %v", err)
+            return
+        }
+        reload = fleet.ReloadCatalogue
+    } else {
+        // Agent : repos.yaml est remplacé par la configuration reçue du serveur
+        if cfg.Global.ServerURL != "" {
+            if err := fleet.PrepareAgent(cfg); err != nil {
+                logger.Log("ERROR", "Impossible de créer %s : %v", cfg.Global.ReposConfig, err)
+                return
+            }
+        }
+
+        // Charger la configuration des dépôts (repos.yaml)
+        reposConfig, err := repos.LoadReposConfig(cfg.Global.ReposConfig, cfg.Global.DBPath, cfg.Global.GithubToken)
+        if err != nil {
+            logger.Log("ERROR", "Erreur lors du chargement des dépôts : %v", err)
+            return
+        }
+
+        // Démarrer la surveillance des dépôts (scheduling) avec le chemin de la base de données
+        repos.ScheduleRepos(reposConfig, cfg.Global.DBPath, cfg.Global.GithubToken)
+
+        if cfg.Global.ServerURL != "" {
+            go fleet.RunAgent(cfg)
+        }
+    }
+
+    // Recharger repos.yaml sur SIGHUP et, si demandé, à chaque modification du fichier
+    if cfg.Global.WatchReposConfig {
+        go repos.WatchReposConfig(cfg, reload)
+    }
+    hup := make(chan os.Signal, 1)
+    signal.Notify(hup, syscall.SIGHUP)
+    for range hup {
+        logger.Log("INFO", "SIGHUP reçu, rechargement de %s", cfg.Global.ReposConfig)
+        reload(cfg)
+    }
 }
@@ -3,10 +3,12 @@ module aidalinfo/ansible-lite
 go 1.19
 
 require (
-	github.com/mattn/go-runewidth v0.0.9 // indirect
-	github.com/mattn/go-sqlite3 v1.14.24 // indirect
-	github.com/natefinch/lumberjack v2.0.0+incompatible // indirect
-	github.com/olekukonko/tablewriter v0.0.5 // indirect
-	github.com/robfig/cron/v3 v3.0.1 // indirect
-	gopkg.in/yaml.v2 v2.4.0 // indirect
+	github.com/mattn/go-sqlite3 v1.14.24
+	github.com/natefinch/lumberjack v2.0.0+incompatible
+	github.com/olekukonko/tablewriter v0.0.5
+	github.com/robfig/cron/v3 v3.0.1
+	gopkg.in/yaml.v2 v2.4.0
+	gopkg.in/yaml.v3 v3.0.1
 )
+
+require github.com/mattn/go-runewidth v0.0.9 // indirect
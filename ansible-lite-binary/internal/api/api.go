@@ -1,26 +1,101 @@
 package api
 
 import (
-	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"strconv"
+	"time"
 	"aidalinfo/ansible-lite/internal/endpoints"
-	"aidalinfo/ansible-lite/internal/middleware"
 	"aidalinfo/ansible-lite/internal/config"
+	"aidalinfo/ansible-lite/internal/logger"
+	"aidalinfo/ansible-lite/internal/metrics"
+	"aidalinfo/ansible-lite/internal/middleware"
+)
+
+var (
+	apiRequests = metrics.NewCounter("ansible_lite_api_requests_total",
+		"Requêtes reçues par l'API par route, méthode et code de réponse.", "path", "method", "code")
+	apiDuration = metrics.NewHistogram("ansible_lite_api_request_duration_seconds",
+		"Durée de traitement des requêtes de l'API par route.", []float64{0.005, 0.01, 0.05, 0.1, 0.5, 1, 5, 30, 60}, "path")
 )
 
 // Démarrer le serveur HTTP avec le port passé en paramètre et la configuration pour le token
 func StartServer(port int, cfg *config.GlobalConfig) {
-	// Initialiser les routes depuis le package endpoint
+	// Initialiser les routes depuis le package endpoint, chacune validant le token d'API
+	// à l'exception des webhooks des forges, vérifiés par signature
 	mux := http.NewServeMux()
 	endpoints.InitRoutes(mux, cfg)
 
-	// Appliquer le middleware pour valider le token
-	handlerWithMiddleware := middleware.ValidateToken(mux, cfg)
+	// Métriques Prometheus : sur l'API avec le token, ou sur une adresse dédiée sans authentification
+	if cfg.Global.MetricsListen != "" {
+		go startMetricsServer(cfg.Global.MetricsListen)
+	} else {
+		mux.Handle("/metrics", middleware.ValidateToken(metrics.Handler(), cfg))
+	}
+
+	// Démarrer le serveur sur le port spécifié, sur toutes les interfaces ou sur bind_address
+	server := &http.Server{
+		Addr:    net.JoinHostPort(cfg.Global.BindAddress, strconv.Itoa(port)),
+		Handler: instrument(mux),
+	}
+	if !cfg.Global.SSL {
+		logger.Log("INFO", "Serveur API démarré sur %s", server.Addr)
+		if err := server.ListenAndServe(); err != nil {
+			log.Fatalf("Erreur lors du démarrage du serveur HTTP : %v", err)
+		}
+		return
+	}
+
+	tlsCfg, err := tlsConfig(cfg)
+	if err != nil {
+		log.Fatalf("Erreur dans la configuration TLS de l'API : %v", err)
+	}
+	server.TLSConfig = tlsCfg
+	if cfg.Global.ClientCA != "" {
+		logger.Log("INFO", "Serveur API démarré sur %s (HTTPS, certificats clients signés par %s exigés)", server.Addr, cfg.Global.ClientCA)
+	} else {
+		logger.Log("INFO", "Serveur API démarré sur %s (HTTPS)", server.Addr)
+	}
+	// Certificat et clé fournis par TLSConfig.GetCertificate
+	if err := server.ListenAndServeTLS("", ""); err != nil {
+		log.Fatalf("Erreur lors du démarrage du serveur HTTPS : %v", err)
+	}
+}
 
-	// Démarrer le serveur sur le port spécifié
-	log.Printf("Serveur API démarré sur le port %d", port)
-	if err := http.ListenAndServe(fmt.Sprintf(":%d", port), handlerWithMiddleware); err != nil {
-		log.Fatalf("Erreur lors du démarrage du serveur HTTP : %v", err)
+// Servir /metrics seul sur une adresse dédiée, destinée au scraper Prometheus
+func startMetricsServer(addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	logger.Log("INFO", "Métriques exposées sur %s/metrics", addr)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		log.Fatalf("Erreur lors du démarrage du serveur des métriques : %v", err)
 	}
 }
+
+// ResponseWriter qui retient le code de réponse
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Compter les requêtes et mesurer leur durée, par route enregistrée (et non par URL, pour
+// borner le nombre de séries)
+func instrument(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, pattern := mux.Handler(r)
+		if pattern == "" {
+			pattern = "inconnue"
+		}
+		started := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		mux.ServeHTTP(rec, r)
+		apiRequests.Inc(pattern, r.Method, strconv.Itoa(rec.status))
+		apiDuration.Observe(time.Since(started).Seconds(), pattern)
+	})
+}
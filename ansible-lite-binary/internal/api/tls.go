@@ -0,0 +1,114 @@
+package api
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"aidalinfo/ansible-lite/internal/config"
+	"aidalinfo/ansible-lite/internal/logger"
+)
+
+// Certificat du serveur, rechargé dès que le certificat ou la clé sont remplacés (renouvellement
+// par certbot, cert-manager...) sans redémarrer le service
+type certReloader struct {
+	certPath string
+	keyPath  string
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	certMod time.Time
+	keyMod  time.Time
+}
+
+func newCertReloader(certPath, keyPath string) (*certReloader, error) {
+	r := &certReloader{certPath: certPath, keyPath: keyPath}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Dates de modification du certificat et de la clé
+func (r *certReloader) modTimes() (time.Time, time.Time, error) {
+	certInfo, err := os.Stat(r.certPath)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	keyInfo, err := os.Stat(r.keyPath)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	return certInfo.ModTime(), keyInfo.ModTime(), nil
+}
+
+// Charger le certificat et la clé (r.mu verrouillé ou reloader en construction)
+func (r *certReloader) reload() error {
+	certMod, keyMod, err := r.modTimes()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.certPath, r.keyPath)
+	if err != nil {
+		return fmt.Errorf("chargement du certificat %s impossible : %v", r.certPath, err)
+	}
+	r.cert, r.certMod, r.keyMod = &cert, certMod, keyMod
+	return nil
+}
+
+// Certificat présenté à chaque connexion ; s'il a été remplacé mais ne peut pas être chargé
+// (clé pas encore écrite...), le précédent est conservé et le chargement retenté à la connexion suivante
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	certMod, keyMod, err := r.modTimes()
+	if err == nil && (!certMod.Equal(r.certMod) || !keyMod.Equal(r.keyMod)) {
+		if err = r.reload(); err == nil {
+			logger.Log("INFO", "Certificat de l'API rechargé depuis %s", r.certPath)
+		}
+	}
+	if err != nil {
+		logger.Log("WARN", "Certificat de l'API non rechargé, le précédent reste utilisé : %v", err)
+	}
+	return r.cert, nil
+}
+
+// Lire un fichier de certificats PEM (CA)
+func loadCertPool(path string) (*x509.CertPool, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("aucun certificat PEM trouvé dans %s", path)
+	}
+	return pool, nil
+}
+
+// Configuration TLS de l'API : certificat rechargé automatiquement et, avec client_ca, vérification
+// des certificats clients. Un certificat client n'est exigé que sur les routes protégées par le token
+// (middleware.ValidateToken) : les webhooks des forges et les agents s'authentifient autrement
+func tlsConfig(cfg *config.GlobalConfig) (*tls.Config, error) {
+	reloader, err := newCertReloader(cfg.Global.Cert, cfg.Global.Key)
+	if err != nil {
+		return nil, err
+	}
+	tlsCfg := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.GetCertificate,
+	}
+	if cfg.Global.ClientCA != "" {
+		pool, err := loadCertPool(cfg.Global.ClientCA)
+		if err != nil {
+			return nil, fmt.Errorf("CA des certificats clients illisible : %v", err)
+		}
+		tlsCfg.ClientCAs = pool
+		tlsCfg.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return tlsCfg, nil
+}
@@ -0,0 +1,387 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"aidalinfo/ansible-lite/internal/logger"
+)
+
+// Problème détecté lors de la validation d'un fichier de configuration
+type Issue struct {
+	File    string
+	Line    int // 0 si la position n'est pas connue
+	Message string
+}
+
+func (i Issue) String() string {
+	if i.Line > 0 {
+		return fmt.Sprintf("%s:%d: %s", i.File, i.Line, i.Message)
+	}
+	return fmt.Sprintf("%s: %s", i.File, i.Message)
+}
+
+// Fichier YAML décodé en arbre de nœuds, pour situer chaque erreur dans le fichier
+type Document struct {
+	File   string
+	Root   *yaml.Node // Nœud racine (mapping), nil si le fichier est illisible
+	Issues []Issue
+	// Ne pas vérifier les fichiers référencés : ils se trouvent sur une autre machine (catalogue du serveur)
+	Remote bool
+}
+
+// Position indiquée dans les erreurs du parseur YAML ("yaml: line 12: ...")
+var yamlErrorLine = regexp.MustCompile(`line (\d+)`)
+
+// Lire et décoder un fichier YAML sans l'interpréter
+func ParseDocument(path string) *Document {
+	d := &Document{File: path}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		d.Issues = append(d.Issues, Issue{File: path, Message: fmt.Sprintf("impossible de lire le fichier : %v", err)})
+		return d
+	}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		line := 0
+		if m := yamlErrorLine.FindStringSubmatch(err.Error()); m != nil {
+			line, _ = strconv.Atoi(m[1])
+		}
+		d.Issues = append(d.Issues, Issue{File: path, Line: line, Message: strings.TrimPrefix(err.Error(), "yaml: ")})
+		return d
+	}
+	if len(root.Content) == 0 {
+		d.Issues = append(d.Issues, Issue{File: path, Message: "fichier vide"})
+		return d
+	}
+	d.Root = root.Content[0]
+	return d
+}
+
+// Problèmes détectés, dans l'ordre du fichier
+func (d *Document) Sorted() []Issue {
+	sort.SliceStable(d.Issues, func(i, j int) bool { return d.Issues[i].Line < d.Issues[j].Line })
+	return d.Issues
+}
+
+// Signaler une erreur à la position du nœud
+func (d *Document) Errorf(node *yaml.Node, format string, args ...interface{}) {
+	line := 0
+	if node != nil {
+		line = node.Line
+	}
+	d.Issues = append(d.Issues, Issue{File: d.File, Line: line, Message: fmt.Sprintf(format, args...)})
+}
+
+// Valeur associée à une clé d'un mapping (nil si absente)
+func Field(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// Parcourir les couples clé/valeur d'un mapping
+func Entries(node *yaml.Node, fn func(key, value *yaml.Node)) {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		fn(node.Content[i], node.Content[i+1])
+	}
+}
+
+// Signaler les clés obligatoires absentes ou vides d'un mapping
+func (d *Document) Require(node *yaml.Node, what string, keys ...string) {
+	for _, key := range keys {
+		value := Field(node, key)
+		if value == nil {
+			d.Errorf(node, "%s : clé %s obligatoire", what, key)
+		} else if (value.Kind == yaml.ScalarNode && (value.Value == "" || value.Tag == "!!null")) ||
+			(value.Kind != yaml.ScalarNode && len(value.Content) == 0) {
+			d.Errorf(value, "%s : %s ne peut pas être vide", what, key)
+		}
+	}
+}
+
+// Vérifier une durée Go optionnelle (30s, 10m...)
+func (d *Document) CheckDuration(node *yaml.Node, what, key string) {
+	value := Field(node, key)
+	if value == nil || value.Value == "" {
+		return
+	}
+	if _, err := time.ParseDuration(value.Value); err != nil {
+		d.Errorf(value, "%s : %s invalide %q (exemples : 90s, 30m, 1h)", what, key, value.Value)
+	}
+}
+
+// Vérifier qu'une valeur fait partie des valeurs autorisées (une valeur vide est acceptée)
+func (d *Document) CheckEnum(node *yaml.Node, what, key string, allowed ...string) {
+	value := Field(node, key)
+	if value == nil || value.Value == "" {
+		return
+	}
+	for _, a := range allowed {
+		if value.Value == a {
+			return
+		}
+	}
+	d.Errorf(value, "%s : %s inconnu %q (valeurs possibles : %s)", what, key, value.Value, strings.Join(allowed, ", "))
+}
+
+// Vérifier qu'un fichier référencé par la configuration existe
+func (d *Document) CheckFileExists(node *yaml.Node, what, key string) {
+	value := Field(node, key)
+	if value == nil || value.Value == "" || d.Remote {
+		return
+	}
+	if _, err := os.Stat(value.Value); err != nil {
+		d.Errorf(value, "%s : %s introuvable : %s", what, key, value.Value)
+	}
+}
+
+// Vérifier que le répertoire parent d'un chemin existe
+func (d *Document) CheckParentExists(node *yaml.Node, what, key string) {
+	value := Field(node, key)
+	if value == nil || value.Value == "" || d.Remote {
+		return
+	}
+	parent := filepath.Dir(filepath.Clean(value.Value))
+	if info, err := os.Stat(parent); err != nil || !info.IsDir() {
+		d.Errorf(value, "%s : le répertoire %s de %s n'existe pas", what, parent, key)
+	}
+}
+
+// Vérifier qu'un nœud correspond au type Go dans lequel il sera décodé :
+// clés inconnues des structures et valeurs de type incompatible
+func (d *Document) CheckType(node *yaml.Node, t reflect.Type) {
+	if node == nil {
+		return
+	}
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	// Une valeur nulle laisse le champ vide
+	if node.Kind == yaml.ScalarNode && node.Tag == "!!null" {
+		return
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		if node.Kind != yaml.MappingNode {
+			d.Errorf(node, "un ensemble de clés est attendu")
+			return
+		}
+		fields := yamlFields(t)
+		Entries(node, func(key, value *yaml.Node) {
+			field, ok := fields[key.Value]
+			if !ok {
+				d.Errorf(key, "clé inconnue %q", key.Value)
+				return
+			}
+			d.CheckType(value, field)
+		})
+	case reflect.Map:
+		if node.Kind != yaml.MappingNode {
+			d.Errorf(node, "un ensemble de clés est attendu")
+			return
+		}
+		Entries(node, func(key, value *yaml.Node) {
+			d.CheckType(value, t.Elem())
+		})
+	case reflect.Slice:
+		if node.Kind != yaml.SequenceNode {
+			d.Errorf(node, "une liste est attendue")
+			return
+		}
+		for _, item := range node.Content {
+			d.CheckType(item, t.Elem())
+		}
+	default:
+		if node.Kind != yaml.ScalarNode {
+			d.Errorf(node, "une valeur simple est attendue")
+			return
+		}
+		if err := node.Decode(reflect.New(t).Interface()); err != nil {
+			d.Errorf(node, "valeur invalide %q : %s attendu", node.Value, typeName(t))
+		}
+	}
+}
+
+// Nom lisible d'un type scalaire
+func typeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Bool:
+		return "true ou false"
+	case reflect.Int, reflect.Int64, reflect.Int32:
+		return "nombre entier"
+	case reflect.Float64, reflect.Float32:
+		return "nombre"
+	}
+	return "texte"
+}
+
+// Clés YAML acceptées par une structure, champs intégrés (inline) compris
+func yamlFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("yaml")
+		name := strings.Split(tag, ",")[0]
+		if strings.Contains(tag, ",inline") {
+			for key, ft := range yamlFields(f.Type) {
+				fields[key] = ft
+			}
+			continue
+		}
+		if name == "-" || f.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		fields[name] = f.Type
+	}
+	return fields
+}
+
+// Vérifier que les paramètres de rotation ne sont pas négatifs
+func checkRotation(d *Document, node *yaml.Node, what string) {
+	for _, key := range []string{"max_size", "max_backups", "max_age"} {
+		if value := Field(node, key); value != nil {
+			if n, err := strconv.Atoi(value.Value); err == nil && n < 0 {
+				d.Errorf(value, "%s : %s ne peut pas être négatif", what, key)
+			}
+		}
+	}
+}
+
+// Niveaux de log acceptés par log_level
+var logLevels = []string{"debug", "info", "warn", "warning", "error"}
+
+// Valider config.yaml ; la configuration décodée est renvoyée si le fichier est lisible
+func CheckFile(path string) ([]Issue, *GlobalConfig) {
+	d := ParseDocument(path)
+	if d.Root == nil {
+		return d.Sorted(), nil
+	}
+	d.CheckType(d.Root, reflect.TypeOf(GlobalConfig{}))
+
+	global := Field(d.Root, "GLOBAL")
+	if global == nil {
+		d.Errorf(d.Root, "section GLOBAL manquante")
+		return d.Sorted(), nil
+	}
+	d.Require(global, "GLOBAL", "db_path", "repos_config", "port")
+	d.CheckEnum(global, "GLOBAL", "log_level", logLevels...)
+	d.CheckEnum(global, "GLOBAL", "log_format", "text", "json")
+	d.CheckEnum(global, "GLOBAL", "type", TypeClient, TypeServer)
+	d.CheckDuration(global, "GLOBAL", "script_timeout")
+	d.CheckDuration(global, "GLOBAL", "kill_grace_period")
+	d.CheckDuration(global, "GLOBAL", "facts_refresh")
+	// Sur un agent, repos.yaml est écrit à partir de la configuration reçue du serveur
+	serverURL := Field(global, "server_url")
+	if serverURL == nil {
+		d.CheckFileExists(global, "GLOBAL", "repos_config")
+	} else if !strings.HasPrefix(serverURL.Value, "http://") && !strings.HasPrefix(serverURL.Value, "https://") {
+		d.Errorf(serverURL, "GLOBAL : server_url doit commencer par http:// ou https://")
+	}
+	if serverType := Field(global, "type"); (serverType != nil && serverType.Value == TypeServer) || serverURL != nil {
+		d.Require(global, "GLOBAL", "join_token")
+	}
+	// Le répertoire des logs est créé au démarrage, la base peut s'y trouver
+	dbPath, logPath := Field(global, "db_path"), Field(global, "log_path")
+	if dbPath == nil || logPath == nil || filepath.Dir(filepath.Clean(dbPath.Value)) != filepath.Dir(filepath.Clean(logPath.Value)) {
+		d.CheckParentExists(global, "GLOBAL", "db_path")
+	}
+
+	if port := Field(global, "port"); port != nil {
+		if n, err := strconv.Atoi(port.Value); err == nil && (n < 1 || n > 65535) {
+			d.Errorf(port, "GLOBAL : port hors limites %d", n)
+		}
+	}
+	if workers := Field(global, "max_workers"); workers != nil {
+		if n, err := strconv.Atoi(workers.Value); err == nil && n < 0 {
+			d.Errorf(workers, "GLOBAL : max_workers ne peut pas être négatif")
+		}
+	}
+
+	if bind := Field(global, "bind_address"); bind != nil && strings.Contains(bind.Value, ":") && net.ParseIP(bind.Value) == nil {
+		d.Errorf(bind, "GLOBAL : bind_address invalide %q (adresse sans port, exemples : 127.0.0.1, ::1)", bind.Value)
+	}
+	if ssl := Field(global, "ssl"); ssl != nil && ssl.Value == "true" {
+		d.Require(global, "GLOBAL", "cert", "key")
+		d.CheckFileExists(global, "GLOBAL", "cert")
+		d.CheckFileExists(global, "GLOBAL", "key")
+		d.CheckFileExists(global, "GLOBAL", "client_ca")
+	} else if clientCA := Field(global, "client_ca"); clientCA != nil && clientCA.Value != "" {
+		d.Errorf(clientCA, "GLOBAL : client_ca nécessite ssl: true")
+	}
+	d.CheckFileExists(global, "GLOBAL", "server_ca")
+
+	if listen := Field(global, "metrics_listen"); listen != nil && listen.Value != "" {
+		if _, _, err := net.SplitHostPort(listen.Value); err != nil {
+			d.Errorf(listen, "GLOBAL : metrics_listen invalide %q (exemples : :9110, 127.0.0.1:9110)", listen.Value)
+		}
+	}
+
+	checkRotation(d, Field(global, "log_rotation"), "log_rotation")
+	if sinks := Field(global, "log_sinks"); sinks != nil && sinks.Kind == yaml.SequenceNode {
+		for _, node := range sinks.Content {
+			what := "log_sinks"
+			d.Require(node, what, "type")
+			d.CheckEnum(node, what, "type", LogSinkFile, LogSinkStdout, LogSinkStderr, LogSinkSyslog, LogSinkJournald)
+			d.CheckEnum(node, what, "level", logLevels...)
+			d.CheckEnum(node, what, "format", "text", "json")
+			d.CheckEnum(node, what, "facility", logger.SyslogFacilities...)
+			if sinkType := Field(node, "type"); sinkType != nil && sinkType.Value == LogSinkFile {
+				if Field(node, "path") == nil && (logPath == nil || logPath.Value == "") {
+					d.Errorf(node, "%s : path obligatoire en l'absence de log_path", what)
+				}
+			}
+			checkRotation(d, node, what)
+		}
+	}
+
+	Entries(Field(global, "notifiers"), func(key, node *yaml.Node) {
+		what := "notifier " + key.Value
+		d.Require(node, what, "type")
+		d.CheckEnum(node, what, "type", NotifierWebhook, NotifierSlack, NotifierMattermost, NotifierSMTP)
+		if notifierType := Field(node, "type"); notifierType != nil && notifierType.Value == NotifierSMTP {
+			d.Require(node, what, "host", "from", "to")
+		} else if notifierType != nil {
+			d.Require(node, what, "url")
+		}
+		if attempts := Field(node, "max_attempts"); attempts != nil {
+			if n, err := strconv.Atoi(attempts.Value); err == nil && n < 0 {
+				d.Errorf(attempts, "%s : max_attempts ne peut pas être négatif", what)
+			}
+		}
+	})
+
+	var cfg GlobalConfig
+	if err := d.Root.Decode(&cfg); err != nil {
+		return d.Sorted(), nil
+	}
+	return d.Sorted(), &cfg
+}
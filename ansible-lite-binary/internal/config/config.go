@@ -6,20 +6,125 @@ import (
 	"io/ioutil"
 )
 
+// Valeurs de GLOBAL.type : client (machine autonome ou agent si server_url est défini) ou server (contrôleur)
+const (
+	TypeClient = "client"
+	TypeServer = "server"
+)
+
 // Structure pour stocker la configuration globale
 type GlobalConfig struct {
 	Global struct {
-		Type        string `yaml:" type"`
-		DBPath      string `yaml:"db_path"`
-		LogPath     string `yaml:"log_path"`
-		LogLevel    string `yaml:"log_level"`
-		ReposConfig string `yaml:"repos_config"`
-		Port        int    `yaml:"port"`
+		Type      string `yaml:"type"`
+		DBPath    string `yaml:"db_path"`
+		LogPath   string `yaml:"log_path"`
+		LogLevel  string `yaml:"log_level"`
+		LogFormat string `yaml:"log_format,omitempty"` // text (défaut) ou json
+		// Rotation de log_path et destinations des logs (log_path seul par défaut)
+		LogRotation LogRotation `yaml:"log_rotation,omitempty"`
+		LogSinks    []LogSink   `yaml:"log_sinks,omitempty"`
+		ReposConfig string      `yaml:"repos_config"`
+		Port        int         `yaml:"port"`
+		// Adresse d'écoute de l'API (toutes les interfaces par défaut, ex. 127.0.0.1)
+		BindAddress string `yaml:"bind_address,omitempty"`
+		// HTTPS : certificat et clé rechargés à leur remplacement, CA des certificats clients
+		// exigés sur les routes protégées par le token (mTLS)
+		SSL         bool   `yaml:"ssl,omitempty"`
+		Cert        string `yaml:"cert,omitempty"`
+		Key         string `yaml:"key,omitempty"`
+		ClientCA    string `yaml:"client_ca,omitempty"`
 		Credentials string `yaml:"credentials"`
 		GithubToken string `yaml:"gh_token"`
+		// Durée maximale par défaut des scripts (ex. 30m) et délai entre SIGTERM et SIGKILL
+		ScriptTimeout   string `yaml:"script_timeout,omitempty"`
+		KillGracePeriod string `yaml:"kill_grace_period,omitempty"`
+		// Nombre maximal de tâches traitées simultanément (4 par défaut)
+		MaxWorkers int `yaml:"max_workers,omitempty"`
+		// Recharger repos.yaml dès que le fichier est modifié (en plus de SIGHUP et POST /reload)
+		WatchReposConfig bool `yaml:"watch_repos_config,omitempty"`
+		// Faits statiques et labels de la machine, ajoutés aux faits collectés
+		Facts  map[string]string `yaml:"facts,omitempty"`
+		Labels map[string]string `yaml:"labels,omitempty"`
+		// Intervalle de rafraîchissement des faits collectés (5m par défaut)
+		FactsRefresh string `yaml:"facts_refresh,omitempty"`
+		// Mode serveur : jeton que les agents présentent pour s'inscrire.
+		// Mode agent : URL du contrôleur, jeton d'inscription et nom de l'agent (nom d'hôte par défaut)
+		JoinToken string `yaml:"join_token,omitempty"`
+		ServerURL string `yaml:"server_url,omitempty"`
+		AgentName string `yaml:"agent_name,omitempty"`
+		// Mode agent : CA du certificat du serveur (autorités du système par défaut)
+		ServerCA string `yaml:"server_ca,omitempty"`
+		// Adresse d'écoute dédiée à /metrics, sans authentification (ex. :9110) ; sinon /metrics
+		// est servi par l'API avec le token
+		MetricsListen string `yaml:"metrics_listen,omitempty"`
+		// Destinations des notifications, référencées par nom dans les tâches (notifications:)
+		Notifiers map[string]Notifier `yaml:"notifiers,omitempty"`
 	} `yaml:"GLOBAL"`
 }
 
+// Types de destination des logs
+const (
+	LogSinkFile     = "file"
+	LogSinkStdout   = "stdout"
+	LogSinkStderr   = "stderr"
+	LogSinkSyslog   = "syslog"
+	LogSinkJournald = "journald"
+)
+
+// Rotation d'un fichier de log
+type LogRotation struct {
+	MaxSize    int   `yaml:"max_size,omitempty"`    // Taille en Mo avant rotation (50 par défaut)
+	MaxBackups *int  `yaml:"max_backups,omitempty"` // Fichiers archivés conservés (5 par défaut, 0 : tous)
+	MaxAge     *int  `yaml:"max_age,omitempty"`     // Conservation des archives en jours (90 par défaut, 0 : sans limite)
+	Compress   *bool `yaml:"compress,omitempty"`    // Compression des archives (true par défaut)
+}
+
+// Destination des logs
+type LogSink struct {
+	Type   string `yaml:"type"`             // file, stdout, stderr, syslog ou journald
+	Level  string `yaml:"level,omitempty"`  // Niveau minimal, log_level par défaut
+	Format string `yaml:"format,omitempty"` // text ou json, log_format par défaut (sans objet pour journald)
+
+	// file : chemin (log_path par défaut) et rotation, log_rotation par défaut
+	Path        string `yaml:"path,omitempty"`
+	LogRotation `yaml:",inline"`
+
+	// syslog et journald
+	Facility string `yaml:"facility,omitempty"` // Facility syslog (daemon par défaut)
+	Tag      string `yaml:"tag,omitempty"`      // Identifiant des messages (ansible-lite par défaut)
+}
+
+// Types de destination de notifications
+const (
+	NotifierWebhook    = "webhook"
+	NotifierSlack      = "slack"
+	NotifierMattermost = "mattermost"
+	NotifierSMTP       = "smtp"
+)
+
+// Destination de notifications
+type Notifier struct {
+	Type string `yaml:"type"` // webhook, slack, mattermost ou smtp
+	// Corps JSON (webhook), texte du message (slack, mattermost) ou du mail (smtp), au format text/template
+	Template    string `yaml:"template,omitempty"`
+	MaxAttempts int    `yaml:"max_attempts,omitempty"` // Tentatives d'envoi (5 par défaut)
+
+	// webhook, slack et mattermost
+	URL      string            `yaml:"url,omitempty"`
+	Headers  map[string]string `yaml:"headers,omitempty"`
+	Channel  string            `yaml:"channel,omitempty"`  // Canal remplaçant celui du webhook entrant
+	Username string            `yaml:"username,omitempty"` // Nom affiché (slack, mattermost) ou identifiant SMTP
+
+	// smtp
+	Host     string   `yaml:"host,omitempty"`
+	Port     int      `yaml:"port,omitempty"` // 587 par défaut
+	Password string   `yaml:"password,omitempty"`
+	TLS      bool     `yaml:"tls,omitempty"` // TLS dès la connexion (port 465), sinon STARTTLS si le serveur le propose
+	From     string   `yaml:"from,omitempty"`
+	To       []string `yaml:"to,omitempty"`
+	Subject  string   `yaml:"subject,omitempty"` // Modèle du sujet
+}
+
 // Fonction pour charger le fichier de configuration YAML
 func LoadConfig(path string) (*GlobalConfig, error) {
 	var config GlobalConfig
@@ -2,15 +2,111 @@ package db
 
 import (
     "database/sql"
+    "encoding/json"
+    "fmt"
+    "strings"
+    "time"
     "aidalinfo/ansible-lite/internal/logger"
     _ "github.com/mattn/go-sqlite3"
 )
 
 type ExecutionDetail struct {
+    ID         int64
+    JobKind    string
     RepoName   string
     RepoURL    string
+    Trigger    string
     CommitID   string
     ExecutedAt string
+    FinishedAt string
+    DurationMs int64
+    ExitCode   *int
+    Status     string
+    Recap      *PlaybookRecap // Totaux par hôte d'un playbook (sans le détail des tâches)
+    Agent      string         // Agent ayant exécuté la tâche (mode serveur), vide en local
+}
+
+// Exécution complète d'un script d'init, sortie capturée comprise
+type Execution struct {
+    ID         int64
+    JobKind    string // repo, flux ou continuous
+    JobName    string
+    Source     string // URL du dépôt, URL surveillée par le flux ou image Docker
+    Trigger    string // SHA du commit, tag ou digest de l'image
+    Commit     string // SHA réellement extrait du dépôt d'initialisation
+    StartedAt  string
+    FinishedAt string
+    DurationMs int64
+    ExitCode   *int
+    Status     string // running, success, failed, skipped
+    Output     string
+    Recap      *PlaybookRecap // Récapitulatif d'un playbook, nil pour un script
+    Agent      string         // Agent ayant exécuté la tâche (mode serveur), vide en local
+}
+
+// Récapitulatif d'une exécution ansible-playbook
+type PlaybookRecap struct {
+    Hosts []HostRecap
+    Tasks []TaskRecap `json:",omitempty"`
+}
+
+// Totaux d'un hôte en fin de playbook (PLAY RECAP)
+type HostRecap struct {
+    Host        string
+    Ok          int
+    Changed     int
+    Failed      int
+    Unreachable int
+    Skipped     int
+    Rescued     int
+    Ignored     int
+}
+
+// Résultat d'une tâche sur un hôte
+type TaskRecap struct {
+    Play    string
+    Task    string
+    Host    string
+    Status  string // ok, changed, failed, unreachable, skipped
+    Message string `json:",omitempty"`
+}
+
+// État persistant d'une tâche (échecs consécutifs, désactivation, pause)
+type JobState struct {
+    JobKind             string
+    JobName             string
+    ConsecutiveFailures int
+    Disabled            bool
+    Paused              bool
+    LastError           string
+    UpdatedAt           string
+}
+
+// Colonne SQL ajoutée par migration
+type column struct {
+    Name string
+    Type string
+}
+
+// Colonnes ajoutées à la table executions après sa création initiale
+var executionColumns = []column{
+    {"job_kind", "TEXT"},
+    {"job_name", "TEXT"},
+    {"source", "TEXT"},
+    {"trigger", "TEXT"},
+    {"started_at", "TEXT"},
+    {"finished_at", "TEXT"},
+    {"duration_ms", "INTEGER"},
+    {"exit_code", "INTEGER"},
+    {"status", "TEXT"},
+    {"output", "TEXT"},
+    {"recap", "TEXT"},
+    {"agent", "TEXT"},
+}
+
+// Colonnes ajoutées à la table job_state après sa création initiale
+var jobStateColumns = []column{
+    {"paused", "INTEGER DEFAULT 0"},
 }
 
 // Fonction pour initialiser la base de données SQLite
@@ -46,6 +142,36 @@ func InitDB(dbPath string) error {
         last_tag TEXT,  -- Dernier tag récupéré
         regex TEXT
     );
+
+    CREATE TABLE IF NOT EXISTS job_state (
+        job_kind TEXT,  -- repo, flux ou continuous
+        job_name TEXT,
+        consecutive_failures INTEGER DEFAULT 0,
+        disabled INTEGER DEFAULT 0,  -- Désactivée par le disjoncteur
+        last_error TEXT,
+        updated_at TEXT,
+        PRIMARY KEY (job_kind, job_name)
+    );
+
+    CREATE TABLE IF NOT EXISTS agents (
+        name TEXT PRIMARY KEY,
+        token_hash TEXT,  -- SHA-256 du token de l'agent
+        labels TEXT,  -- JSON
+        facts TEXT,  -- JSON des faits à plat
+        enrolled_at TEXT,
+        last_seen TEXT,
+        config_version TEXT,  -- Version de la configuration appliquée par l'agent
+        config_error TEXT  -- Erreur de l'agent à l'application de la dernière configuration
+    );
+
+    CREATE TABLE IF NOT EXISTS api_tokens (
+        name TEXT PRIMARY KEY,
+        token_hash TEXT UNIQUE,  -- SHA-256 du token, seul conservé
+        scopes TEXT,  -- read, trigger, admin séparés par des virgules
+        created_at TEXT,  -- Création ou dernière rotation
+        expires_at TEXT,  -- Vide : sans expiration
+        last_used_at TEXT
+    );
     `
     _, err = db.Exec(sqlStmt)
     if err != nil {
@@ -53,6 +179,49 @@ func InitDB(dbPath string) error {
         return err
     }
 
+    // Mettre à jour les bases existantes avec les nouvelles colonnes
+    err = addMissingColumns(db, "executions", executionColumns)
+    if err != nil {
+        logger.Log("ERROR", "Impossible de migrer la table executions : %v", err)
+        return err
+    }
+    err = addMissingColumns(db, "job_state", jobStateColumns)
+    if err != nil {
+        logger.Log("ERROR", "Impossible de migrer la table job_state : %v", err)
+        return err
+    }
+
+    return nil
+}
+
+// Ajouter les colonnes absentes d'une table (migration des anciennes bases)
+func addMissingColumns(db *sql.DB, table string, columns []column) error {
+    rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+    if err != nil {
+        return err
+    }
+    existing := make(map[string]bool)
+    for rows.Next() {
+        var cid, notNull, pk int
+        var name, colType string
+        var dflt sql.NullString
+        if err := rows.Scan(&cid, &name, &colType, &notNull, &dflt, &pk); err != nil {
+            rows.Close()
+            return err
+        }
+        existing[name] = true
+    }
+    rows.Close()
+
+    for _, col := range columns {
+        if existing[col.Name] {
+            continue
+        }
+        _, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, col.Name, col.Type))
+        if err != nil {
+            return err
+        }
+    }
     return nil
 }
 
@@ -176,11 +345,24 @@ func GetExecutionDetails(dbPath string) ([]ExecutionDetail, error) {
     }
     defer db.Close()
 
+    // Les anciennes exécutions n'ont que repo_id, d'où la jointure externe sur repos
     query := `
-        SELECT repos.name, repos.repo_url, executions.commit_id, executions.execution_time
+        SELECT executions.id,
+               COALESCE(executions.job_kind, 'repo'),
+               COALESCE(executions.job_name, repos.name, ''),
+               COALESCE(executions.source, repos.repo_url, ''),
+               COALESCE(executions.trigger, executions.commit_id, ''),
+               COALESCE(executions.commit_id, ''),
+               COALESCE(executions.started_at, executions.execution_time, ''),
+               COALESCE(executions.finished_at, ''),
+               COALESCE(executions.duration_ms, 0),
+               executions.exit_code,
+               COALESCE(executions.status, ''),
+               executions.recap,
+               COALESCE(executions.agent, '')
         FROM executions
-        JOIN repos ON executions.repo_id = repos.id
-        ORDER BY executions.execution_time DESC
+        LEFT JOIN repos ON executions.repo_id = repos.id
+        ORDER BY executions.id DESC
     `
 
     rows, err := db.Query(query)
@@ -193,19 +375,100 @@ func GetExecutionDetails(dbPath string) ([]ExecutionDetail, error) {
     var details []ExecutionDetail
     for rows.Next() {
         var detail ExecutionDetail
-        if err := rows.Scan(&detail.RepoName, &detail.RepoURL, &detail.CommitID, &detail.ExecutedAt); err != nil {
+        var exitCode sql.NullInt64
+        var recap sql.NullString
+        if err := rows.Scan(&detail.ID, &detail.JobKind, &detail.RepoName, &detail.RepoURL, &detail.Trigger, &detail.CommitID, &detail.ExecutedAt, &detail.FinishedAt, &detail.DurationMs, &exitCode, &detail.Status, &recap, &detail.Agent); err != nil {
             logger.Log("ERROR", "Erreur lors du scan des lignes : %v", err)
             return nil, err
         }
+        if exitCode.Valid {
+            code := int(exitCode.Int64)
+            detail.ExitCode = &code
+        }
+        detail.Recap = decodeRecap(recap)
+        if detail.Recap != nil {
+            detail.Recap.Tasks = nil
+        }
         details = append(details, detail)
     }
 
     return details, nil
 }
 
+// Récupérer une exécution complète (avec la sortie du script) à partir de son ID
+func GetExecution(dbPath string, id int64) (*Execution, error) {
+    db, err := sql.Open("sqlite3", dbPath)
+    if err != nil {
+        logger.Log("ERROR", "Impossible d'ouvrir la base de données : %v", err)
+        return nil, err
+    }
+    defer db.Close()
+
+    query := `
+        SELECT executions.id,
+               COALESCE(executions.job_kind, 'repo'),
+               COALESCE(executions.job_name, repos.name, ''),
+               COALESCE(executions.source, repos.repo_url, ''),
+               COALESCE(executions.trigger, executions.commit_id, ''),
+               COALESCE(executions.commit_id, ''),
+               COALESCE(executions.started_at, executions.execution_time, ''),
+               COALESCE(executions.finished_at, ''),
+               COALESCE(executions.duration_ms, 0),
+               executions.exit_code,
+               COALESCE(executions.status, ''),
+               COALESCE(executions.output, ''),
+               executions.recap,
+               COALESCE(executions.agent, '')
+        FROM executions
+        LEFT JOIN repos ON executions.repo_id = repos.id
+        WHERE executions.id = ?
+    `
+
+    var e Execution
+    var exitCode sql.NullInt64
+    var recap sql.NullString
+    err = db.QueryRow(query, id).Scan(&e.ID, &e.JobKind, &e.JobName, &e.Source, &e.Trigger, &e.Commit, &e.StartedAt, &e.FinishedAt, &e.DurationMs, &exitCode, &e.Status, &e.Output, &recap, &e.Agent)
+    if err != nil {
+        if err == sql.ErrNoRows {
+            return nil, nil
+        }
+        logger.Log("ERROR", "Erreur lors de la récupération de l'exécution %d : %v", id, err)
+        return nil, err
+    }
+    if exitCode.Valid {
+        code := int(exitCode.Int64)
+        e.ExitCode = &code
+    }
+    e.Recap = decodeRecap(recap)
+    return &e, nil
+}
+
+// Enregistrer le début d'une exécution dans la table executions et renvoyer son ID
+func LogExecution(dbPath string, e *Execution) (int64, error) {
+    db, err := sql.Open("sqlite3", dbPath)
+    if err != nil {
+        logger.Log("ERROR", "Impossible d'ouvrir la base de données : %v", err)
+        return 0, err
+    }
+    defer db.Close()
+
+    logger.Log("DEBUG", "Insertion de l'exécution dans la base de données (%s %s, déclencheur : %s)", e.JobKind, e.JobName, e.Trigger)
+    res, err := db.Exec(`INSERT INTO executions (job_kind, job_name, source, trigger, commit_id, started_at, status, agent)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?)`, e.JobKind, e.JobName, e.Source, e.Trigger, e.Commit, e.StartedAt, e.Status, e.Agent)
+    if err != nil {
+        logger.Log("ERROR", "Erreur lors de l'insertion de l'exécution pour %s %s : %v", e.JobKind, e.JobName, err)
+        return 0, err
+    }
+
+    e.ID, err = res.LastInsertId()
+    if err != nil {
+        return 0, err
+    }
+    return e.ID, nil
+}
 
-// Enregistrer une exécution dans la table executions
-func LogExecution(dbPath string, repoID int, commitID string) error {
+// Enregistrer la fin d'une exécution (code de sortie, statut, durée et sortie capturée)
+func FinishExecution(dbPath string, e *Execution) error {
     db, err := sql.Open("sqlite3", dbPath)
     if err != nil {
         logger.Log("ERROR", "Impossible d'ouvrir la base de données : %v", err)
@@ -213,16 +476,42 @@ func LogExecution(dbPath string, repoID int, commitID string) error {
     }
     defer db.Close()
 
-    logger.Log("INFO", "Insertion de l'exécution dans la base de données (repo_id: %d, commit_id: %s)", repoID, commitID)
-    _, err = db.Exec("INSERT INTO executions (repo_id, commit_id) VALUES (?, ?)", repoID, commitID)
+    var exitCode interface{}
+    if e.ExitCode != nil {
+        exitCode = *e.ExitCode
+    }
+    var recap interface{}
+    if e.Recap != nil {
+        data, err := json.Marshal(e.Recap)
+        if err != nil {
+            return err
+        }
+        recap = string(data)
+    }
+    _, err = db.Exec(`UPDATE executions SET finished_at = ?, duration_ms = ?, exit_code = ?, status = ?, output = ?, recap = ? WHERE id = ?`,
+        e.FinishedAt, e.DurationMs, exitCode, e.Status, e.Output, recap, e.ID)
     if err != nil {
-        logger.Log("ERROR", "Erreur lors de l'insertion de l'exécution pour le dépôt %d : %v", repoID, err)
+        logger.Log("ERROR", "Erreur lors de la mise à jour de l'exécution %d : %v", e.ID, err)
         return err
     }
 
-    logger.Log("INFO", "Exécution enregistrée avec succès pour le dépôt %d", repoID)
+    logger.Log("DEBUG", "Exécution %d enregistrée avec le statut %s", e.ID, e.Status)
     return nil
 }
+
+// Décoder le récapitulatif d'un playbook enregistré en JSON
+func decodeRecap(value sql.NullString) *PlaybookRecap {
+    if !value.Valid || value.String == "" {
+        return nil
+    }
+    var recap PlaybookRecap
+    if err := json.Unmarshal([]byte(value.String), &recap); err != nil {
+        logger.Log("ERROR", "Récapitulatif de playbook illisible : %v", err)
+        return nil
+    }
+    return &recap
+}
+
 // Vérifier si un flux existe déjà dans la base de données
 func FluxExists(dbPath, fluxName, url string) (bool, error) {
     db, err := sql.Open("sqlite3", dbPath)
@@ -292,7 +581,7 @@ func GetLastTag(dbPath, fluxName, url string) (string, error) {
     err = db.QueryRow("SELECT last_tag FROM flux WHERE flux_name = ? AND url = ?", fluxName, url).Scan(&lastTag)
     if err != nil {
         if err == sql.ErrNoRows {
-            logger.Log("INFO", "Aucun tag trouvé pour le flux %s et l'URL %s, il sera ajouté", fluxName, url)
+            logger.Log("DEBUG", "Aucun tag trouvé pour le flux %s et l'URL %s, il sera ajouté", fluxName, url)
             return "", nil // Aucun tag trouvé
         }
         logger.Log("ERROR", "Erreur lors de la récupération du dernier tag pour le flux %s et l'URL %s : %v", fluxName, url, err)
@@ -305,3 +594,458 @@ func GetLastTag(dbPath, fluxName, url string) (string, error) {
         return "", nil // Si le tag est NULL, on retourne une chaîne vide
     }
 }
+
+// Récupérer l'état d'une tâche (état vierge si la tâche n'a jamais échoué)
+func GetJobState(dbPath, kind, name string) (*JobState, error) {
+    db, err := sql.Open("sqlite3", dbPath)
+    if err != nil {
+        logger.Log("ERROR", "Impossible d'ouvrir la base de données : %v", err)
+        return nil, err
+    }
+    defer db.Close()
+
+    state := JobState{JobKind: kind, JobName: name}
+    var lastError, updatedAt sql.NullString
+    err = db.QueryRow("SELECT consecutive_failures, disabled, COALESCE(paused, 0), last_error, updated_at FROM job_state WHERE job_kind = ? AND job_name = ?", kind, name).
+        Scan(&state.ConsecutiveFailures, &state.Disabled, &state.Paused, &lastError, &updatedAt)
+    if err != nil && err != sql.ErrNoRows {
+        logger.Log("ERROR", "Erreur lors de la récupération de l'état de la tâche %s/%s : %v", kind, name, err)
+        return nil, err
+    }
+    state.LastError = lastError.String
+    state.UpdatedAt = updatedAt.String
+    return &state, nil
+}
+
+// Récupérer l'état de toutes les tâches connues
+func ListJobStates(dbPath string) ([]JobState, error) {
+    db, err := sql.Open("sqlite3", dbPath)
+    if err != nil {
+        logger.Log("ERROR", "Impossible d'ouvrir la base de données : %v", err)
+        return nil, err
+    }
+    defer db.Close()
+
+    rows, err := db.Query("SELECT job_kind, job_name, consecutive_failures, disabled, COALESCE(paused, 0), COALESCE(last_error, ''), COALESCE(updated_at, '') FROM job_state ORDER BY job_kind, job_name")
+    if err != nil {
+        logger.Log("ERROR", "Erreur lors de la récupération de l'état des tâches : %v", err)
+        return nil, err
+    }
+    defer rows.Close()
+
+    var states []JobState
+    for rows.Next() {
+        var state JobState
+        if err := rows.Scan(&state.JobKind, &state.JobName, &state.ConsecutiveFailures, &state.Disabled, &state.Paused, &state.LastError, &state.UpdatedAt); err != nil {
+            logger.Log("ERROR", "Erreur lors du scan des lignes : %v", err)
+            return nil, err
+        }
+        states = append(states, state)
+    }
+    return states, nil
+}
+
+// Enregistrer un échec de la tâche et renvoyer le nombre d'échecs consécutifs
+func RecordJobFailure(dbPath, kind, name, lastError string) (int, error) {
+    db, err := sql.Open("sqlite3", dbPath)
+    if err != nil {
+        logger.Log("ERROR", "Impossible d'ouvrir la base de données : %v", err)
+        return 0, err
+    }
+    defer db.Close()
+
+    _, err = db.Exec(`INSERT INTO job_state (job_kind, job_name, consecutive_failures, last_error, updated_at)
+        VALUES (?, ?, 1, ?, ?)
+        ON CONFLICT(job_kind, job_name) DO UPDATE SET consecutive_failures = consecutive_failures + 1, last_error = excluded.last_error, updated_at = excluded.updated_at`,
+        kind, name, lastError, time.Now().Format(time.RFC3339))
+    if err != nil {
+        logger.Log("ERROR", "Erreur lors de l'enregistrement de l'échec de la tâche %s/%s : %v", kind, name, err)
+        return 0, err
+    }
+
+    var failures int
+    err = db.QueryRow("SELECT consecutive_failures FROM job_state WHERE job_kind = ? AND job_name = ?", kind, name).Scan(&failures)
+    if err != nil {
+        return 0, err
+    }
+    return failures, nil
+}
+
+// Remettre à zéro le compteur d'échecs consécutifs après un succès
+func RecordJobSuccess(dbPath, kind, name string) error {
+    db, err := sql.Open("sqlite3", dbPath)
+    if err != nil {
+        logger.Log("ERROR", "Impossible d'ouvrir la base de données : %v", err)
+        return err
+    }
+    defer db.Close()
+
+    _, err = db.Exec("UPDATE job_state SET consecutive_failures = 0, last_error = NULL, updated_at = ? WHERE job_kind = ? AND job_name = ? AND consecutive_failures > 0",
+        time.Now().Format(time.RFC3339), kind, name)
+    if err != nil {
+        logger.Log("ERROR", "Erreur lors de la remise à zéro des échecs de la tâche %s/%s : %v", kind, name, err)
+        return err
+    }
+    return nil
+}
+
+// Désactiver ou réactiver une tâche ; la réactivation remet le compteur d'échecs à zéro
+func SetJobDisabled(dbPath, kind, name string, disabled bool) error {
+    db, err := sql.Open("sqlite3", dbPath)
+    if err != nil {
+        logger.Log("ERROR", "Impossible d'ouvrir la base de données : %v", err)
+        return err
+    }
+    defer db.Close()
+
+    query := `INSERT INTO job_state (job_kind, job_name, disabled, updated_at) VALUES (?, ?, ?, ?)
+        ON CONFLICT(job_kind, job_name) DO UPDATE SET disabled = excluded.disabled, updated_at = excluded.updated_at`
+    if !disabled {
+        query += ", consecutive_failures = 0"
+    }
+    _, err = db.Exec(query, kind, name, disabled, time.Now().Format(time.RFC3339))
+    if err != nil {
+        logger.Log("ERROR", "Erreur lors de la mise à jour de l'état de la tâche %s/%s : %v", kind, name, err)
+        return err
+    }
+    return nil
+}
+
+// Mettre en pause ou reprendre une tâche ; la pause survit aux redémarrages du service
+func SetJobPaused(dbPath, kind, name string, paused bool) error {
+    db, err := sql.Open("sqlite3", dbPath)
+    if err != nil {
+        logger.Log("ERROR", "Impossible d'ouvrir la base de données : %v", err)
+        return err
+    }
+    defer db.Close()
+
+    _, err = db.Exec(`INSERT INTO job_state (job_kind, job_name, paused, updated_at) VALUES (?, ?, ?, ?)
+        ON CONFLICT(job_kind, job_name) DO UPDATE SET paused = excluded.paused, updated_at = excluded.updated_at`,
+        kind, name, paused, time.Now().Format(time.RFC3339))
+    if err != nil {
+        logger.Log("ERROR", "Erreur lors de la mise à jour de la pause de la tâche %s/%s : %v", kind, name, err)
+        return err
+    }
+    return nil
+}
+
+// Agent inscrit auprès du serveur
+type Agent struct {
+    Name          string
+    TokenHash     string `json:"-"`
+    Labels        map[string]string
+    Facts         map[string]string // Faits à plat (HOSTNAME, OS_ID...)
+    EnrolledAt    string
+    LastSeen      string
+    ConfigVersion string // Version de la configuration appliquée
+    ConfigError   string // Erreur lors de l'application de la dernière configuration reçue
+}
+
+// Inscrire un nouvel agent ; false si un agent du même nom est déjà inscrit
+func EnrollAgent(dbPath string, a *Agent) (bool, error) {
+    db, err := sql.Open("sqlite3", dbPath)
+    if err != nil {
+        logger.Log("ERROR", "Impossible d'ouvrir la base de données : %v", err)
+        return false, err
+    }
+    defer db.Close()
+
+    labels, _ := json.Marshal(a.Labels)
+    facts, _ := json.Marshal(a.Facts)
+    res, err := db.Exec(`INSERT INTO agents (name, token_hash, labels, facts, enrolled_at, last_seen) VALUES (?, ?, ?, ?, ?, ?)
+        ON CONFLICT(name) DO NOTHING`,
+        a.Name, a.TokenHash, string(labels), string(facts), a.EnrolledAt, a.LastSeen)
+    if err != nil {
+        logger.Log("ERROR", "Erreur lors de l'inscription de l'agent %s : %v", a.Name, err)
+        return false, err
+    }
+    n, _ := res.RowsAffected()
+    return n > 0, nil
+}
+
+// Réinscrire un agent avec un nouveau token, à condition que son token actuel soit celui
+// d'empreinte previousHash ; false sinon
+func ReenrollAgent(dbPath string, a *Agent, previousHash string) (bool, error) {
+    db, err := sql.Open("sqlite3", dbPath)
+    if err != nil {
+        logger.Log("ERROR", "Impossible d'ouvrir la base de données : %v", err)
+        return false, err
+    }
+    defer db.Close()
+
+    labels, _ := json.Marshal(a.Labels)
+    facts, _ := json.Marshal(a.Facts)
+    res, err := db.Exec("UPDATE agents SET token_hash = ?, labels = ?, facts = ?, enrolled_at = ?, last_seen = ? WHERE name = ? AND token_hash = ?",
+        a.TokenHash, string(labels), string(facts), a.EnrolledAt, a.LastSeen, a.Name, previousHash)
+    if err != nil {
+        logger.Log("ERROR", "Erreur lors de la réinscription de l'agent %s : %v", a.Name, err)
+        return false, err
+    }
+    n, _ := res.RowsAffected()
+    return n > 0, nil
+}
+
+// Supprimer un agent : son token cesse de fonctionner et son nom peut être réinscrit
+// (false si l'agent est inconnu)
+func DeleteAgent(dbPath, name string) (bool, error) {
+    db, err := sql.Open("sqlite3", dbPath)
+    if err != nil {
+        logger.Log("ERROR", "Impossible d'ouvrir la base de données : %v", err)
+        return false, err
+    }
+    defer db.Close()
+
+    res, err := db.Exec("DELETE FROM agents WHERE name = ?", name)
+    if err != nil {
+        logger.Log("ERROR", "Erreur lors de la suppression de l'agent %s : %v", name, err)
+        return false, err
+    }
+    n, _ := res.RowsAffected()
+    return n > 0, nil
+}
+
+// Mettre à jour un agent à chaque interrogation : labels, faits et configuration appliquée
+func UpdateAgent(dbPath string, a *Agent) error {
+    db, err := sql.Open("sqlite3", dbPath)
+    if err != nil {
+        logger.Log("ERROR", "Impossible d'ouvrir la base de données : %v", err)
+        return err
+    }
+    defer db.Close()
+
+    labels, _ := json.Marshal(a.Labels)
+    facts, _ := json.Marshal(a.Facts)
+    _, err = db.Exec("UPDATE agents SET labels = ?, facts = ?, last_seen = ?, config_version = ?, config_error = ? WHERE name = ?",
+        string(labels), string(facts), a.LastSeen, a.ConfigVersion, a.ConfigError, a.Name)
+    if err != nil {
+        logger.Log("ERROR", "Erreur lors de la mise à jour de l'agent %s : %v", a.Name, err)
+        return err
+    }
+    return nil
+}
+
+// Retrouver un agent à partir de l'empreinte de son token (nil s'il est inconnu)
+func GetAgentByTokenHash(dbPath, tokenHash string) (*Agent, error) {
+    agents, err := queryAgents(dbPath, "WHERE token_hash = ?", tokenHash)
+    if err != nil || len(agents) == 0 {
+        return nil, err
+    }
+    return &agents[0], nil
+}
+
+// Lister les agents inscrits
+func ListAgents(dbPath string) ([]Agent, error) {
+    return queryAgents(dbPath, "ORDER BY name")
+}
+
+func queryAgents(dbPath, clause string, args ...interface{}) ([]Agent, error) {
+    db, err := sql.Open("sqlite3", dbPath)
+    if err != nil {
+        logger.Log("ERROR", "Impossible d'ouvrir la base de données : %v", err)
+        return nil, err
+    }
+    defer db.Close()
+
+    rows, err := db.Query(`SELECT name, COALESCE(token_hash, ''), COALESCE(labels, ''), COALESCE(facts, ''), COALESCE(enrolled_at, ''),
+        COALESCE(last_seen, ''), COALESCE(config_version, ''), COALESCE(config_error, '') FROM agents `+clause, args...)
+    if err != nil {
+        logger.Log("ERROR", "Erreur lors de la récupération des agents : %v", err)
+        return nil, err
+    }
+    defer rows.Close()
+
+    var agents []Agent
+    for rows.Next() {
+        var a Agent
+        var labels, facts string
+        if err := rows.Scan(&a.Name, &a.TokenHash, &labels, &facts, &a.EnrolledAt, &a.LastSeen, &a.ConfigVersion, &a.ConfigError); err != nil {
+            logger.Log("ERROR", "Erreur lors du scan des lignes : %v", err)
+            return nil, err
+        }
+        json.Unmarshal([]byte(labels), &a.Labels)
+        json.Unmarshal([]byte(facts), &a.Facts)
+        agents = append(agents, a)
+    }
+    return agents, nil
+}
+
+// Statut de la dernière exécution terminée d'une tâche avant l'exécution donnée
+// (les exécutions ignorées ou annulées ne comptent pas ; vide s'il n'y en a pas)
+func GetPreviousExecutionStatus(dbPath, kind, name, agent string, beforeID int64) (string, error) {
+    db, err := sql.Open("sqlite3", dbPath)
+    if err != nil {
+        logger.Log("ERROR", "Impossible d'ouvrir la base de données : %v", err)
+        return "", err
+    }
+    defer db.Close()
+
+    var status string
+    err = db.QueryRow(`SELECT status FROM executions
+        WHERE job_kind = ? AND job_name = ? AND COALESCE(agent, '') = ? AND id < ? AND status IN ('success', 'failed', 'timeout')
+        ORDER BY id DESC LIMIT 1`, kind, name, agent, beforeID).Scan(&status)
+    if err == sql.ErrNoRows {
+        return "", nil
+    }
+    if err != nil {
+        logger.Log("ERROR", "Erreur lors de la récupération de l'exécution précédente de %s/%s : %v", kind, name, err)
+        return "", err
+    }
+    return status, nil
+}
+
+// Date de fin de la dernière exécution réussie d'une tâche locale (vide s'il n'y en a pas)
+func GetLastSuccessTime(dbPath, kind, name string) (string, error) {
+    db, err := sql.Open("sqlite3", dbPath)
+    if err != nil {
+        logger.Log("ERROR", "Impossible d'ouvrir la base de données : %v", err)
+        return "", err
+    }
+    defer db.Close()
+
+    var finishedAt sql.NullString
+    err = db.QueryRow(`SELECT MAX(finished_at) FROM executions
+        WHERE job_kind = ? AND job_name = ? AND COALESCE(agent, '') = '' AND status = 'success'`, kind, name).Scan(&finishedAt)
+    if err != nil {
+        logger.Log("ERROR", "Erreur lors de la récupération de la dernière réussite de %s/%s : %v", kind, name, err)
+        return "", err
+    }
+    return finishedAt.String, nil
+}
+
+// Token nommé de l'API
+type APIToken struct {
+    Name       string
+    TokenHash  string `json:"-"`
+    Scopes     []string
+    CreatedAt  string
+    ExpiresAt  string // Vide : sans expiration
+    LastUsedAt string
+}
+
+// Enregistrer un nouveau token de l'API
+func CreateAPIToken(dbPath string, t *APIToken) error {
+    db, err := sql.Open("sqlite3", dbPath)
+    if err != nil {
+        logger.Log("ERROR", "Impossible d'ouvrir la base de données : %v", err)
+        return err
+    }
+    defer db.Close()
+
+    _, err = db.Exec("INSERT INTO api_tokens (name, token_hash, scopes, created_at, expires_at) VALUES (?, ?, ?, ?, ?)",
+        t.Name, t.TokenHash, strings.Join(t.Scopes, ","), t.CreatedAt, t.ExpiresAt)
+    if err != nil {
+        logger.Log("ERROR", "Erreur lors de la création du token %s : %v", t.Name, err)
+        return err
+    }
+    return nil
+}
+
+// Remplacer l'empreinte et l'expiration d'un token existant (false si le token est inconnu)
+func RotateAPIToken(dbPath, name, tokenHash, createdAt, expiresAt string) (bool, error) {
+    db, err := sql.Open("sqlite3", dbPath)
+    if err != nil {
+        logger.Log("ERROR", "Impossible d'ouvrir la base de données : %v", err)
+        return false, err
+    }
+    defer db.Close()
+
+    res, err := db.Exec("UPDATE api_tokens SET token_hash = ?, created_at = ?, expires_at = ?, last_used_at = NULL WHERE name = ?",
+        tokenHash, createdAt, expiresAt, name)
+    if err != nil {
+        logger.Log("ERROR", "Erreur lors de la rotation du token %s : %v", name, err)
+        return false, err
+    }
+    n, _ := res.RowsAffected()
+    return n > 0, nil
+}
+
+// Supprimer un token (false si le token est inconnu)
+func DeleteAPIToken(dbPath, name string) (bool, error) {
+    db, err := sql.Open("sqlite3", dbPath)
+    if err != nil {
+        logger.Log("ERROR", "Impossible d'ouvrir la base de données : %v", err)
+        return false, err
+    }
+    defer db.Close()
+
+    res, err := db.Exec("DELETE FROM api_tokens WHERE name = ?", name)
+    if err != nil {
+        logger.Log("ERROR", "Erreur lors de la révocation du token %s : %v", name, err)
+        return false, err
+    }
+    n, _ := res.RowsAffected()
+    return n > 0, nil
+}
+
+// Noter la date de dernière utilisation d'un token
+func TouchAPIToken(dbPath, name, lastUsedAt string) error {
+    db, err := sql.Open("sqlite3", dbPath)
+    if err != nil {
+        logger.Log("ERROR", "Impossible d'ouvrir la base de données : %v", err)
+        return err
+    }
+    defer db.Close()
+
+    _, err = db.Exec("UPDATE api_tokens SET last_used_at = ? WHERE name = ?", lastUsedAt, name)
+    if err != nil {
+        logger.Log("ERROR", "Erreur lors de la mise à jour du token %s : %v", name, err)
+        return err
+    }
+    return nil
+}
+
+// Retrouver un token à partir de son empreinte (nil s'il est inconnu)
+func GetAPITokenByHash(dbPath, tokenHash string) (*APIToken, error) {
+    tokens, err := queryAPITokens(dbPath, "WHERE token_hash = ?", tokenHash)
+    if err != nil || len(tokens) == 0 {
+        return nil, err
+    }
+    return &tokens[0], nil
+}
+
+// Retrouver un token par son nom (nil s'il est inconnu)
+func GetAPIToken(dbPath, name string) (*APIToken, error) {
+    tokens, err := queryAPITokens(dbPath, "WHERE name = ?", name)
+    if err != nil || len(tokens) == 0 {
+        return nil, err
+    }
+    return &tokens[0], nil
+}
+
+// Lister les tokens de l'API
+func ListAPITokens(dbPath string) ([]APIToken, error) {
+    return queryAPITokens(dbPath, "ORDER BY name")
+}
+
+func queryAPITokens(dbPath, clause string, args ...interface{}) ([]APIToken, error) {
+    db, err := sql.Open("sqlite3", dbPath)
+    if err != nil {
+        logger.Log("ERROR", "Impossible d'ouvrir la base de données : %v", err)
+        return nil, err
+    }
+    defer db.Close()
+
+    rows, err := db.Query(`SELECT name, COALESCE(token_hash, ''), COALESCE(scopes, ''), COALESCE(created_at, ''), COALESCE(expires_at, ''),
+        COALESCE(last_used_at, '') FROM api_tokens `+clause, args...)
+    if err != nil {
+        logger.Log("ERROR", "Erreur lors de la récupération des tokens : %v", err)
+        return nil, err
+    }
+    defer rows.Close()
+
+    var tokens []APIToken
+    for rows.Next() {
+        var t APIToken
+        var scopes string
+        if err := rows.Scan(&t.Name, &t.TokenHash, &scopes, &t.CreatedAt, &t.ExpiresAt, &t.LastUsedAt); err != nil {
+            logger.Log("ERROR", "Erreur lors du scan des lignes : %v", err)
+            return nil, err
+        }
+        if scopes != "" {
+            t.Scopes = strings.Split(scopes, ",")
+        }
+        tokens = append(tokens, t)
+    }
+    return tokens, nil
+}
@@ -0,0 +1,159 @@
+package endpoints
+
+import (
+    "encoding/json"
+    "net/http"
+    "strings"
+    "aidalinfo/ansible-lite/internal/config"
+    "aidalinfo/ansible-lite/internal/db"
+    "aidalinfo/ansible-lite/internal/fleet"
+    "aidalinfo/ansible-lite/internal/token"
+)
+
+// Taille maximale acceptée pour le corps d'une requête d'agent (sortie d'exécution comprise)
+const maxAgentBody = 8 << 20
+
+// Décoder le corps JSON d'une requête d'agent
+func decodeAgentRequest(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+    if r.Method != http.MethodPost {
+        http.Error(w, "Méthode non autorisée", http.StatusMethodNotAllowed)
+        return false
+    }
+    if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAgentBody)).Decode(v); err != nil {
+        http.Error(w, "Corps de la requête invalide", http.StatusBadRequest)
+        return false
+    }
+    return true
+}
+
+// Agent authentifié par son token (en-tête Authorization: Bearer), nil si la réponse a déjà été envoyée
+func authenticateAgent(w http.ResponseWriter, r *http.Request, cfg *config.GlobalConfig) *db.Agent {
+    agent, err := fleet.Authenticate(cfg, token.FromHeader(r.Header.Get("Authorization")))
+    if err == fleet.ErrUnauthorized {
+        http.Error(w, "Token d'agent invalide ou manquant", http.StatusUnauthorized)
+        return nil
+    }
+    if err != nil {
+        http.Error(w, "Erreur lors de l'authentification de l'agent", http.StatusInternalServerError)
+        return nil
+    }
+    return agent
+}
+
+// Handler pour l'inscription d'un agent avec le jeton d'inscription (POST /agents/enroll)
+func AgentEnrollHandler(w http.ResponseWriter, r *http.Request, cfg *config.GlobalConfig) {
+    var req fleet.EnrollRequest
+    if !decodeAgentRequest(w, r, &req) {
+        return
+    }
+
+    // Un agent déjà inscrit peut se réinscrire en présentant son token actuel
+    resp, err := fleet.Enroll(cfg, req, token.FromHeader(r.Header.Get("Authorization")))
+    if err == fleet.ErrUnauthorized {
+        http.Error(w, "Jeton d'inscription invalide", http.StatusUnauthorized)
+        return
+    }
+    if err == fleet.ErrAgentExists {
+        http.Error(w, "Un agent nommé "+req.Name+" est déjà inscrit : supprimez-le d'abord (alcli agents remove "+req.Name+")", http.StatusConflict)
+        return
+    }
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(resp)
+}
+
+// Handler pour l'interrogation longue d'un agent (POST /agents/poll) :
+// 200 avec sa nouvelle configuration, 204 si elle n'a pas changé
+func AgentPollHandler(w http.ResponseWriter, r *http.Request, cfg *config.GlobalConfig) {
+    var req fleet.PollRequest
+    if !decodeAgentRequest(w, r, &req) {
+        return
+    }
+    agent := authenticateAgent(w, r, cfg)
+    if agent == nil {
+        return
+    }
+
+    resp, err := fleet.Poll(r.Context(), cfg, agent, req)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusInternalServerError)
+        return
+    }
+    if resp == nil {
+        w.WriteHeader(http.StatusNoContent)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(resp)
+}
+
+// Handler pour la remontée d'une exécution terminée par un agent (POST /agents/executions)
+func AgentExecutionsHandler(w http.ResponseWriter, r *http.Request, cfg *config.GlobalConfig) {
+    var execution db.Execution
+    if !decodeAgentRequest(w, r, &execution) {
+        return
+    }
+    agent := authenticateAgent(w, r, cfg)
+    if agent == nil {
+        return
+    }
+
+    err := fleet.Report(cfg, agent, execution)
+    if err == fleet.ErrUnknownJob {
+        http.Error(w, "Tâche "+execution.JobKind+"/"+execution.JobName+" non distribuée à cet agent", http.StatusForbidden)
+        return
+    }
+    if err != nil {
+        http.Error(w, "Erreur lors de l'enregistrement de l'exécution", http.StatusInternalServerError)
+        return
+    }
+    w.WriteHeader(http.StatusNoContent)
+}
+
+// Handler pour lister les agents inscrits et leurs tâches (GET /agents)
+func AgentsHandler(w http.ResponseWriter, r *http.Request, cfg *config.GlobalConfig) {
+    agents, err := fleet.ListAgents(cfg)
+    if err != nil {
+        http.Error(w, "Erreur lors de la récupération des agents", http.StatusInternalServerError)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(agents)
+}
+
+// Handler pour agir sur un agent : POST /agents/{nom}/remove pour le supprimer (son token est révoqué)
+func AgentHandler(w http.ResponseWriter, r *http.Request, cfg *config.GlobalConfig) {
+    path := strings.TrimPrefix(r.URL.Path, "/agents/")
+    slash := strings.LastIndex(path, "/")
+    if slash <= 0 {
+        http.Error(w, "Action manquante", http.StatusNotFound)
+        return
+    }
+    name, action := path[:slash], path[slash+1:]
+
+    if r.Method != http.MethodPost {
+        http.Error(w, "Méthode non autorisée", http.StatusMethodNotAllowed)
+        return
+    }
+    if action != "remove" {
+        http.Error(w, "Action inconnue : "+action, http.StatusNotFound)
+        return
+    }
+
+    err := fleet.RemoveAgent(cfg, name)
+    if err == fleet.ErrUnknownAgent {
+        http.Error(w, "Agent inconnu : "+name, http.StatusNotFound)
+        return
+    }
+    if err != nil {
+        http.Error(w, "Erreur lors de la suppression de l'agent", http.StatusInternalServerError)
+        return
+    }
+    w.Write([]byte("Agent " + name + " supprimé"))
+}
@@ -0,0 +1,76 @@
+package endpoints
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"aidalinfo/ansible-lite/internal/config"
+	"aidalinfo/ansible-lite/internal/db"
+	"aidalinfo/ansible-lite/internal/fleet"
+	"aidalinfo/ansible-lite/internal/testutil"
+)
+
+// Le token d'un agent est accepté avec ou sans préfixe Bearer, à l'inscription comme pour
+// l'interrogation et la remontée des exécutions ; une exécution d'une tâche qui n'est pas
+// distribuée à l'agent est refusée
+func TestAgentRoutes(t *testing.T) {
+	cfg := testutil.Config(t)
+	cfg.Global.Type = config.TypeServer
+	cfg.Global.JoinToken = "jeton-d-inscription"
+	cfg.Global.ReposConfig = filepath.Join(t.TempDir(), "repos.yaml")
+	catalogue := "repos:\n  web:\n    url: https://github.com/org/web.git\n    watcher: \"@every 1h\"\n    branch: main\n    path: /srv/web\n    init: init.sh\n"
+	if err := ioutil.WriteFile(cfg.Global.ReposConfig, []byte(catalogue), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := fleet.LoadCatalogue(cfg); err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	InitRoutes(mux, cfg)
+
+	post := func(path, authorization string, body interface{}) *httptest.ResponseRecorder {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(data))
+		if authorization != "" {
+			r.Header.Set("Authorization", authorization)
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, r)
+		return rec
+	}
+
+	rec := post("/agents/enroll", "", fleet.EnrollRequest{Name: "web-01", JoinToken: cfg.Global.JoinToken})
+	var enrolled fleet.EnrollResponse
+	if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &enrolled) != nil {
+		t.Fatalf("inscription : code %d (%s)", rec.Code, rec.Body.String())
+	}
+
+	for _, authorization := range []string{"Bearer " + enrolled.Token, enrolled.Token} {
+		if rec := post("/agents/poll", authorization, fleet.PollRequest{}); rec.Code != http.StatusOK {
+			t.Errorf("interrogation avec %q : code %d (%s)", authorization, rec.Code, rec.Body.String())
+		}
+		if rec := post("/agents/executions", authorization, db.Execution{JobKind: "repo", JobName: "web"}); rec.Code != http.StatusNoContent {
+			t.Errorf("remontée avec %q : code %d (%s)", authorization, rec.Code, rec.Body.String())
+		}
+	}
+	if rec := post("/agents/executions", "Bearer inconnu", db.Execution{JobKind: "repo", JobName: "web"}); rec.Code != http.StatusUnauthorized {
+		t.Errorf("token inconnu : code %d, attendu 401", rec.Code)
+	}
+	if rec := post("/agents/executions", "Bearer "+enrolled.Token, db.Execution{JobKind: "repo", JobName: "db"}); rec.Code != http.StatusForbidden {
+		t.Errorf("tâche non distribuée : code %d, attendu 403", rec.Code)
+	}
+
+	// Réinscription avec le token actuel en Bearer
+	rec = post("/agents/enroll", "Bearer "+enrolled.Token, fleet.EnrollRequest{Name: "web-01", JoinToken: cfg.Global.JoinToken})
+	if rec.Code != http.StatusOK {
+		t.Errorf("réinscription : code %d (%s)", rec.Code, rec.Body.String())
+	}
+}
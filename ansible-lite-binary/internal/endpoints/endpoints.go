@@ -5,6 +5,7 @@ import (
     "net/http"
     "aidalinfo/ansible-lite/internal/config"
     "aidalinfo/ansible-lite/internal/middleware"
+    "aidalinfo/ansible-lite/internal/token"
 )
 
 // Handler pour l'endpoint /status
@@ -18,4 +19,52 @@ func InitRoutes(mux *http.ServeMux, cfg *config.GlobalConfig) {
     mux.Handle("/executions", middleware.ValidateToken(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
         ExecutionDetailsHandler(w, r, cfg)
     }), cfg))
+    mux.Handle("/executions/", middleware.ValidateToken(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        ExecutionHandler(w, r, cfg)
+    }), cfg))
+    mux.Handle("/jobs", middleware.ValidateToken(http.HandlerFunc(JobsHandler), cfg))
+    mux.Handle("/jobs/", middleware.RequireScopeFunc(http.HandlerFunc(JobHandler), cfg, jobActionScope))
+    mux.Handle("/facts", middleware.ValidateToken(http.HandlerFunc(FactsHandler), cfg))
+
+    // Recharger la configuration, changer le niveau de log et gérer les tokens nécessitent le droit admin
+    mux.Handle("/reload", middleware.RequireScope(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        ReloadHandler(w, r, cfg)
+    }), cfg, token.ScopeAdmin))
+    logLevelRead := middleware.ValidateToken(http.HandlerFunc(LogLevelHandler), cfg)
+    logLevelWrite := middleware.RequireScope(http.HandlerFunc(LogLevelHandler), cfg, token.ScopeAdmin)
+    mux.HandleFunc("/log-level", func(w http.ResponseWriter, r *http.Request) {
+        if r.Method == http.MethodGet {
+            logLevelRead.ServeHTTP(w, r)
+        } else {
+            logLevelWrite.ServeHTTP(w, r)
+        }
+    })
+    mux.Handle("/tokens", middleware.RequireScope(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        TokensHandler(w, r, cfg)
+    }), cfg, token.ScopeAdmin))
+    mux.Handle("/tokens/", middleware.RequireScope(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        TokenHandler(w, r, cfg)
+    }), cfg, token.ScopeAdmin))
+
+    // Les webhooks sont authentifiés par leur signature et non par le token d'API
+    mux.HandleFunc("/hooks/", HooksHandler)
+
+    // Mode serveur : inscription et interrogation des agents, authentifiés par leur propre token
+    if cfg.Global.Type == config.TypeServer {
+        mux.Handle("/agents", middleware.ValidateToken(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            AgentsHandler(w, r, cfg)
+        }), cfg))
+        mux.Handle("/agents/", middleware.RequireScope(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            AgentHandler(w, r, cfg)
+        }), cfg, token.ScopeAdmin))
+        mux.HandleFunc("/agents/enroll", func(w http.ResponseWriter, r *http.Request) {
+            AgentEnrollHandler(w, r, cfg)
+        })
+        mux.HandleFunc("/agents/poll", func(w http.ResponseWriter, r *http.Request) {
+            AgentPollHandler(w, r, cfg)
+        })
+        mux.HandleFunc("/agents/executions", func(w http.ResponseWriter, r *http.Request) {
+            AgentExecutionsHandler(w, r, cfg)
+        })
+    }
 }
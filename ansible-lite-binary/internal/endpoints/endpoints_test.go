@@ -0,0 +1,89 @@
+package endpoints
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"aidalinfo/ansible-lite/internal/config"
+	"aidalinfo/ansible-lite/internal/testutil"
+	"aidalinfo/ansible-lite/internal/token"
+)
+
+// Droit minimal de chaque route : un token d'un droit inférieur est refusé avec 403, les autres
+// atteignent le handler (qui peut répondre 400 ou 404 faute de tâche, d'exécution ou de paramètre)
+func TestRouteScopes(t *testing.T) {
+	for _, mode := range []string{config.TypeClient, config.TypeServer} {
+		t.Run(mode, func(t *testing.T) {
+			cfg := testutil.Config(t)
+			cfg.Global.Type = mode
+			mux := http.NewServeMux()
+			InitRoutes(mux, cfg)
+
+			tokens := map[string]string{}
+			for _, scope := range []string{token.ScopeRead, token.ScopeTrigger, token.ScopeAdmin} {
+				secret, _, err := token.Create(cfg, scope, []string{scope}, 0)
+				if err != nil {
+					t.Fatal(err)
+				}
+				tokens[scope] = secret
+			}
+
+			routes := []struct {
+				method string
+				path   string
+				scope  string
+			}{
+				{http.MethodGet, "/status", token.ScopeRead},
+				{http.MethodGet, "/executions", token.ScopeRead},
+				{http.MethodGet, "/executions/1", token.ScopeRead},
+				{http.MethodPost, "/executions/1/cancel", token.ScopeTrigger},
+				{http.MethodGet, "/jobs", token.ScopeRead},
+				{http.MethodPost, "/jobs/inconnu/run", token.ScopeTrigger},
+				{http.MethodPost, "/jobs/repo/inconnu/run", token.ScopeTrigger},
+				{http.MethodPost, "/jobs/inconnu/enable", token.ScopeAdmin},
+				{http.MethodPost, "/jobs/inconnu/pause", token.ScopeAdmin},
+				{http.MethodPost, "/jobs/repo/inconnu/resume", token.ScopeAdmin},
+				{http.MethodPost, "/reload", token.ScopeAdmin},
+				{http.MethodGet, "/facts", token.ScopeRead},
+				{http.MethodGet, "/log-level", token.ScopeRead},
+				{http.MethodPost, "/log-level", token.ScopeAdmin},
+				{http.MethodGet, "/tokens", token.ScopeAdmin},
+				{http.MethodPost, "/tokens", token.ScopeAdmin},
+				{http.MethodPost, "/tokens/inconnu/revoke", token.ScopeAdmin},
+			}
+			if mode == config.TypeServer {
+				routes = append(routes, []struct {
+					method string
+					path   string
+					scope  string
+				}{
+					{http.MethodGet, "/agents", token.ScopeRead},
+					{http.MethodPost, "/agents/inconnu/remove", token.ScopeAdmin},
+				}...)
+			}
+
+			rank := map[string]int{token.ScopeRead: 1, token.ScopeTrigger: 2, token.ScopeAdmin: 3}
+			for _, route := range routes {
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, httptest.NewRequest(route.method, route.path, nil))
+				if rec.Code != http.StatusUnauthorized {
+					t.Errorf("%s %s sans token : code %d, attendu 401", route.method, route.path, rec.Code)
+				}
+
+				for scope, secret := range tokens {
+					r := httptest.NewRequest(route.method, route.path, nil)
+					r.Header.Set("Authorization", "Bearer "+secret)
+					rec := httptest.NewRecorder()
+					mux.ServeHTTP(rec, r)
+
+					denied := rec.Code == http.StatusUnauthorized || rec.Code == http.StatusForbidden
+					if want := rank[scope] < rank[route.scope]; denied != want {
+						t.Errorf("%s %s avec le droit %s : code %d (%s), droit %s requis",
+							route.method, route.path, scope, rec.Code, rec.Body.String(), route.scope)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,25 @@
+package endpoints
+
+import (
+    "encoding/json"
+    "net/http"
+    "aidalinfo/ansible-lite/internal/facts"
+)
+
+// Handler pour les faits de la machine (GET /facts, ?refresh=true pour les collecter à nouveau)
+func FactsHandler(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        http.Error(w, "Méthode non autorisée", http.StatusMethodNotAllowed)
+        return
+    }
+
+    var f *facts.Facts
+    if r.URL.Query().Get("refresh") == "true" {
+        f = facts.Refresh()
+    } else {
+        f = facts.Get()
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(f)
+}
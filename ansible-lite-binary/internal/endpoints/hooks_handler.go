@@ -0,0 +1,44 @@
+package endpoints
+
+import (
+    "encoding/json"
+    "io/ioutil"
+    "net/http"
+    "strings"
+    "aidalinfo/ansible-lite/internal/repos"
+)
+
+// Taille maximale acceptée pour le corps d'un webhook
+const maxWebhookBody = 5 << 20
+
+// Handler pour les webhooks des forges (POST /hooks/{github|gitlab|gitea|forgejo|bitbucket}).
+// Pas de token d'API : l'authenticité est vérifiée par le webhook_secret des tâches.
+func HooksHandler(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost {
+        http.Error(w, "Méthode non autorisée", http.StatusMethodNotAllowed)
+        return
+    }
+    providerName := strings.Trim(strings.TrimPrefix(r.URL.Path, "/hooks/"), "/")
+
+    body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBody))
+    if err != nil {
+        http.Error(w, "Corps de la requête invalide", http.StatusBadRequest)
+        return
+    }
+
+    triggered, err := repos.HandleWebhook(providerName, r.Header, body)
+    if err == repos.ErrInvalidSignature {
+        http.Error(w, err.Error(), http.StatusUnauthorized)
+        return
+    }
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    if len(triggered) > 0 {
+        w.WriteHeader(http.StatusAccepted)
+    }
+    json.NewEncoder(w).Encode(map[string][]string{"triggered": triggered})
+}
@@ -0,0 +1,106 @@
+package endpoints
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/http"
+    "path"
+    "strings"
+    "aidalinfo/ansible-lite/internal/config"
+    "aidalinfo/ansible-lite/internal/fleet"
+    "aidalinfo/ansible-lite/internal/middleware"
+    "aidalinfo/ansible-lite/internal/repos"
+    "aidalinfo/ansible-lite/internal/token"
+)
+
+// Handler pour recharger repos.yaml sans redémarrer le service (POST /reload)
+func ReloadHandler(w http.ResponseWriter, r *http.Request, cfg *config.GlobalConfig) {
+    if r.Method != http.MethodPost {
+        http.Error(w, "Méthode non autorisée", http.StatusMethodNotAllowed)
+        return
+    }
+
+    reload := repos.ReloadReposConfig
+    if cfg.Global.Type == config.TypeServer {
+        reload = fleet.ReloadCatalogue
+    }
+    result, err := reload(cfg)
+    if err != nil {
+        http.Error(w, "Rechargement refusé, la configuration actuelle est conservée : "+err.Error(), http.StatusBadRequest)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(result)
+}
+
+// Handler pour lister les tâches planifiées avec leur état (/jobs)
+func JobsHandler(w http.ResponseWriter, r *http.Request) {
+    jobs, err := repos.ListJobs()
+    if err != nil {
+        http.Error(w, "Erreur lors de la récupération de l'état des tâches", http.StatusInternalServerError)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(jobs)
+}
+
+// Droit nécessaire pour une action sur une tâche : lancer une exécution (run) demande trigger,
+// changer l'état de la tâche (enable, pause, resume) demande admin
+func jobActionScope(r *http.Request) string {
+    switch path.Base(r.URL.Path) {
+    case "enable", "pause", "resume":
+        return token.ScopeAdmin
+    }
+    return middleware.MethodScope(r)
+}
+
+// Handler pour agir sur une tâche : POST /jobs/{nom}/{action} ou /jobs/{kind}/{nom}/{action}
+// avec action parmi enable, run (?force=true), pause et resume
+func JobHandler(w http.ResponseWriter, r *http.Request) {
+    path := strings.TrimPrefix(r.URL.Path, "/jobs/")
+    slash := strings.LastIndex(path, "/")
+    if slash <= 0 {
+        http.Error(w, "Action manquante", http.StatusNotFound)
+        return
+    }
+    ref, action := path[:slash], path[slash+1:]
+
+    if r.Method != http.MethodPost {
+        http.Error(w, "Méthode non autorisée", http.StatusMethodNotAllowed)
+        return
+    }
+
+    var err error
+    var message string
+    switch action {
+    case "enable":
+        err = repos.EnableJob(ref)
+        message = "Tâche %s réactivée"
+    case "run":
+        err = repos.RunJob(ref, r.URL.Query().Get("force") == "true")
+        message = "Exécution de la tâche %s demandée"
+    case "pause":
+        err = repos.PauseJob(ref)
+        message = "Tâche %s mise en pause"
+    case "resume":
+        err = repos.ResumeJob(ref)
+        message = "Tâche %s reprise"
+    default:
+        http.Error(w, "Action inconnue : "+action, http.StatusNotFound)
+        return
+    }
+
+    if errors.Is(err, repos.ErrUnknownJob) {
+        http.Error(w, err.Error(), http.StatusNotFound)
+        return
+    }
+    if err != nil {
+        // Tâche ambiguë, désactivée, en pause ou déjà en cours
+        http.Error(w, err.Error(), http.StatusConflict)
+        return
+    }
+    fmt.Fprintf(w, message, ref)
+}
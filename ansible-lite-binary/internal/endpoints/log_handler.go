@@ -0,0 +1,42 @@
+package endpoints
+
+import (
+    "encoding/json"
+    "net/http"
+    "time"
+    "aidalinfo/ansible-lite/internal/logger"
+)
+
+// Handler pour le niveau de log : GET /log-level pour le consulter, POST /log-level?level=debug
+// pour le changer, &duration=15m pour rétablir le niveau de config.yaml après ce délai
+func LogLevelHandler(w http.ResponseWriter, r *http.Request) {
+    switch r.Method {
+    case http.MethodGet:
+    case http.MethodPost:
+        level, err := logger.ParseLevel(r.URL.Query().Get("level"))
+        if err != nil || r.URL.Query().Get("level") == "" {
+            http.Error(w, "Paramètre level invalide : debug, info, warn ou error", http.StatusBadRequest)
+            return
+        }
+        var duration time.Duration
+        if value := r.URL.Query().Get("duration"); value != "" {
+            duration, err = time.ParseDuration(value)
+            if err != nil || duration < 0 {
+                http.Error(w, "Paramètre duration invalide (exemples : 90s, 15m, 1h)", http.StatusBadRequest)
+                return
+            }
+        }
+        logger.SetLevel(level, duration)
+        if duration > 0 {
+            logger.Log("WARN", "Niveau de log passé à %s pour %s via l'API", level, duration)
+        } else {
+            logger.Log("WARN", "Niveau de log passé à %s via l'API", level)
+        }
+    default:
+        http.Error(w, "Méthode non autorisée", http.StatusMethodNotAllowed)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(logger.CurrentLevel())
+}
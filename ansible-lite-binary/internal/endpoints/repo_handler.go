@@ -2,9 +2,13 @@ package endpoints
 
 import (
     "encoding/json"
+    "fmt"
     "net/http"
+    "strconv"
+    "strings"
     "aidalinfo/ansible-lite/internal/config"
     "aidalinfo/ansible-lite/internal/db"
+    "aidalinfo/ansible-lite/internal/repos"
 )
 
 // Handler pour récupérer les détails des exécutions avec nom et URL du dépôt
@@ -20,3 +24,41 @@ func ExecutionDetailsHandler(w http.ResponseWriter, r *http.Request, cfg *config
     w.Header().Set("Content-Type", "application/json")
     json.NewEncoder(w).Encode(executionDetails)
 }
+
+// Handler pour récupérer une exécution complète, sortie du script comprise (/executions/{id}),
+// ou l'annuler si elle est en cours (POST /executions/{id}/cancel)
+func ExecutionHandler(w http.ResponseWriter, r *http.Request, cfg *config.GlobalConfig) {
+    path := strings.TrimPrefix(r.URL.Path, "/executions/")
+    cancel := strings.HasSuffix(path, "/cancel")
+    id, err := strconv.ParseInt(strings.TrimSuffix(path, "/cancel"), 10, 64)
+    if err != nil {
+        http.Error(w, "ID d'exécution invalide", http.StatusBadRequest)
+        return
+    }
+
+    if cancel {
+        if r.Method != http.MethodPost {
+            http.Error(w, "Méthode non autorisée", http.StatusMethodNotAllowed)
+            return
+        }
+        if err := repos.CancelExecution(id); err != nil {
+            http.Error(w, err.Error(), http.StatusNotFound)
+            return
+        }
+        fmt.Fprintf(w, "Annulation de l'exécution %d demandée", id)
+        return
+    }
+
+    execution, err := db.GetExecution(cfg.Global.DBPath, id)
+    if err != nil {
+        http.Error(w, "Erreur lors de la récupération de l'exécution", http.StatusInternalServerError)
+        return
+    }
+    if execution == nil {
+        http.Error(w, "Exécution introuvable", http.StatusNotFound)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(execution)
+}
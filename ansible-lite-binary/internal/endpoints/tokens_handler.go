@@ -0,0 +1,108 @@
+package endpoints
+
+import (
+    "encoding/json"
+    "net/http"
+    "strings"
+    "aidalinfo/ansible-lite/internal/config"
+    "aidalinfo/ansible-lite/internal/db"
+    "aidalinfo/ansible-lite/internal/token"
+)
+
+// Token créé ou renouvelé : le token en clair n'est communiqué qu'une fois
+type tokenResponse struct {
+    db.APIToken
+    Token string
+}
+
+func writeTokenResponse(w http.ResponseWriter, secret string, t *db.APIToken) {
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(tokenResponse{APIToken: *t, Token: secret})
+}
+
+// Handler pour les tokens de l'API : GET /tokens pour les lister (sans les tokens en clair),
+// POST /tokens?name=ci&scopes=read,trigger&expires=90d pour en créer un
+func TokensHandler(w http.ResponseWriter, r *http.Request, cfg *config.GlobalConfig) {
+    switch r.Method {
+    case http.MethodGet:
+        tokens, err := db.ListAPITokens(cfg.Global.DBPath)
+        if err != nil {
+            http.Error(w, "Erreur lors de la récupération des tokens", http.StatusInternalServerError)
+            return
+        }
+        if tokens == nil {
+            tokens = []db.APIToken{}
+        }
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(tokens)
+    case http.MethodPost:
+        query := r.URL.Query()
+        scopes, err := token.ParseScopes(query.Get("scopes"))
+        if err != nil {
+            http.Error(w, err.Error(), http.StatusBadRequest)
+            return
+        }
+        ttl, err := token.ParseTTL(query.Get("expires"))
+        if err != nil {
+            http.Error(w, err.Error(), http.StatusBadRequest)
+            return
+        }
+        secret, t, err := token.Create(cfg, query.Get("name"), scopes, ttl)
+        if err != nil {
+            http.Error(w, err.Error(), http.StatusBadRequest)
+            return
+        }
+        writeTokenResponse(w, secret, t)
+    default:
+        http.Error(w, "Méthode non autorisée", http.StatusMethodNotAllowed)
+    }
+}
+
+// Handler pour agir sur un token : POST /tokens/{nom}/revoke ou /tokens/{nom}/rotate (?expires=90d,
+// validité initiale par défaut)
+func TokenHandler(w http.ResponseWriter, r *http.Request, cfg *config.GlobalConfig) {
+    path := strings.TrimPrefix(r.URL.Path, "/tokens/")
+    slash := strings.LastIndex(path, "/")
+    if slash <= 0 {
+        http.Error(w, "Action manquante", http.StatusNotFound)
+        return
+    }
+    name, action := path[:slash], path[slash+1:]
+
+    if r.Method != http.MethodPost {
+        http.Error(w, "Méthode non autorisée", http.StatusMethodNotAllowed)
+        return
+    }
+
+    switch action {
+    case "revoke":
+        err := token.Revoke(cfg, name)
+        if err == token.ErrUnknown {
+            http.Error(w, "Token inconnu : "+name, http.StatusNotFound)
+            return
+        }
+        if err != nil {
+            http.Error(w, "Erreur lors de la révocation du token", http.StatusInternalServerError)
+            return
+        }
+        w.Write([]byte("Token " + name + " révoqué"))
+    case "rotate":
+        ttl, err := token.ParseTTL(r.URL.Query().Get("expires"))
+        if err != nil {
+            http.Error(w, err.Error(), http.StatusBadRequest)
+            return
+        }
+        secret, t, err := token.Rotate(cfg, name, ttl)
+        if err == token.ErrUnknown {
+            http.Error(w, "Token inconnu : "+name, http.StatusNotFound)
+            return
+        }
+        if err != nil {
+            http.Error(w, "Erreur lors de la rotation du token", http.StatusInternalServerError)
+            return
+        }
+        writeTokenResponse(w, secret, t)
+    default:
+        http.Error(w, "Action inconnue : "+action, http.StatusNotFound)
+    }
+}
@@ -0,0 +1,112 @@
+package facts
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"aidalinfo/ansible-lite/internal/config"
+	"aidalinfo/ansible-lite/internal/logger"
+)
+
+// Intervalle de rafraîchissement par défaut des faits
+const defaultRefreshInterval = 5 * time.Minute
+
+// Nom du fichier JSON des faits, écrit à côté de la base de données
+const fileName = "facts.json"
+
+var (
+	mu       sync.RWMutex
+	current  *Facts
+	static   map[string]string
+	labels   map[string]string
+	filePath string
+	interval = defaultRefreshInterval
+)
+
+// Appliquer la configuration des faits (faits statiques, labels, intervalle) et faire une première collecte
+func Configure(cfg *config.GlobalConfig) error {
+	refresh := defaultRefreshInterval
+	if cfg.Global.FactsRefresh != "" {
+		d, err := time.ParseDuration(cfg.Global.FactsRefresh)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("facts_refresh invalide : %s", cfg.Global.FactsRefresh)
+		}
+		refresh = d
+	}
+
+	mu.Lock()
+	static = cfg.Global.Facts
+	labels = cfg.Global.Labels
+	filePath = filepath.Join(filepath.Dir(cfg.Global.DBPath), fileName)
+	interval = refresh
+	mu.Unlock()
+
+	Refresh()
+	return nil
+}
+
+// Rafraîchir périodiquement les faits en cache
+func Watch() {
+	for {
+		mu.RLock()
+		wait := interval
+		mu.RUnlock()
+		time.Sleep(wait)
+		Refresh()
+	}
+}
+
+// Collecter à nouveau les faits, les mettre en cache et réécrire le fichier JSON
+func Refresh() *Facts {
+	f := Collect()
+
+	mu.Lock()
+	f.Static = static
+	f.Labels = labels
+	current = f
+	path := filePath
+	mu.Unlock()
+
+	if path != "" {
+		if err := writeFile(path, f); err != nil {
+			logger.Log("ERROR", "Impossible d'écrire le fichier des faits %s : %v", path, err)
+		}
+	}
+	return f
+}
+
+// Faits en cache, collectés au premier appel si nécessaire
+func Get() *Facts {
+	mu.RLock()
+	f := current
+	mu.RUnlock()
+	if f == nil {
+		return Refresh()
+	}
+	return f
+}
+
+// Chemin du fichier JSON des faits transmis aux scripts (vide avant Configure)
+func File() string {
+	mu.RLock()
+	defer mu.RUnlock()
+	return filePath
+}
+
+// Écrire le fichier de façon atomique pour qu'un script ne lise jamais un fichier partiel
+func writeFile(path string, f *Facts) error {
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,357 @@
+package facts
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Informations de /etc/os-release
+type OSRelease struct {
+	ID         string `json:"id"`
+	IDLike     string `json:"id_like,omitempty"`
+	Name       string `json:"name"`
+	Version    string `json:"version,omitempty"`
+	VersionID  string `json:"version_id,omitempty"`
+	PrettyName string `json:"pretty_name,omitempty"`
+}
+
+// Interface réseau et ses adresses (CIDR)
+type Interface struct {
+	Name      string   `json:"name"`
+	MAC       string   `json:"mac,omitempty"`
+	Up        bool     `json:"up"`
+	Addresses []string `json:"addresses,omitempty"`
+}
+
+// Disque physique vu dans /sys/block
+type Disk struct {
+	Name       string `json:"name"`
+	SizeBytes  uint64 `json:"size_bytes"`
+	Rotational bool   `json:"rotational"`
+	Model      string `json:"model,omitempty"`
+}
+
+// Système de fichiers monté et son occupation
+type Filesystem struct {
+	Device     string `json:"device"`
+	Mountpoint string `json:"mountpoint"`
+	Type       string `json:"type"`
+	TotalBytes uint64 `json:"total_bytes"`
+	FreeBytes  uint64 `json:"free_bytes"`
+}
+
+// Faits de la machine : collectés sur le système, complétés par les faits statiques et labels de config.yaml
+type Facts struct {
+	Hostname       string            `json:"hostname"`
+	OS             OSRelease         `json:"os"`
+	Kernel         string            `json:"kernel"`
+	Arch           string            `json:"arch"`
+	CPUs           int               `json:"cpus"`
+	CPUModel       string            `json:"cpu_model,omitempty"`
+	MemoryBytes    uint64            `json:"memory_bytes"`
+	SwapBytes      uint64            `json:"swap_bytes"`
+	UptimeSeconds  int64             `json:"uptime_seconds"`
+	Vendor         string            `json:"vendor,omitempty"`
+	Product        string            `json:"product,omitempty"`
+	IPv4           string            `json:"ipv4,omitempty"` // Adresse de l'interface de la route par défaut
+	IPv6           string            `json:"ipv6,omitempty"`
+	Interfaces     []Interface       `json:"interfaces"`
+	Disks          []Disk            `json:"disks"`
+	Filesystems    []Filesystem      `json:"filesystems"`
+	PackageManager string            `json:"package_manager,omitempty"`
+	Static         map[string]string `json:"static,omitempty"`
+	Labels         map[string]string `json:"labels,omitempty"`
+	CollectedAt    string            `json:"collected_at"`
+}
+
+// Gestionnaires de paquets reconnus, dans l'ordre de préférence
+var packageManagers = []struct{ name, binary string }{
+	{"apt", "apt-get"},
+	{"dnf", "dnf"},
+	{"yum", "yum"},
+	{"zypper", "zypper"},
+	{"apk", "apk"},
+	{"pacman", "pacman"},
+}
+
+// Systèmes de fichiers virtuels ignorés
+var pseudoFilesystems = map[string]bool{
+	"proc": true, "sysfs": true, "devtmpfs": true, "devpts": true, "tmpfs": true, "cgroup": true,
+	"cgroup2": true, "pstore": true, "securityfs": true, "debugfs": true, "tracefs": true, "mqueue": true,
+	"hugetlbfs": true, "configfs": true, "fusectl": true, "bpf": true, "autofs": true, "binfmt_misc": true,
+	"overlay": true, "nsfs": true, "squashfs": true, "ramfs": true, "rpc_pipefs": true,
+}
+
+// Collecter les faits de la machine ; une source illisible laisse simplement ses champs vides
+func Collect() *Facts {
+	f := &Facts{
+		Kernel:      readTrimmed("/proc/sys/kernel/osrelease"),
+		Arch:        machine(),
+		CPUs:        runtime.NumCPU(),
+		CollectedAt: time.Now().Format(time.RFC3339),
+	}
+	f.Hostname, _ = os.Hostname()
+
+	if values := readKeyValues("/etc/os-release", "="); values != nil {
+		f.OS = OSRelease{
+			ID:         values["ID"],
+			IDLike:     values["ID_LIKE"],
+			Name:       values["NAME"],
+			Version:    values["VERSION"],
+			VersionID:  values["VERSION_ID"],
+			PrettyName: values["PRETTY_NAME"],
+		}
+	}
+
+	if cpuinfo := readKeyValues("/proc/cpuinfo", ":"); cpuinfo != nil {
+		f.CPUModel = cpuinfo["model name"]
+	}
+	if meminfo := readKeyValues("/proc/meminfo", ":"); meminfo != nil {
+		f.MemoryBytes = parseKB(meminfo["MemTotal"])
+		f.SwapBytes = parseKB(meminfo["SwapTotal"])
+	}
+	if uptime, err := ioutil.ReadFile("/proc/uptime"); err == nil {
+		if fields := strings.Fields(string(uptime)); len(fields) > 0 {
+			seconds, _ := strconv.ParseFloat(fields[0], 64)
+			f.UptimeSeconds = int64(seconds)
+		}
+	}
+	f.Vendor = readTrimmed("/sys/class/dmi/id/sys_vendor")
+	f.Product = readTrimmed("/sys/class/dmi/id/product_name")
+
+	f.Interfaces = interfaces()
+	f.IPv4, f.IPv6 = primaryAddresses(f.Interfaces)
+	f.Disks = disks()
+	f.Filesystems = filesystems()
+
+	for _, pm := range packageManagers {
+		if _, err := exec.LookPath(pm.binary); err == nil {
+			f.PackageManager = pm.name
+			break
+		}
+	}
+	return f
+}
+
+// Lire un fichier "clé<sep>valeur" ; la première occurrence d'une clé est conservée
+func readKeyValues(path, sep string) map[string]string {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, sep, 2)
+		if len(parts) != 2 {
+			continue
+		}
+		key := strings.TrimSpace(parts[0])
+		if _, ok := values[key]; !ok {
+			values[key] = strings.Trim(strings.TrimSpace(parts[1]), `"'`)
+		}
+	}
+	return values
+}
+
+// Contenu d'un petit fichier sans espaces autour
+func readTrimmed(path string) string {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// Valeur "1234 kB" de /proc/meminfo en octets
+func parseKB(value string) uint64 {
+	n, _ := strconv.ParseUint(strings.TrimSpace(strings.TrimSuffix(value, "kB")), 10, 64)
+	return n * 1024
+}
+
+// Architecture sous le nom donné par uname -m
+func machine() string {
+	switch runtime.GOARCH {
+	case "amd64":
+		return "x86_64"
+	case "arm64":
+		return "aarch64"
+	case "386":
+		return "i686"
+	}
+	return runtime.GOARCH
+}
+
+// Interfaces réseau, boucle locale comprise
+func interfaces() []Interface {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil
+	}
+	result := make([]Interface, 0, len(ifaces))
+	for _, iface := range ifaces {
+		i := Interface{Name: iface.Name, MAC: iface.HardwareAddr.String(), Up: iface.Flags&net.FlagUp != 0}
+		if addrs, err := iface.Addrs(); err == nil {
+			for _, addr := range addrs {
+				i.Addresses = append(i.Addresses, addr.String())
+			}
+		}
+		result = append(result, i)
+	}
+	return result
+}
+
+// Adresses principales : celles de l'interface de la route par défaut, sinon la première adresse globale
+func primaryAddresses(ifaces []Interface) (string, string) {
+	defaultIface := ""
+	if routes, err := ioutil.ReadFile("/proc/net/route"); err == nil {
+		for _, line := range strings.Split(string(routes), "\n")[1:] {
+			fields := strings.Fields(line)
+			if len(fields) > 1 && fields[1] == "00000000" {
+				defaultIface = fields[0]
+				break
+			}
+		}
+	}
+
+	var ipv4, ipv6 string
+	pick := func(onlyDefault bool) {
+		for _, iface := range ifaces {
+			if !iface.Up || (onlyDefault && iface.Name != defaultIface) {
+				continue
+			}
+			for _, addr := range iface.Addresses {
+				ip, _, err := net.ParseCIDR(addr)
+				if err != nil || !ip.IsGlobalUnicast() {
+					continue
+				}
+				if ip.To4() != nil && ipv4 == "" {
+					ipv4 = ip.String()
+				} else if ip.To4() == nil && ipv6 == "" {
+					ipv6 = ip.String()
+				}
+			}
+		}
+	}
+	if defaultIface != "" {
+		pick(true)
+	}
+	pick(false)
+	return ipv4, ipv6
+}
+
+// Disques de /sys/block, hors périphériques virtuels (loop, ram...)
+func disks() []Disk {
+	entries, err := ioutil.ReadDir("/sys/block")
+	if err != nil {
+		return nil
+	}
+	var result []Disk
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, "loop") || strings.HasPrefix(name, "ram") || strings.HasPrefix(name, "zram") {
+			continue
+		}
+		dir := filepath.Join("/sys/block", name)
+		sectors, _ := strconv.ParseUint(readTrimmed(filepath.Join(dir, "size")), 10, 64)
+		result = append(result, Disk{
+			Name:       name,
+			SizeBytes:  sectors * 512, // La taille est toujours exprimée en secteurs de 512 octets
+			Rotational: readTrimmed(filepath.Join(dir, "queue", "rotational")) == "1",
+			Model:      readTrimmed(filepath.Join(dir, "device", "model")),
+		})
+	}
+	return result
+}
+
+// Systèmes de fichiers montés de /proc/mounts, hors pseudo-systèmes de fichiers
+func filesystems() []Filesystem {
+	mounts, err := ioutil.ReadFile("/proc/mounts")
+	if err != nil {
+		return nil
+	}
+	seen := make(map[string]bool)
+	var result []Filesystem
+	for _, line := range strings.Split(string(mounts), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || pseudoFilesystems[fields[2]] || seen[fields[1]] {
+			continue
+		}
+		seen[fields[1]] = true
+		var stat syscall.Statfs_t
+		if err := syscall.Statfs(fields[1], &stat); err != nil {
+			continue
+		}
+		result = append(result, Filesystem{
+			Device:     fields[0],
+			Mountpoint: fields[1],
+			Type:       fields[2],
+			TotalBytes: stat.Blocks * uint64(stat.Bsize),
+			FreeBytes:  stat.Bavail * uint64(stat.Bsize),
+		})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Mountpoint < result[j].Mountpoint })
+	return result
+}
+
+// Faits à plat (clé en majuscules, valeur texte), utilisés pour l'environnement des scripts et par alcli.
+// Les faits statiques gardent leur nom et remplacent un fait collecté du même nom, les labels sont préfixés par LABEL_.
+func (f *Facts) Flatten() map[string]string {
+	values := map[string]string{
+		"HOSTNAME":        f.Hostname,
+		"OS_ID":           f.OS.ID,
+		"OS_ID_LIKE":      f.OS.IDLike,
+		"OS_NAME":         f.OS.Name,
+		"OS_VERSION":      f.OS.Version,
+		"OS_VERSION_ID":   f.OS.VersionID,
+		"KERNEL":          f.Kernel,
+		"ARCH":            f.Arch,
+		"CPUS":            strconv.Itoa(f.CPUs),
+		"CPU_MODEL":       f.CPUModel,
+		"MEMORY_MB":       strconv.FormatUint(f.MemoryBytes/(1024*1024), 10),
+		"SWAP_MB":         strconv.FormatUint(f.SwapBytes/(1024*1024), 10),
+		"UPTIME_SECONDS":  strconv.FormatInt(f.UptimeSeconds, 10),
+		"VENDOR":          f.Vendor,
+		"PRODUCT":         f.Product,
+		"IPV4":            f.IPv4,
+		"IPV6":            f.IPv6,
+		"PACKAGE_MANAGER": f.PackageManager,
+	}
+	var addresses, disks []string
+	for _, iface := range f.Interfaces {
+		for _, addr := range iface.Addresses {
+			if ip, _, err := net.ParseCIDR(addr); err == nil && !ip.IsLoopback() {
+				addresses = append(addresses, ip.String())
+			}
+		}
+	}
+	for _, disk := range f.Disks {
+		disks = append(disks, disk.Name)
+	}
+	values["IP_ADDRESSES"] = strings.Join(addresses, " ")
+	values["DISKS"] = strings.Join(disks, " ")
+
+	for key, value := range f.Static {
+		values[strings.ToUpper(key)] = value
+	}
+	for key, value := range f.Labels {
+		values["LABEL_"+strings.ToUpper(key)] = value
+	}
+	return values
+}
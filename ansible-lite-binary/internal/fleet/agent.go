@@ -0,0 +1,289 @@
+package fleet
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"aidalinfo/ansible-lite/internal/config"
+	"aidalinfo/ansible-lite/internal/db"
+	"aidalinfo/ansible-lite/internal/facts"
+	"aidalinfo/ansible-lite/internal/logger"
+	"aidalinfo/ansible-lite/internal/repos"
+)
+
+// Délais entre deux tentatives lorsque le serveur est injoignable
+const (
+	agentRetryMin = 5 * time.Second
+	agentRetryMax = time.Minute
+)
+
+// Nombre d'exécutions en attente de remontée au serveur
+const reportQueueSize = 256
+
+// Fichier du token de l'agent, à côté de la base de données
+const agentTokenFile = "agent.token"
+
+// Agent : inscrit auprès du serveur, il applique la configuration reçue et remonte ses exécutions
+type agent struct {
+	cfg       *config.GlobalConfig
+	name      string
+	tokenPath string
+	mu        sync.Mutex
+	token     string
+	client    *http.Client
+	reports   chan db.Execution
+}
+
+// Créer le repos.yaml vide d'un agent qui n'a encore reçu aucune configuration
+func PrepareAgent(cfg *config.GlobalConfig) error {
+	if _, err := os.Stat(cfg.Global.ReposConfig); err == nil {
+		return nil
+	}
+	return ioutil.WriteFile(cfg.Global.ReposConfig, []byte("{}\n"), 0644)
+}
+
+// Faire fonctionner la machine en agent du serveur server_url
+func RunAgent(cfg *config.GlobalConfig) {
+	a := &agent{
+		cfg:       cfg,
+		name:      cfg.Global.AgentName,
+		tokenPath: filepath.Join(filepath.Dir(cfg.Global.DBPath), agentTokenFile),
+		client:    &http.Client{Timeout: pollTimeout + 30*time.Second, Transport: serverTransport(cfg)},
+		reports:   make(chan db.Execution, reportQueueSize),
+	}
+	if a.name == "" {
+		a.name = facts.Get().Hostname
+	}
+	if data, err := ioutil.ReadFile(a.tokenPath); err == nil {
+		a.setToken(strings.TrimSpace(string(data)))
+	}
+
+	repos.OnExecutionFinished(func(e db.Execution) {
+		select {
+		case a.reports <- e:
+		default:
+			logger.Log("ERROR", "File de remontée des exécutions pleine, exécution %d non transmise au serveur", e.ID)
+		}
+	})
+	go a.reportLoop()
+	a.pollLoop()
+}
+
+// Transport vers le serveur : avec server_ca, son certificat est vérifié par cette CA plutôt que
+// par les autorités du système
+func serverTransport(cfg *config.GlobalConfig) http.RoundTripper {
+	if cfg.Global.ServerCA == "" {
+		return http.DefaultTransport
+	}
+	data, err := ioutil.ReadFile(cfg.Global.ServerCA)
+	pool := x509.NewCertPool()
+	if err != nil || !pool.AppendCertsFromPEM(data) {
+		logger.Log("ERROR", "CA du serveur %s illisible, autorités du système utilisées : %v", cfg.Global.ServerCA, err)
+		return http.DefaultTransport
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	return transport
+}
+
+// Token attribué par le serveur (vide tant que l'agent n'est pas inscrit)
+func (a *agent) currentToken() string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.token
+}
+
+func (a *agent) setToken(agentToken string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.token = agentToken
+	if agentToken != "" {
+		logger.AddSecrets(agentToken)
+	}
+}
+
+// Attendre avant une nouvelle tentative et renvoyer le délai suivant
+func backoff(wait time.Duration) time.Duration {
+	time.Sleep(wait)
+	if wait *= 2; wait > agentRetryMax {
+		wait = agentRetryMax
+	}
+	return wait
+}
+
+// Interroger le serveur en continu et appliquer chaque nouvelle configuration
+func (a *agent) pollLoop() {
+	// La version appliquée est l'empreinte de repos.yaml, identique à celle calculée par le serveur
+	current, _ := ioutil.ReadFile(a.cfg.Global.ReposConfig)
+	applied := version(current)
+	applyError := ""
+
+	wait := agentRetryMin
+	for {
+		if a.currentToken() == "" {
+			if err := a.enroll(); err != nil {
+				logger.Log("ERROR", "Inscription auprès de %s impossible : %v", a.cfg.Global.ServerURL, err)
+				wait = backoff(wait)
+				continue
+			}
+		}
+
+		resp, err := a.poll(applied, applyError)
+		if err == ErrUnauthorized {
+			logger.Log("WARN", "Token de l'agent refusé par le serveur, nouvelle inscription")
+			a.setToken("")
+			os.Remove(a.tokenPath)
+			continue
+		}
+		if err != nil {
+			logger.Log("ERROR", "Interrogation de %s impossible : %v", a.cfg.Global.ServerURL, err)
+			wait = backoff(wait)
+			continue
+		}
+		wait = agentRetryMin
+		if resp == nil {
+			continue
+		}
+
+		applied, applyError = resp.Version, ""
+		if err := a.apply(resp); err != nil {
+			logger.Log("ERROR", "Configuration %s du serveur rejetée : %v", resp.Version, err)
+			applyError = err.Error()
+		}
+	}
+}
+
+// Labels et faits de l'agent, utilisés par le serveur pour sélectionner ses tâches
+func (a *agent) identity() (map[string]string, map[string]string) {
+	return a.cfg.Global.Labels, facts.Get().Flatten()
+}
+
+// S'inscrire avec le jeton d'inscription et conserver le token attribué
+func (a *agent) enroll() error {
+	labels, hostFacts := a.identity()
+	var resp EnrollResponse
+	status, err := a.post("/agents/enroll", a.currentToken(), EnrollRequest{
+		Name: a.name, JoinToken: a.cfg.Global.JoinToken, Labels: labels, Facts: hostFacts,
+	}, &resp)
+	if err != nil {
+		return err
+	}
+	if status == http.StatusConflict {
+		return fmt.Errorf("le nom %s est déjà inscrit sur le serveur ; supprimez l'ancien agent (alcli agents remove %s) ou changez agent_name", a.name, a.name)
+	}
+	if status != http.StatusOK {
+		return fmt.Errorf("réponse %d du serveur", status)
+	}
+
+	a.setToken(resp.Token)
+	if err := ioutil.WriteFile(a.tokenPath, []byte(resp.Token+"\n"), 0600); err != nil {
+		logger.Log("ERROR", "Impossible d'enregistrer le token de l'agent dans %s : %v", a.tokenPath, err)
+	}
+	logger.Log("INFO", "Agent %s inscrit auprès de %s", a.name, a.cfg.Global.ServerURL)
+	return nil
+}
+
+// Interrogation longue : nouvelle configuration, ou nil si rien n'a changé
+func (a *agent) poll(applied, applyError string) (*PollResponse, error) {
+	labels, hostFacts := a.identity()
+	var resp PollResponse
+	status, err := a.post("/agents/poll", a.currentToken(), PollRequest{
+		Version: applied, Error: applyError, Labels: labels, Facts: hostFacts,
+	}, &resp)
+	switch {
+	case err != nil:
+		return nil, err
+	case status == http.StatusNoContent:
+		return nil, nil
+	case status != http.StatusOK:
+		return nil, fmt.Errorf("réponse %d du serveur", status)
+	}
+	return &resp, nil
+}
+
+// Valider la configuration reçue, remplacer repos.yaml et replanifier les tâches modifiées
+func (a *agent) apply(resp *PollResponse) error {
+	path := a.cfg.Global.ReposConfig
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, []byte(resp.Config), 0644); err != nil {
+		return err
+	}
+	if issues := repos.CheckReposFile(tmp); len(issues) > 0 {
+		os.Remove(tmp)
+		messages := make([]string, 0, len(issues))
+		for _, issue := range issues {
+			messages = append(messages, issue.String())
+		}
+		return fmt.Errorf("%s", strings.Join(messages, "; "))
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	logger.Log("INFO", "Configuration %s reçue du serveur : %s", resp.Version, strings.Join(resp.Jobs, ", "))
+	_, err := repos.ReloadReposConfig(a.cfg)
+	return err
+}
+
+// Remonter les exécutions terminées, dans l'ordre, en réessayant tant que le serveur est injoignable
+func (a *agent) reportLoop() {
+	for e := range a.reports {
+		wait := agentRetryMin
+		for {
+			status, err := a.post("/agents/executions", a.currentToken(), e, nil)
+			if err == nil && status == http.StatusNoContent {
+				break
+			}
+			// Tâche retirée de la configuration de l'agent entre l'exécution et sa remontée
+			if err == nil && status == http.StatusForbidden {
+				logger.Log("ERROR", "Exécution %d de %s/%s refusée par le serveur, abandon de sa remontée", e.ID, e.JobKind, e.JobName)
+				break
+			}
+			if err == nil {
+				err = fmt.Errorf("réponse %d du serveur", status)
+			}
+			logger.Log("ERROR", "Remontée de l'exécution %d impossible : %v", e.ID, err)
+			wait = backoff(wait)
+		}
+	}
+}
+
+// Envoyer une requête JSON au serveur et décoder la réponse dans out (si fourni et statut 200)
+func (a *agent) post(path, agentToken string, in, out interface{}) (int, error) {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(a.cfg.Global.ServerURL, "/")+path, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if agentToken != "" {
+		req.Header.Set("Authorization", "Bearer "+agentToken)
+	}
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusUnauthorized && agentToken != "" {
+		return resp.StatusCode, ErrUnauthorized
+	}
+	if resp.StatusCode == http.StatusOK && out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return resp.StatusCode, err
+		}
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,45 @@
+package fleet
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+)
+
+// Durée maximale d'une interrogation longue (long polling) d'un agent
+const pollTimeout = 30 * time.Second
+
+// Inscription d'un agent (POST /agents/enroll)
+type EnrollRequest struct {
+	Name      string            `json:"name"`
+	JoinToken string            `json:"join_token"`
+	Labels    map[string]string `json:"labels"`
+	Facts     map[string]string `json:"facts"`
+}
+
+// Token propre à l'agent, à présenter dans l'en-tête Authorization des requêtes suivantes
+type EnrollResponse struct {
+	Token string `json:"token"`
+}
+
+// Interrogation d'un agent (POST /agents/poll) : version de la configuration appliquée,
+// erreur éventuelle à son application, labels et faits à jour
+type PollRequest struct {
+	Version string            `json:"version"`
+	Error   string            `json:"error,omitempty"`
+	Labels  map[string]string `json:"labels"`
+	Facts   map[string]string `json:"facts"`
+}
+
+// Nouvelle configuration de l'agent : repos.yaml complet et tâches qu'il contient
+type PollResponse struct {
+	Version string   `json:"version"`
+	Config  string   `json:"config"`
+	Jobs    []string `json:"jobs"`
+}
+
+// Version d'une configuration : empreinte de son contenu, calculable des deux côtés
+func version(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,259 @@
+package fleet
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"aidalinfo/ansible-lite/internal/config"
+	"aidalinfo/ansible-lite/internal/db"
+	"aidalinfo/ansible-lite/internal/logger"
+	"aidalinfo/ansible-lite/internal/repos"
+	"aidalinfo/ansible-lite/internal/token"
+)
+
+// Erreur renvoyée pour un jeton d'inscription ou un token d'agent invalide
+var ErrUnauthorized = errors.New("jeton invalide")
+
+// Inscription refusée : le nom est déjà celui d'un agent inscrit
+var ErrAgentExists = errors.New("un agent de ce nom est déjà inscrit")
+
+// Agent inconnu du serveur
+var ErrUnknownAgent = errors.New("agent inconnu")
+
+// Exécution remontée pour une tâche qui n'est pas distribuée à l'agent
+var ErrUnknownJob = errors.New("tâche non distribuée à cet agent")
+
+// Agent tel qu'il est présenté par GET /agents
+type AgentStatus struct {
+	db.Agent
+	Jobs   []string // Tâches du catalogue distribuées à l'agent
+	Online bool     // L'agent a interrogé le serveur récemment
+	InSync bool     // L'agent applique la dernière version de sa configuration
+}
+
+var (
+	catalogueMu sync.RWMutex
+	catalogue   *repos.Catalogue
+	// Fermé à chaque rechargement du catalogue pour réveiller les interrogations en attente
+	catalogueChanged = make(chan struct{})
+)
+
+// Charger le catalogue de tâches distribué aux agents (repos_config du serveur)
+func LoadCatalogue(cfg *config.GlobalConfig) error {
+	c, err := repos.LoadCatalogue(cfg.Global.ReposConfig)
+	if err != nil {
+		return err
+	}
+	catalogueMu.Lock()
+	catalogue = c
+	catalogueMu.Unlock()
+	logger.Log("INFO", "Catalogue %s chargé : %d tâche(s)", cfg.Global.ReposConfig, len(c.Config.Fingerprints()))
+	return nil
+}
+
+// Recharger le catalogue ; les agents concernés reçoivent leur nouvelle configuration
+// à leur interrogation en cours. Un catalogue invalide est rejeté.
+func ReloadCatalogue(cfg *config.GlobalConfig) (repos.ReloadResult, error) {
+	c, err := repos.LoadCatalogue(cfg.Global.ReposConfig)
+	if err != nil {
+		logger.Log("ERROR", "Rechargement de %s refusé, le catalogue actuel est conservé : %v", cfg.Global.ReposConfig, err)
+		return repos.ReloadResult{}, err
+	}
+
+	catalogueMu.Lock()
+	previous := map[string]string{}
+	if catalogue != nil {
+		previous = catalogue.Config.Fingerprints()
+	}
+	catalogue = c
+	close(catalogueChanged)
+	catalogueChanged = make(chan struct{})
+	catalogueMu.Unlock()
+
+	result := repos.DiffFingerprints(previous, c.Config.Fingerprints())
+	logger.Log("INFO", "Catalogue %s rechargé : %d tâche(s) ajoutée(s), %d modifiée(s), %d supprimée(s)",
+		cfg.Global.ReposConfig, len(result.Added), len(result.Updated), len(result.Removed))
+	return result, nil
+}
+
+// Catalogue courant et canal fermé à son prochain rechargement
+func currentCatalogue() (*repos.Catalogue, <-chan struct{}) {
+	catalogueMu.RLock()
+	defer catalogueMu.RUnlock()
+	return catalogue, catalogueChanged
+}
+
+// Configuration d'un agent d'après ses labels et ses faits
+func agentConfig(a *db.Agent) (*PollResponse, error) {
+	c, _ := currentCatalogue()
+	if c == nil {
+		return nil, fmt.Errorf("catalogue non chargé")
+	}
+	data, jobs, err := c.Select(a.Labels, a.Facts)
+	if err != nil {
+		return nil, err
+	}
+	return &PollResponse{Version: version(data), Config: string(data), Jobs: jobs}, nil
+}
+
+// Inscrire un agent présentant le jeton d'inscription et lui attribuer un token. Un nom déjà
+// inscrit n'est réattribué que sur présentation du token actuel de cet agent (currentToken) :
+// sinon l'agent doit d'abord être supprimé par un administrateur (RemoveAgent)
+func Enroll(cfg *config.GlobalConfig, req EnrollRequest, currentToken string) (*EnrollResponse, error) {
+	if cfg.Global.JoinToken == "" || subtle.ConstantTimeCompare([]byte(req.JoinToken), []byte(cfg.Global.JoinToken)) != 1 {
+		logger.Log("ERROR", "Inscription refusée pour l'agent %q : jeton d'inscription invalide", req.Name)
+		return nil, ErrUnauthorized
+	}
+	if req.Name == "" {
+		return nil, fmt.Errorf("nom de l'agent obligatoire")
+	}
+
+	agentToken, err := token.GenerateToken(32)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().Format(time.RFC3339)
+	a := &db.Agent{
+		Name:       req.Name,
+		TokenHash:  token.Hash(agentToken),
+		Labels:     req.Labels,
+		Facts:      req.Facts,
+		EnrolledAt: now,
+		LastSeen:   now,
+	}
+	enrolled, err := db.EnrollAgent(cfg.Global.DBPath, a)
+	if err != nil {
+		return nil, err
+	}
+	if !enrolled && currentToken != "" {
+		enrolled, err = db.ReenrollAgent(cfg.Global.DBPath, a, token.Hash(currentToken))
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !enrolled {
+		logger.Log("WARN", "Inscription refusée pour l'agent %q : nom déjà inscrit", req.Name)
+		return nil, ErrAgentExists
+	}
+	logger.Log("INFO", "Agent %s inscrit", req.Name)
+	return &EnrollResponse{Token: agentToken}, nil
+}
+
+// Supprimer un agent : son token est révoqué et son nom peut de nouveau être inscrit
+func RemoveAgent(cfg *config.GlobalConfig, name string) error {
+	found, err := db.DeleteAgent(cfg.Global.DBPath, name)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return ErrUnknownAgent
+	}
+	logger.Log("INFO", "Agent %s supprimé", name)
+	return nil
+}
+
+// Retrouver l'agent correspondant au token présenté
+func Authenticate(cfg *config.GlobalConfig, agentToken string) (*db.Agent, error) {
+	if agentToken == "" {
+		return nil, ErrUnauthorized
+	}
+	a, err := db.GetAgentByTokenHash(cfg.Global.DBPath, token.Hash(agentToken))
+	if err != nil {
+		return nil, err
+	}
+	if a == nil {
+		return nil, ErrUnauthorized
+	}
+	return a, nil
+}
+
+// Interrogation longue d'un agent : renvoie sa configuration dès qu'elle diffère de celle
+// qu'il applique, ou nil au bout de pollTimeout si rien n'a changé
+func Poll(ctx context.Context, cfg *config.GlobalConfig, a *db.Agent, req PollRequest) (*PollResponse, error) {
+	a.Labels = req.Labels
+	a.Facts = req.Facts
+	a.LastSeen = time.Now().Format(time.RFC3339)
+	a.ConfigVersion = req.Version
+	a.ConfigError = req.Error
+	if err := db.UpdateAgent(cfg.Global.DBPath, a); err != nil {
+		return nil, err
+	}
+	if req.Error != "" {
+		logger.Log("ERROR", "L'agent %s n'a pas pu appliquer la configuration %s : %s", a.Name, req.Version, req.Error)
+	}
+
+	timeout := time.NewTimer(pollTimeout)
+	defer timeout.Stop()
+	for {
+		_, changed := currentCatalogue()
+		resp, err := agentConfig(a)
+		if err != nil {
+			return nil, err
+		}
+		if resp.Version != req.Version {
+			logger.Log("INFO", "Envoi de la configuration %s à l'agent %s (%d tâche(s))", resp.Version, a.Name, len(resp.Jobs))
+			return resp, nil
+		}
+		select {
+		case <-changed:
+		case <-timeout.C:
+			return nil, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Enregistrer dans l'historique du serveur une exécution remontée par un agent ; seules les
+// tâches que le catalogue distribue à l'agent sont acceptées
+func Report(cfg *config.GlobalConfig, a *db.Agent, e db.Execution) error {
+	resp, err := agentConfig(a)
+	if err != nil {
+		return err
+	}
+	if !containsJob(resp.Jobs, e.JobKind+"/"+e.JobName) {
+		logger.Log("ERROR", "Exécution de %s/%s refusée : tâche non distribuée à l'agent %s", e.JobKind, e.JobName, a.Name)
+		return ErrUnknownJob
+	}
+
+	e.ID = 0
+	e.Agent = a.Name
+	if _, err := db.LogExecution(cfg.Global.DBPath, &e); err != nil {
+		return err
+	}
+	return db.FinishExecution(cfg.Global.DBPath, &e)
+}
+
+func containsJob(jobs []string, key string) bool {
+	for _, job := range jobs {
+		if job == key {
+			return true
+		}
+	}
+	return false
+}
+
+// Agents inscrits avec les tâches qui leur sont distribuées
+func ListAgents(cfg *config.GlobalConfig) ([]AgentStatus, error) {
+	agents, err := db.ListAgents(cfg.Global.DBPath)
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]AgentStatus, 0, len(agents))
+	for _, a := range agents {
+		status := AgentStatus{Agent: a}
+		if lastSeen, err := time.Parse(time.RFC3339, a.LastSeen); err == nil {
+			status.Online = time.Since(lastSeen) < 2*pollTimeout
+		}
+		if resp, err := agentConfig(&a); err == nil {
+			status.Jobs = resp.Jobs
+			status.InSync = resp.Version == a.ConfigVersion && a.ConfigError == ""
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
@@ -0,0 +1,143 @@
+package fleet
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"aidalinfo/ansible-lite/internal/config"
+	"aidalinfo/ansible-lite/internal/db"
+	"aidalinfo/ansible-lite/internal/testutil"
+)
+
+func testServerConfig(t *testing.T) *config.GlobalConfig {
+	t.Helper()
+	cfg := testutil.Config(t)
+	cfg.Global.Type = config.TypeServer
+	cfg.Global.JoinToken = "jeton-d-inscription"
+	return cfg
+}
+
+func enroll(t *testing.T, cfg *config.GlobalConfig, name, currentToken string) (string, error) {
+	t.Helper()
+	resp, err := Enroll(cfg, EnrollRequest{Name: name, JoinToken: cfg.Global.JoinToken}, currentToken)
+	if err != nil {
+		return "", err
+	}
+	return resp.Token, nil
+}
+
+func authenticates(cfg *config.GlobalConfig, agentToken, name string) bool {
+	a, err := Authenticate(cfg, agentToken)
+	return err == nil && a != nil && a.Name == name
+}
+
+// Le jeton d'inscription ne suffit pas pour prendre le nom d'un agent déjà inscrit
+func TestEnrollExistingName(t *testing.T) {
+	cfg := testServerConfig(t)
+
+	original, err := enroll(t, cfg, "web-01", "")
+	if err != nil {
+		t.Fatalf("première inscription : %v", err)
+	}
+
+	// Sans token, ou avec un token qui n'est pas celui de l'agent : refusé, l'agent garde son token
+	for _, currentToken := range []string{"", "token-d-un-autre"} {
+		if _, err := enroll(t, cfg, "web-01", currentToken); err != ErrAgentExists {
+			t.Errorf("inscription avec le token %q : erreur %v, attendu ErrAgentExists", currentToken, err)
+		}
+	}
+	if !authenticates(cfg, original, "web-01") {
+		t.Fatal("le token de l'agent a été remplacé par une inscription refusée")
+	}
+
+	// Avec son token actuel, l'agent obtient un nouveau token et l'ancien est révoqué
+	renewed, err := enroll(t, cfg, "web-01", original)
+	if err != nil {
+		t.Fatalf("réinscription avec le token actuel : %v", err)
+	}
+	if authenticates(cfg, original, "web-01") || !authenticates(cfg, renewed, "web-01") {
+		t.Error("après réinscription, seul le nouveau token doit être accepté")
+	}
+
+	// Après suppression par un administrateur, le nom est de nouveau libre
+	if err := RemoveAgent(cfg, "web-01"); err != nil {
+		t.Fatalf("suppression : %v", err)
+	}
+	if authenticates(cfg, renewed, "web-01") {
+		t.Error("le token d'un agent supprimé est encore accepté")
+	}
+	if _, err := enroll(t, cfg, "web-01", ""); err != nil {
+		t.Errorf("inscription après suppression : %v", err)
+	}
+	if err := RemoveAgent(cfg, "inconnu"); err != ErrUnknownAgent {
+		t.Errorf("suppression d'un agent inconnu : %v, attendu ErrUnknownAgent", err)
+	}
+}
+
+func TestEnrollInvalidJoinToken(t *testing.T) {
+	cfg := testServerConfig(t)
+	_, err := Enroll(cfg, EnrollRequest{Name: "web-01", JoinToken: "mauvais"}, "")
+	if err != ErrUnauthorized {
+		t.Errorf("erreur %v, attendu ErrUnauthorized", err)
+	}
+}
+
+// Charger un catalogue de test : web distribué à tous les agents, db aux seuls agents role=db
+func loadTestCatalogue(t *testing.T, cfg *config.GlobalConfig) {
+	t.Helper()
+	cfg.Global.ReposConfig = filepath.Join(t.TempDir(), "repos.yaml")
+	content := `repos:
+  web:
+    url: https://github.com/org/web.git
+    watcher: "@every 1h"
+    branch: main
+    path: /srv/web
+    init: init.sh
+  db:
+    url: https://github.com/org/db.git
+    watcher: "@every 1h"
+    branch: main
+    path: /srv/db
+    init: init.sh
+    selector:
+      labels:
+        role: db
+`
+	if err := ioutil.WriteFile(cfg.Global.ReposConfig, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadCatalogue(cfg); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		catalogueMu.Lock()
+		catalogue = nil
+		catalogueMu.Unlock()
+	})
+}
+
+// Un agent ne peut remonter que les exécutions des tâches qui lui sont distribuées
+func TestReportUnknownJob(t *testing.T) {
+	cfg := testServerConfig(t)
+	loadTestCatalogue(t, cfg)
+	agentToken, err := enroll(t, cfg, "web-01", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := Authenticate(cfg, agentToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	execution := db.Execution{JobKind: "repo", JobName: "web", Status: "success"}
+	if err := Report(cfg, a, execution); err != nil {
+		t.Errorf("tâche distribuée : %v", err)
+	}
+	for _, name := range []string{"db", "inconnue"} {
+		execution.JobName = name
+		if err := Report(cfg, a, execution); err != ErrUnknownJob {
+			t.Errorf("tâche %s : erreur %v, attendu ErrUnknownJob", name, err)
+		}
+	}
+}
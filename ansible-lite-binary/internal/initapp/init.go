@@ -2,7 +2,7 @@ package initapp
 
 import (
 	"fmt"
-	"log"
+	"io"
 	"os"
 	"path/filepath"
 	"gopkg.in/yaml.v2"
@@ -12,7 +12,6 @@ import (
 	"aidalinfo/ansible-lite/internal/logger"
 	"aidalinfo/ansible-lite/internal/api"
 	"aidalinfo/ansible-lite/internal/token" 
-	"github.com/natefinch/lumberjack"
 )
 
 // InitApp est la fonction d'initialisation principale qui gère les logs et la base de données
@@ -24,6 +23,15 @@ func InitApp(configPath string) (*config.GlobalConfig, error) {
 		return nil, fmt.Errorf("Erreur lors du chargement de la configuration : %v", err)
 	}
 
+	// Niveau et format des logs
+	if err := logger.Configure(cfg.Global.LogLevel, cfg.Global.LogFormat); err != nil {
+		logger.Log("ERROR", "Erreur dans la configuration des logs : %v", err)
+		return nil, err
+	}
+
+	// Masquer les secrets de la configuration dans tous les logs
+	logger.AddSecrets(cfg.Global.Credentials, cfg.Global.GithubToken)
+
 	// Vérifier si le répertoire parent du fichier de log existe, sinon le créer
 	logDir := filepath.Dir(cfg.Global.LogPath)
 	if _, err := os.Stat(logDir); os.IsNotExist(err) {
@@ -34,14 +42,12 @@ func InitApp(configPath string) (*config.GlobalConfig, error) {
 		}
 	}
 
-	//Gestion des logs avec lumberjack
-	log.SetOutput(&lumberjack.Logger{
-		Filename:   cfg.Global.LogPath,  // Nom du fichier de log
-		MaxSize:    50,              // Taille max en mégaoctets avant rotation
-		MaxBackups: 5,               // Nombre maximal de fichiers de backup conservés
-		MaxAge:     90,              // Durée maximale de conservation des fichiers en jours
-		Compress:   true,            // Compresser les fichiers de log archivés
-})
+	// Destinations des logs : log_path avec rotation par défaut
+	if err := configureLogSinks(cfg); err != nil {
+		logger.Log("ERROR", "Erreur dans la configuration des logs : %v", err)
+		return nil, err
+	}
+
 	// Vérifier si le token existe dans la configuration
 	if cfg.Global.Credentials == "" {  // Utiliser Credentials avec une majuscule
 		logger.Log("INFO", "Aucun token trouvé, génération d'un nouveau token")
@@ -51,6 +57,7 @@ func InitApp(configPath string) (*config.GlobalConfig, error) {
 			return nil, err
 		}
 		cfg.Global.Credentials = newToken
+		logger.AddSecrets(newToken)
 
 		// Sauvegarder la configuration mise à jour dans le fichier
 		err = saveConfig(configPath, cfg)
@@ -79,19 +86,128 @@ func InitApp(configPath string) (*config.GlobalConfig, error) {
 }
 
 
+// Valeurs par défaut de la rotation des fichiers de log
+const (
+	defaultLogMaxSize    = 50 // Mo
+	defaultLogMaxBackups = 5
+	defaultLogMaxAge     = 90 // jours
+)
+
+// Identifiant des messages envoyés à syslog et au journal
+const defaultLogTag = "ansible-lite"
+
+// Première valeur non nulle
+func firstPositive(values ...int) int {
+	for _, v := range values {
+		if v > 0 {
+			return v
+		}
+	}
+	return 0
+}
+
+// Première valeur renseignée, 0 compris (0 : conserver toutes les archives), sinon la valeur par défaut
+func firstSet(def int, values ...*int) int {
+	for _, v := range values {
+		if v != nil {
+			return *v
+		}
+	}
+	return def
+}
+
+// Rotation d'un fichier de log : celle de la destination, puis log_rotation, puis les valeurs par défaut
+func logRotation(sink, global config.LogRotation) logger.Rotation {
+	compress := true
+	if global.Compress != nil {
+		compress = *global.Compress
+	}
+	if sink.Compress != nil {
+		compress = *sink.Compress
+	}
+	return logger.Rotation{
+		MaxSize:    firstPositive(sink.MaxSize, global.MaxSize, defaultLogMaxSize),
+		MaxBackups: firstSet(defaultLogMaxBackups, sink.MaxBackups, global.MaxBackups),
+		MaxAge:     firstSet(defaultLogMaxAge, sink.MaxAge, global.MaxAge),
+		Compress:   compress,
+	}
+}
+
+// Ouvrir les destinations des logs de log_sinks (log_path seul si la liste est vide)
+func configureLogSinks(cfg *config.GlobalConfig) error {
+	sinks := cfg.Global.LogSinks
+	if len(sinks) == 0 {
+		sinks = []config.LogSink{{Type: config.LogSinkFile}}
+	}
+
+	var outputs []logger.Output
+	// Fermer les destinations déjà ouvertes (connexions syslog et journald) si une suivante échoue
+	closeOutputs := func() {
+		for _, o := range outputs {
+			if c, ok := o.Sink.(io.Closer); ok {
+				c.Close()
+			}
+		}
+	}
+	for _, s := range sinks {
+		tag := s.Tag
+		if tag == "" {
+			tag = defaultLogTag
+		}
+		var sink logger.Sink
+		switch s.Type {
+		case config.LogSinkFile:
+			path := s.Path
+			if path == "" {
+				path = cfg.Global.LogPath
+			}
+			if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+				closeOutputs()
+				return fmt.Errorf("impossible de créer le répertoire de %s : %v", path, err)
+			}
+			sink = logger.NewFileSink(path, logRotation(s.LogRotation, cfg.Global.LogRotation))
+		case config.LogSinkStdout:
+			sink = logger.NewStreamSink(os.Stdout)
+		case config.LogSinkStderr:
+			sink = logger.NewStreamSink(os.Stderr)
+		case config.LogSinkSyslog:
+			var err error
+			if sink, err = logger.NewSyslogSink(s.Facility, tag); err != nil {
+				closeOutputs()
+				return err
+			}
+		case config.LogSinkJournald:
+			var err error
+			if sink, err = logger.NewJournaldSink(tag); err != nil {
+				closeOutputs()
+				return err
+			}
+		default:
+			closeOutputs()
+			return fmt.Errorf("destination de log inconnue : %s", s.Type)
+		}
+		outputs = append(outputs, logger.Output{Sink: sink, Level: s.Level, Format: s.Format})
+	}
+	if err := logger.SetOutputs(outputs); err != nil {
+		closeOutputs()
+		return err
+	}
+	return nil
+}
+
 // Fonction pour sauvegarder la configuration dans le fichier config.yaml
 func saveConfig(configPath string, cfg *config.GlobalConfig) error {
 	data, err := yaml.Marshal(cfg)
 	if err != nil {
-		log.Printf("Erreur lors du marshalling de la configuration : %v", err)
+		logger.Log("ERROR", "Erreur lors du marshalling de la configuration : %v", err)
 		return err
 	}
 
 	err = ioutil.WriteFile(configPath, data, 0644)
 	if err != nil {
-		log.Printf("Erreur lors de la sauvegarde du fichier de configuration : %v", err)
+		logger.Log("ERROR", "Erreur lors de la sauvegarde du fichier de configuration : %v", err)
 		return err
 	}
-	log.Printf("Configuration sauvegardée avec succès")
+	logger.Log("INFO", "Configuration sauvegardée avec succès")
 	return nil
 }
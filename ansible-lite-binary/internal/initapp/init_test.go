@@ -0,0 +1,31 @@
+package initapp
+
+import (
+	"testing"
+
+	"aidalinfo/ansible-lite/internal/config"
+	"aidalinfo/ansible-lite/internal/logger"
+)
+
+// Une destination hérite de log_rotation puis des valeurs par défaut ; 0 explicite est conservé
+func TestLogRotation(t *testing.T) {
+	zero, ten := 0, 10
+	tests := []struct {
+		name   string
+		sink   config.LogRotation
+		global config.LogRotation
+		want   logger.Rotation
+	}{
+		{"valeurs par défaut", config.LogRotation{}, config.LogRotation{},
+			logger.Rotation{MaxSize: 50, MaxBackups: 5, MaxAge: 90, Compress: true}},
+		{"log_rotation", config.LogRotation{}, config.LogRotation{MaxSize: 100, MaxBackups: &ten, MaxAge: &ten},
+			logger.Rotation{MaxSize: 100, MaxBackups: 10, MaxAge: 10, Compress: true}},
+		{"0 : toutes les archives, sans limite de durée", config.LogRotation{MaxBackups: &zero, MaxAge: &zero}, config.LogRotation{MaxBackups: &ten, MaxAge: &ten},
+			logger.Rotation{MaxSize: 50, MaxBackups: 0, MaxAge: 0, Compress: true}},
+	}
+	for _, tt := range tests {
+		if got := logRotation(tt.sink, tt.global); got != tt.want {
+			t.Errorf("%s : %+v, attendu %+v", tt.name, got, tt.want)
+		}
+	}
+}
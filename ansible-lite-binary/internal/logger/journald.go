@@ -0,0 +1,103 @@
+package logger
+
+import (
+    "bytes"
+    "encoding/binary"
+    "errors"
+    "fmt"
+    "net"
+    "os"
+    "strconv"
+    "strings"
+    "syscall"
+)
+
+// Socket du protocole natif de journald
+const journalSocket = "/run/systemd/journal/socket"
+
+// Priorités syslog utilisées par le journal
+var journalPriorities = map[Level]int{LevelDebug: 7, LevelInfo: 6, LevelWarn: 4, LevelError: 3}
+
+// Journal systemd, avec les informations structurées en champs du journal (JOB, EXECUTION_ID...)
+type journaldSink struct {
+    conn       *net.UnixConn
+    identifier string
+}
+
+// Connexion au journal systemd ; les messages portent l'identifiant donné (SYSLOG_IDENTIFIER)
+func NewJournaldSink(identifier string) (Sink, error) {
+    conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: journalSocket, Net: "unixgram"})
+    if err != nil {
+        return nil, fmt.Errorf("connexion au journal systemd (%s) impossible : %v", journalSocket, err)
+    }
+    return &journaldSink{conn: conn, identifier: identifier}, nil
+}
+
+// Le format est sans objet : chaque information structurée devient un champ du journal
+func (s *journaldSink) Write(e Entry, format string) error {
+    var b bytes.Buffer
+    writeJournalField(&b, "MESSAGE", e.Message)
+    writeJournalField(&b, "PRIORITY", strconv.Itoa(journalPriorities[e.Level]))
+    writeJournalField(&b, "SYSLOG_IDENTIFIER", s.identifier)
+    for _, key := range sortedKeys(e.Fields) {
+        name := journalFieldName(key)
+        if name == "" || name == "MESSAGE" || name == "PRIORITY" || name == "SYSLOG_IDENTIFIER" {
+            continue
+        }
+        writeJournalField(&b, name, fmt.Sprint(fieldValue(e.Fields[key])))
+    }
+
+    _, err := s.conn.Write(b.Bytes())
+    if err == nil {
+        return nil
+    }
+    // Message trop long pour un datagramme : il est transmis par un descripteur de fichier
+    if errors.Is(err, syscall.EMSGSIZE) || errors.Is(err, syscall.ENOBUFS) {
+        return s.writeFile(b.Bytes())
+    }
+    return err
+}
+
+// Transmettre le message dans un fichier temporaire supprimé, dont le descripteur est envoyé au journal
+func (s *journaldSink) writeFile(data []byte) error {
+    f, err := os.CreateTemp("/dev/shm", "ansible-lite-journal-")
+    if err != nil {
+        return err
+    }
+    defer f.Close()
+    os.Remove(f.Name())
+    if _, err := f.Write(data); err != nil {
+        return err
+    }
+    _, _, err = s.conn.WriteMsgUnix(nil, syscall.UnixRights(int(f.Fd())), nil)
+    return err
+}
+
+func (s *journaldSink) Close() error {
+    return s.conn.Close()
+}
+
+// Champ du protocole natif : NOM=valeur, ou NOM, longueur sur 64 bits et valeur si elle contient
+// un retour à la ligne
+func writeJournalField(b *bytes.Buffer, name, value string) {
+    if !strings.Contains(value, "\n") {
+        b.WriteString(name + "=" + value + "\n")
+        return
+    }
+    b.WriteString(name + "\n")
+    binary.Write(b, binary.LittleEndian, uint64(len(value)))
+    b.WriteString(value + "\n")
+}
+
+// Nom de champ accepté par le journal : majuscules, chiffres et _, sans _ ni chiffre en tête
+func journalFieldName(key string) string {
+    var b strings.Builder
+    for _, r := range strings.ToUpper(key) {
+        if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_' {
+            b.WriteRune(r)
+        } else {
+            b.WriteRune('_')
+        }
+    }
+    return strings.TrimLeft(b.String(), "_0123456789")
+}
@@ -1,16 +1,332 @@
 package logger
 
 import (
+    "encoding/json"
     "fmt"
     "log"
+    "os"
+    "sort"
+    "strings"
+    "sync"
     "time"
 )
+
+// Masque affiché à la place des secrets dans les logs
+const redactedMask = "********"
+
+// Longueur minimale d'un secret pour être masqué (évite de masquer des valeurs triviales)
+const minSecretLength = 4
+
+var (
+    secretsMu sync.RWMutex
+    secrets   = make(map[string]bool)
+    redactor  = strings.NewReplacer()
+)
+
 func init() {
     // Désactiver l'ajout automatique du timestamp par log.Printf
     log.SetFlags(0)
 }
-// Logger personnalisé qui ajoute un timestamp ISO 8601 et un niveau de log (INFO, ERROR)
-func Log(level string, format string, v ...interface{}) {
-    timestamp := time.Now().Format(time.RFC3339)
-    log.Printf(fmt.Sprintf("[%s] [%s] %s", timestamp, level, format), v...)
+
+// Enregistrer des secrets (tokens, identifiants) à masquer dans les logs et les sorties capturées
+func AddSecrets(values ...string) {
+    secretsMu.Lock()
+    defer secretsMu.Unlock()
+
+    changed := false
+    for _, value := range values {
+        value = strings.TrimSpace(value)
+        if len(value) < minSecretLength || secrets[value] {
+            continue
+        }
+        secrets[value] = true
+        changed = true
+    }
+    if !changed {
+        return
+    }
+
+    // Les secrets les plus longs d'abord, pour qu'un secret préfixe d'un autre ne le masque qu'en partie
+    sorted := make([]string, 0, len(secrets))
+    for secret := range secrets {
+        sorted = append(sorted, secret)
+    }
+    sort.Slice(sorted, func(i, j int) bool { return len(sorted[i]) > len(sorted[j]) })
+
+    pairs := make([]string, 0, len(sorted)*2)
+    for _, secret := range sorted {
+        pairs = append(pairs, secret, redactedMask)
+    }
+    redactor = strings.NewReplacer(pairs...)
+}
+
+// Masquer les secrets enregistrés dans un texte
+func Redact(s string) string {
+    secretsMu.RLock()
+    defer secretsMu.RUnlock()
+    return redactor.Replace(s)
+}
+
+// Niveau de log, du plus détaillé au plus grave
+type Level int
+
+const (
+    LevelDebug Level = iota
+    LevelInfo
+    LevelWarn
+    LevelError
+)
+
+var levelNames = map[Level]string{LevelDebug: "debug", LevelInfo: "info", LevelWarn: "warn", LevelError: "error"}
+
+func (l Level) String() string {
+    return levelNames[l]
+}
+
+// Convertir un niveau de la configuration ou de logger.Log (info, INFO, warning...)
+func ParseLevel(name string) (Level, error) {
+    switch strings.ToLower(strings.TrimSpace(name)) {
+    case "debug":
+        return LevelDebug, nil
+    case "", "info":
+        return LevelInfo, nil
+    case "warn", "warning":
+        return LevelWarn, nil
+    case "error":
+        return LevelError, nil
+    }
+    return LevelInfo, fmt.Errorf("niveau de log inconnu : %s (debug, info, warn ou error)", name)
+}
+
+// Formats de sortie des logs
+const (
+    FormatText = "text"
+    FormatJSON = "json"
+)
+
+// Informations structurées d'un message (job, kind, execution_id, repo_url, commit, duration...)
+type Fields map[string]interface{}
+
+// Niveau en vigueur, éventuellement modifié temporairement par l'API
+type LevelState struct {
+    Level      string `json:"level"`
+    Configured string `json:"configured"`           // Niveau de config.yaml, rétabli à l'expiration
+    ExpiresAt  string `json:"expires_at,omitempty"` // Fin du changement temporaire
+}
+
+var (
+    mu           sync.RWMutex
+    level        = LevelInfo
+    configured   = LevelInfo
+    outputFormat = FormatText
+    expiresAt    time.Time
+    revert       *time.Timer
+    revertGen    uint64 // Incrémenté à chaque annulation : un rétablissement déjà déclenché l'ignore
+    outputs      []output
+)
+
+// Appliquer log_level et log_format de la configuration
+func Configure(levelName, formatName string) error {
+    l, err := ParseLevel(levelName)
+    if err != nil {
+        return err
+    }
+    switch formatName {
+    case "", FormatText:
+        formatName = FormatText
+    case FormatJSON:
+    default:
+        return fmt.Errorf("format de log inconnu : %s (text ou json)", formatName)
+    }
+
+    mu.Lock()
+    defer mu.Unlock()
+    level, configured, outputFormat = l, l, formatName
+    stopRevert()
+    return nil
+}
+
+// Changer le niveau de log ; avec une durée, le niveau configuré est rétabli à son expiration
+func SetLevel(l Level, d time.Duration) {
+    mu.Lock()
+    defer mu.Unlock()
+    stopRevert()
+    level = l
+    if d > 0 {
+        expiresAt = time.Now().Add(d)
+        gen := revertGen
+        revert = time.AfterFunc(d, func() {
+            mu.Lock()
+            // Timer expiré pendant qu'un SetLevel ou Configure plus récent tenait mu : son niveau est conservé
+            if gen != revertGen {
+                mu.Unlock()
+                return
+            }
+            level = configured
+            restored := configured
+            expiresAt, revert = time.Time{}, nil
+            mu.Unlock()
+            Log("INFO", "Niveau de log rétabli à %s", restored)
+        })
+    }
+}
+
+// Annuler le rétablissement programmé du niveau (mu verrouillé)
+func stopRevert() {
+    if revert != nil {
+        revert.Stop()
+    }
+    revertGen++
+    expiresAt, revert = time.Time{}, nil
+}
+
+// Niveau de log en vigueur
+func CurrentLevel() LevelState {
+    mu.RLock()
+    defer mu.RUnlock()
+    state := LevelState{Level: level.String(), Configured: configured.String()}
+    if !expiresAt.IsZero() {
+        state.ExpiresAt = expiresAt.Format(time.RFC3339)
+    }
+    return state
+}
+
+// Indiquer si les messages d'un niveau sont écrits par au moins une destination
+// (pour éviter de préparer des messages coûteux)
+func Enabled(l Level) bool {
+    mu.RLock()
+    defer mu.RUnlock()
+    if len(outputs) == 0 {
+        return l >= level
+    }
+    for _, o := range outputs {
+        if l >= o.threshold(level) {
+            return true
+        }
+    }
+    return false
+}
+
+// Logger personnalisé qui ajoute un timestamp ISO 8601 et un niveau de log (DEBUG, INFO, WARN, ERROR) ;
+// les messages sous le niveau configuré sont ignorés
+func Log(levelName string, format string, v ...interface{}) {
+    LogFields(levelName, nil, format, v...)
+}
+
+// Écrire un message accompagné d'informations structurées
+func LogFields(levelName string, fields Fields, format string, v ...interface{}) {
+    l, _ := ParseLevel(levelName)
+    if !Enabled(l) {
+        return
+    }
+    mu.RLock()
+    global, defaultFormat, outs := level, outputFormat, outputs
+    mu.RUnlock()
+
+    e := Entry{Time: time.Now(), Level: l, Message: Redact(fmt.Sprintf(format, v...)), Fields: fields}
+    // Avant la configuration des destinations : sortie standard du package log
+    if len(outs) == 0 {
+        log.Print(e.Line(defaultFormat))
+        return
+    }
+    for _, o := range outs {
+        if l < o.threshold(global) {
+            continue
+        }
+        f := o.format
+        if f == "" {
+            f = defaultFormat
+        }
+        if err := o.sink.Write(e, f); err != nil {
+            fmt.Fprintf(os.Stderr, "Écriture du log impossible : %v\n", err)
+        }
+    }
+}
+
+// Message de log prêt à être écrit par une destination
+type Entry struct {
+    Time    time.Time
+    Level   Level
+    Message string // Secrets masqués
+    Fields  Fields
+}
+
+// Ligne complète au format text ou json
+func (e Entry) Line(format string) string {
+    if format == FormatJSON {
+        return e.JSON()
+    }
+    return fmt.Sprintf("[%s] [%s] %s", e.Time.Format(time.RFC3339), strings.ToUpper(e.Level.String()), e.Text())
+}
+
+// Clés des informations structurées, triées pour une sortie stable
+func sortedKeys(fields Fields) []string {
+    keys := make([]string, 0, len(fields))
+    for key := range fields {
+        keys = append(keys, key)
+    }
+    sort.Strings(keys)
+    return keys
+}
+
+// Valeur d'une information structurée, secrets masqués
+func fieldValue(value interface{}) interface{} {
+    switch v := value.(type) {
+    case string:
+        return Redact(v)
+    case time.Duration:
+        return v.String()
+    case error:
+        return Redact(v.Error())
+    }
+    return value
+}
+
+// Message suivi des informations structurées (clé=valeur), sans date ni niveau
+func (e Entry) Text() string {
+    var b strings.Builder
+    b.WriteString(e.Message)
+    for _, key := range sortedKeys(e.Fields) {
+        value := fmt.Sprint(fieldValue(e.Fields[key]))
+        if value == "" {
+            continue
+        }
+        if strings.ContainsAny(value, " \"=") {
+            value = fmt.Sprintf("%q", value)
+        }
+        fmt.Fprintf(&b, " %s=%s", key, value)
+    }
+    return b.String()
+}
+
+// Objet JSON : time, level et msg puis les informations structurées
+func (e Entry) JSON() string {
+    var b strings.Builder
+    writeJSONField(&b, "time", e.Time.Format(time.RFC3339))
+    writeJSONField(&b, "level", e.Level.String())
+    writeJSONField(&b, "msg", e.Message)
+    for _, key := range sortedKeys(e.Fields) {
+        if key == "time" || key == "level" || key == "msg" {
+            continue
+        }
+        writeJSONField(&b, key, fieldValue(e.Fields[key]))
+    }
+    b.WriteByte('}')
+    return b.String()
+}
+
+func writeJSONField(b *strings.Builder, key string, value interface{}) {
+    if b.Len() == 0 {
+        b.WriteByte('{')
+    } else {
+        b.WriteByte(',')
+    }
+    k, _ := json.Marshal(key)
+    v, err := json.Marshal(value)
+    if err != nil {
+        v, _ = json.Marshal(fmt.Sprint(value))
+    }
+    b.Write(k)
+    b.WriteByte(':')
+    b.Write(v)
 }
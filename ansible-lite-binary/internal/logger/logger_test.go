@@ -0,0 +1,34 @@
+package logger
+
+import (
+	"testing"
+	"time"
+)
+
+// Un rétablissement déjà déclenché mais bloqué sur mu pendant un SetLevel plus récent ne
+// remplace pas le niveau fixé par ce dernier
+func TestSetLevelStaleRevert(t *testing.T) {
+	if err := Configure("info", ""); err != nil {
+		t.Fatal(err)
+	}
+	defer Configure("info", "")
+
+	SetLevel(LevelDebug, 10*time.Millisecond)
+	mu.Lock()
+	time.Sleep(50 * time.Millisecond) // Le timer expire et attend mu
+	stopRevert()
+	level = LevelWarn
+	mu.Unlock()
+
+	time.Sleep(50 * time.Millisecond)
+	if state := CurrentLevel(); state.Level != LevelWarn.String() {
+		t.Errorf("niveau %s, attendu %s", state.Level, LevelWarn.String())
+	}
+
+	// Sans SetLevel entre-temps, le niveau configuré est bien rétabli
+	SetLevel(LevelDebug, 10*time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	if state := CurrentLevel(); state.Level != LevelInfo.String() {
+		t.Errorf("niveau %s après expiration, attendu %s", state.Level, LevelInfo.String())
+	}
+}
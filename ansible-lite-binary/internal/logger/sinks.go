@@ -0,0 +1,183 @@
+package logger
+
+import (
+    "fmt"
+    "io"
+    "log"
+    "log/syslog"
+    "os"
+    "strings"
+    "sync"
+
+    "github.com/natefinch/lumberjack"
+)
+
+// Destination des logs (fichier, sortie standard, syslog, journal systemd)
+type Sink interface {
+    // Écrire un message, au format text ou json pour les destinations qui en tiennent compte
+    Write(e Entry, format string) error
+}
+
+// Destination et niveau minimal des messages qui lui sont envoyés
+type Output struct {
+    Sink   Sink
+    Level  string // Vide : niveau global (log_level, modifiable par l'API)
+    Format string // Vide : log_format
+}
+
+type output struct {
+    sink   Sink
+    level  Level
+    fixed  bool // Niveau propre à la destination
+    format string
+}
+
+// Niveau minimal de la destination, le niveau global si elle n'en a pas
+func (o output) threshold(global Level) Level {
+    if o.fixed {
+        return o.level
+    }
+    return global
+}
+
+// Remplacer les destinations des logs ; les précédentes sont fermées
+func SetOutputs(list []Output) error {
+    outs := make([]output, 0, len(list))
+    for _, o := range list {
+        out := output{sink: o.Sink, format: o.Format}
+        if o.Level != "" {
+            l, err := ParseLevel(o.Level)
+            if err != nil {
+                return err
+            }
+            out.level, out.fixed = l, true
+        }
+        switch o.Format {
+        case "", FormatText, FormatJSON:
+        default:
+            return fmt.Errorf("format de log inconnu : %s (text ou json)", o.Format)
+        }
+        outs = append(outs, out)
+    }
+
+    mu.Lock()
+    previous := outputs
+    outputs = outs
+    mu.Unlock()
+    for _, o := range previous {
+        if c, ok := o.sink.(io.Closer); ok {
+            c.Close()
+        }
+    }
+
+    // Les messages écrits directement avec le package log suivent les mêmes destinations
+    if len(outs) > 0 {
+        log.SetOutput(stdLogWriter{})
+    } else {
+        log.SetOutput(os.Stderr)
+    }
+    return nil
+}
+
+// Messages du package log (erreurs fatales du serveur HTTP...), écrits comme des erreurs
+type stdLogWriter struct{}
+
+func (stdLogWriter) Write(p []byte) (int, error) {
+    Log("ERROR", "%s", strings.TrimRight(string(p), "\n"))
+    return len(p), nil
+}
+
+// Destination écrivant une ligne par message
+type writerSink struct {
+    mu sync.Mutex
+    w  io.Writer
+}
+
+func (s *writerSink) Write(e Entry, format string) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    _, err := io.WriteString(s.w, e.Line(format)+"\n")
+    return err
+}
+
+func (s *writerSink) Close() error {
+    if c, ok := s.w.(io.Closer); ok && s.w != os.Stdout && s.w != os.Stderr {
+        return c.Close()
+    }
+    return nil
+}
+
+// Rotation d'un fichier de log
+type Rotation struct {
+    MaxSize    int  // Taille en mégaoctets avant rotation
+    MaxBackups int  // Nombre de fichiers archivés conservés
+    MaxAge     int  // Durée de conservation des archives en jours
+    Compress   bool // Compresser les archives
+}
+
+// Fichier de log avec rotation
+func NewFileSink(path string, rotation Rotation) Sink {
+    return &writerSink{w: &lumberjack.Logger{
+        Filename:   path,
+        MaxSize:    rotation.MaxSize,
+        MaxBackups: rotation.MaxBackups,
+        MaxAge:     rotation.MaxAge,
+        Compress:   rotation.Compress,
+    }}
+}
+
+// Sortie standard ou d'erreur, pour un service lancé par un superviseur de conteneurs
+func NewStreamSink(w io.Writer) Sink {
+    return &writerSink{w: w}
+}
+
+// Syslog local (/dev/log)
+type syslogSink struct {
+    w *syslog.Writer
+}
+
+var syslogFacilities = map[string]syslog.Priority{
+    "user": syslog.LOG_USER, "daemon": syslog.LOG_DAEMON,
+    "local0": syslog.LOG_LOCAL0, "local1": syslog.LOG_LOCAL1, "local2": syslog.LOG_LOCAL2, "local3": syslog.LOG_LOCAL3,
+    "local4": syslog.LOG_LOCAL4, "local5": syslog.LOG_LOCAL5, "local6": syslog.LOG_LOCAL6, "local7": syslog.LOG_LOCAL7,
+}
+
+// Facilities syslog acceptées, pour la validation de la configuration
+var SyslogFacilities = []string{"user", "daemon", "local0", "local1", "local2", "local3", "local4", "local5", "local6", "local7"}
+
+// Connexion au syslog local avec la facility (daemon par défaut) et l'identifiant donnés
+func NewSyslogSink(facility, tag string) (Sink, error) {
+    if facility == "" {
+        facility = "daemon"
+    }
+    priority, ok := syslogFacilities[facility]
+    if !ok {
+        return nil, fmt.Errorf("facility syslog inconnue : %s", facility)
+    }
+    w, err := syslog.New(priority|syslog.LOG_INFO, tag)
+    if err != nil {
+        return nil, fmt.Errorf("connexion au syslog local impossible : %v", err)
+    }
+    return &syslogSink{w: w}, nil
+}
+
+// Le démon syslog ajoute la date et la priorité : seul le message (ou l'objet JSON) est envoyé
+func (s *syslogSink) Write(e Entry, format string) error {
+    line := e.Text()
+    if format == FormatJSON {
+        line = e.JSON()
+    }
+    switch e.Level {
+    case LevelDebug:
+        return s.w.Debug(line)
+    case LevelWarn:
+        return s.w.Warning(line)
+    case LevelError:
+        return s.w.Err(line)
+    }
+    return s.w.Info(line)
+}
+
+func (s *syslogSink) Close() error {
+    return s.w.Close()
+}
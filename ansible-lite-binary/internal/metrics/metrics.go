@@ -0,0 +1,304 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Type de contenu du format texte de Prometheus
+const contentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Bornes par défaut des histogrammes de durée, en secondes
+var DurationBuckets = []float64{0.1, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600, 1800, 3600}
+
+// Famille de séries exposée par /metrics
+type family interface {
+	write(w *bufio.Writer)
+}
+
+var (
+	registryMu sync.Mutex
+	registry   []family
+)
+
+func register(f family) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry = append(registry, f)
+}
+
+// Écrire toutes les métriques au format texte de Prometheus
+func Write(w io.Writer) error {
+	registryMu.Lock()
+	families := append([]family(nil), registry...)
+	registryMu.Unlock()
+
+	b := bufio.NewWriter(w)
+	for _, f := range families {
+		f.write(b)
+	}
+	return b.Flush()
+}
+
+// Handler de /metrics
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		Write(w)
+	})
+}
+
+// Nom, description et labels d'une famille de séries
+type desc struct {
+	name   string
+	help   string
+	kind   string // counter, gauge ou histogram
+	labels []string
+}
+
+func (d desc) header(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", d.name, d.help, d.name, d.kind)
+}
+
+// Clé d'une série : valeurs des labels séparées par un caractère qui ne peut pas y figurer
+func seriesKey(d desc, values []string) string {
+	if len(values) != len(d.labels) {
+		panic(fmt.Sprintf("métrique %s : %d labels attendus, %d reçus", d.name, len(d.labels), len(values)))
+	}
+	return strings.Join(values, "\xff")
+}
+
+// Labels au format {a="x",b="y"}, extra étant ajouté en dernier (le des histogrammes)
+func formatLabels(names, values []string, extra ...string) string {
+	if len(names) == 0 && len(extra) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%s=\"%s\"", name, escapeLabel(values[i]))
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		if b.Len() > 1 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%s=\"%s\"", extra[i], escapeLabel(extra[i+1]))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(value string) string {
+	return labelEscaper.Replace(value)
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// Séries d'une famille triées par valeurs de labels, pour une sortie stable
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Valeur simple par combinaison de labels (compteur ou jauge)
+type valueVec struct {
+	desc
+	mu     sync.Mutex
+	values map[string]float64
+	series map[string][]string // Valeurs des labels de chaque série
+}
+
+func newValueVec(kind, name, help string, labels []string) *valueVec {
+	v := &valueVec{desc: desc{name: name, help: help, kind: kind, labels: labels}, values: make(map[string]float64), series: make(map[string][]string)}
+	register(v)
+	return v
+}
+
+func (v *valueVec) update(values []string, fn func(float64) float64) {
+	key := seriesKey(v.desc, values)
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if _, ok := v.series[key]; !ok {
+		v.series[key] = append([]string(nil), values...)
+	}
+	v.values[key] = fn(v.values[key])
+}
+
+// Supprimer la série d'une combinaison de labels (tâche retirée de repos.yaml...)
+func (v *valueVec) Delete(values ...string) {
+	key := seriesKey(v.desc, values)
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	delete(v.values, key)
+	delete(v.series, key)
+}
+
+func (v *valueVec) write(w *bufio.Writer) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.header(w)
+	for _, key := range sortedKeys(v.series) {
+		fmt.Fprintf(w, "%s%s %s\n", v.name, formatLabels(v.labels, v.series[key]), formatValue(v.values[key]))
+	}
+}
+
+// Compteur, qui ne fait qu'augmenter
+type Counter struct{ *valueVec }
+
+func NewCounter(name, help string, labels ...string) *Counter {
+	return &Counter{newValueVec("counter", name, help, labels)}
+}
+
+func (c *Counter) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+func (c *Counter) Add(delta float64, values ...string) {
+	if delta < 0 {
+		return
+	}
+	c.update(values, func(v float64) float64 { return v + delta })
+}
+
+// Jauge, valeur qui peut monter ou descendre
+type Gauge struct{ *valueVec }
+
+func NewGauge(name, help string, labels ...string) *Gauge {
+	return &Gauge{newValueVec("gauge", name, help, labels)}
+}
+
+func (g *Gauge) Set(value float64, values ...string) {
+	g.update(values, func(float64) float64 { return value })
+}
+
+func (g *Gauge) Add(delta float64, values ...string) {
+	g.update(values, func(v float64) float64 { return v + delta })
+}
+
+func (g *Gauge) Inc(values ...string) { g.Add(1, values...) }
+func (g *Gauge) Dec(values ...string) { g.Add(-1, values...) }
+
+// Jauge calculée au moment de la collecte
+type GaugeFunc struct {
+	desc
+	collect func(set func(value float64, values ...string))
+}
+
+// La fonction collect appelle set pour chaque série à exposer
+func NewGaugeFunc(name, help string, labels []string, collect func(set func(value float64, values ...string))) *GaugeFunc {
+	g := &GaugeFunc{desc: desc{name: name, help: help, kind: "gauge", labels: labels}, collect: collect}
+	register(g)
+	return g
+}
+
+func (g *GaugeFunc) write(w *bufio.Writer) {
+	series := make(map[string][]string)
+	values := make(map[string]float64)
+	g.collect(func(value float64, labels ...string) {
+		key := seriesKey(g.desc, labels)
+		series[key] = labels
+		values[key] = value
+	})
+	g.header(w)
+	for _, key := range sortedKeys(series) {
+		fmt.Fprintf(w, "%s%s %s\n", g.name, formatLabels(g.labels, series[key]), formatValue(values[key]))
+	}
+}
+
+// Histogramme : répartition des observations par bornes cumulées, somme et nombre
+type Histogram struct {
+	desc
+	buckets []float64
+	mu      sync.Mutex
+	series  map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	labels []string
+	counts []uint64 // Une entrée par borne, non cumulée
+	count  uint64
+	sum    float64
+}
+
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	h := &Histogram{
+		desc:    desc{name: name, help: help, kind: "histogram", labels: labels},
+		buckets: append([]float64(nil), buckets...),
+		series:  make(map[string]*histogramSeries),
+	}
+	sort.Float64s(h.buckets)
+	register(h)
+	return h
+}
+
+func (h *Histogram) Observe(value float64, values ...string) {
+	key := seriesKey(h.desc, values)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogramSeries{labels: append([]string(nil), values...), counts: make([]uint64, len(h.buckets))}
+		h.series[key] = s
+	}
+	if i := sort.SearchFloat64s(h.buckets, value); i < len(h.buckets) {
+		s.counts[i]++
+	}
+	s.count++
+	s.sum += value
+}
+
+// Supprimer la série d'une combinaison de labels
+func (h *Histogram) Delete(values ...string) {
+	key := seriesKey(h.desc, values)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.series, key)
+}
+
+func (h *Histogram) write(w *bufio.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.header(w)
+	keys := make([]string, 0, len(h.series))
+	for key := range h.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		s := h.series[key]
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(h.labels, s.labels, "le", formatValue(bound)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(h.labels, s.labels, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, formatLabels(h.labels, s.labels), formatValue(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, formatLabels(h.labels, s.labels), s.count)
+	}
+}
@@ -3,17 +3,57 @@ package middleware
 import (
 	"net/http"
 	"aidalinfo/ansible-lite/internal/config"
+	"aidalinfo/ansible-lite/internal/logger"
+	"aidalinfo/ansible-lite/internal/token"
 )
 
-// Middleware pour vérifier le token d'API
+// Middleware pour vérifier le token d'API : read suffit pour consulter (GET, HEAD),
+// trigger est nécessaire pour agir (POST...)
 func ValidateToken(next http.Handler, cfg *config.GlobalConfig) http.Handler {
+	return RequireScope(next, cfg, "")
+}
+
+// Droit nécessaire selon la méthode : read pour consulter (GET, HEAD), trigger pour agir
+func MethodScope(r *http.Request) string {
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		return token.ScopeRead
+	}
+	return token.ScopeTrigger
+}
+
+// Middleware pour vérifier le token d'API et ses droits ; sans droit indiqué, il dépend de la méthode
+func RequireScope(next http.Handler, cfg *config.GlobalConfig, scope string) http.Handler {
+	if scope == "" {
+		return RequireScopeFunc(next, cfg, MethodScope)
+	}
+	return RequireScopeFunc(next, cfg, func(*http.Request) string { return scope })
+}
+
+// Middleware pour vérifier le token d'API et le droit que demande chaque requête
+func RequireScopeFunc(next http.Handler, cfg *config.GlobalConfig, scopeOf func(*http.Request) string) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Récupérer le token de l'en-tête Authorization
-		token := r.Header.Get("Authorization")
+		// Avec client_ca, un certificat client vérifié lors de la connexion TLS est exigé en plus du token
+		if cfg.Global.ClientCA != "" && (r.TLS == nil || len(r.TLS.VerifiedChains) == 0) {
+			http.Error(w, "Certificat client invalide ou manquant", http.StatusUnauthorized)
+			return
+		}
+
+		// Récupérer le token de l'en-tête Authorization ("Bearer <token>" ou le token seul)
+		identity, err := token.Authenticate(cfg, r.Header.Get("Authorization"))
+		if err == token.ErrInvalid || err == token.ErrExpired {
+			http.Error(w, "Token invalide, expiré ou manquant", http.StatusUnauthorized)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Erreur lors de la vérification du token", http.StatusInternalServerError)
+			return
+		}
 
-		// Vérifier si le token est présent et correspond au token attendu
-		if token == "" || token != cfg.Global.Credentials {
-			http.Error(w, "Token invalide ou manquant", http.StatusUnauthorized)
+		// Vérifier les droits du token
+		required := scopeOf(r)
+		if !identity.Allows(required) {
+			logger.Log("WARN", "Requête %s %s refusée au token %s : droit %s requis", r.Method, r.URL.Path, identity.Name, required)
+			http.Error(w, "Droits insuffisants : "+required+" requis", http.StatusForbidden)
 			return
 		}
 
@@ -0,0 +1,142 @@
+package middleware
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"aidalinfo/ansible-lite/internal/config"
+	"aidalinfo/ansible-lite/internal/db"
+	"aidalinfo/ansible-lite/internal/testutil"
+	"aidalinfo/ansible-lite/internal/token"
+)
+
+func createToken(t *testing.T, cfg *config.GlobalConfig, name string, scopes ...string) string {
+	t.Helper()
+	secret, _, err := token.Create(cfg, name, scopes, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return secret
+}
+
+func serve(handler http.Handler, method, authorization string) int {
+	r := httptest.NewRequest(method, "/test", nil)
+	if authorization != "" {
+		r.Header.Set("Authorization", authorization)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, r)
+	return rec.Code
+}
+
+func TestRequireScope(t *testing.T) {
+	cfg := testutil.Config(t)
+	read := createToken(t, cfg, "lecture", token.ScopeRead)
+	trigger := createToken(t, cfg, "ci", token.ScopeTrigger)
+	admin := createToken(t, cfg, "admin", token.ScopeAdmin)
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	byMethod := ValidateToken(ok, cfg)
+	adminOnly := RequireScope(ok, cfg, token.ScopeAdmin)
+	tests := []struct {
+		name    string
+		handler http.Handler
+		method  string
+		auth    string
+		want    int
+	}{
+		{"sans token", byMethod, http.MethodGet, "", http.StatusUnauthorized},
+		{"token inconnu", byMethod, http.MethodGet, "Bearer inconnu", http.StatusUnauthorized},
+		{"read consulte", byMethod, http.MethodGet, "Bearer " + read, http.StatusOK},
+		{"read HEAD", byMethod, http.MethodHead, read, http.StatusOK},
+		{"read n'agit pas", byMethod, http.MethodPost, "Bearer " + read, http.StatusForbidden},
+		{"trigger agit", byMethod, http.MethodPost, "Bearer " + trigger, http.StatusOK},
+		{"trigger supprime", byMethod, http.MethodDelete, "Bearer " + trigger, http.StatusOK},
+		{"admin agit", byMethod, http.MethodPost, "Bearer " + admin, http.StatusOK},
+		{"read sur une route admin", adminOnly, http.MethodGet, "Bearer " + read, http.StatusForbidden},
+		{"trigger sur une route admin", adminOnly, http.MethodPost, "Bearer " + trigger, http.StatusForbidden},
+		{"admin sur une route admin", adminOnly, http.MethodPost, "Bearer " + admin, http.StatusOK},
+		{"credentials sur une route admin", adminOnly, http.MethodPost, "Bearer " + cfg.Global.Credentials, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := serve(tt.handler, tt.method, tt.auth); got != tt.want {
+				t.Errorf("code %d, attendu %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequireScopeExpiredOrRevoked(t *testing.T) {
+	cfg := testutil.Config(t)
+	ok := ValidateToken(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), cfg)
+
+	past := time.Now().Add(-time.Hour)
+	err := db.CreateAPIToken(cfg.Global.DBPath, &db.APIToken{
+		Name:      "expire",
+		TokenHash: token.Hash("secret-expire"),
+		Scopes:    []string{token.ScopeAdmin},
+		CreatedAt: past.Add(-time.Hour).Format(time.RFC3339),
+		ExpiresAt: past.Format(time.RFC3339),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := serve(ok, http.MethodGet, "Bearer secret-expire"); got != http.StatusUnauthorized {
+		t.Errorf("token expiré : code %d, attendu 401", got)
+	}
+
+	revoked := createToken(t, cfg, "revoque", token.ScopeAdmin)
+	if err := token.Revoke(cfg, "revoque"); err != nil {
+		t.Fatal(err)
+	}
+	if got := serve(ok, http.MethodGet, "Bearer "+revoked); got != http.StatusUnauthorized {
+		t.Errorf("token révoqué : code %d, attendu 401", got)
+	}
+}
+
+func TestRequireScopeFunc(t *testing.T) {
+	cfg := testutil.Config(t)
+	trigger := createToken(t, cfg, "ci", token.ScopeTrigger)
+	handler := RequireScopeFunc(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), cfg, func(r *http.Request) string {
+		if r.URL.Query().Get("admin") == "true" {
+			return token.ScopeAdmin
+		}
+		return MethodScope(r)
+	})
+
+	for target, want := range map[string]int{"/test": http.StatusOK, "/test?admin=true": http.StatusForbidden} {
+		r := httptest.NewRequest(http.MethodPost, target, nil)
+		r.Header.Set("Authorization", "Bearer "+trigger)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		if rec.Code != want {
+			t.Errorf("POST %s : code %d, attendu %d", target, rec.Code, want)
+		}
+	}
+}
+
+// Avec client_ca, le token seul ne suffit pas
+func TestRequireScopeClientCertificate(t *testing.T) {
+	cfg := testutil.Config(t)
+	cfg.Global.ClientCA = "/etc/ansible-lite/client-ca.pem"
+	ok := ValidateToken(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), cfg)
+	auth := "Bearer " + cfg.Global.Credentials
+
+	if got := serve(ok, http.MethodGet, auth); got != http.StatusUnauthorized {
+		t.Errorf("sans certificat client : code %d, attendu 401", got)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/test", nil)
+	r.Header.Set("Authorization", auth)
+	r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{}}}}
+	rec := httptest.NewRecorder()
+	ok.ServeHTTP(rec, r)
+	if rec.Code != http.StatusOK {
+		t.Errorf("avec certificat client vérifié : code %d, attendu 200", rec.Code)
+	}
+}
@@ -0,0 +1,233 @@
+package notify
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"aidalinfo/ansible-lite/internal/config"
+	"aidalinfo/ansible-lite/internal/db"
+	"aidalinfo/ansible-lite/internal/facts"
+	"aidalinfo/ansible-lite/internal/logger"
+	"aidalinfo/ansible-lite/internal/repos"
+)
+
+// Notifications en attente d'envoi ; au-delà, les nouvelles notifications sont abandonnées
+const queueSize = 256
+
+// Envois simultanés
+const senders = 4
+
+// Fin de sortie jointe aux notifications
+const (
+	outputTailLines = 20
+	outputTailBytes = 4096
+)
+
+// Tentatives d'envoi par défaut et délais entre deux tentatives
+const (
+	defaultMaxAttempts = 5
+	retryInitialDelay  = 2 * time.Second
+	retryMaxDelay      = time.Minute
+)
+
+// Contenu d'une notification, disponible dans les modèles ({{ .Job }}, {{ .Status }}...)
+type Notification struct {
+	Event       string `json:"event"` // failure, recovery, success ou change
+	Kind        string `json:"kind"`
+	Job         string `json:"job"`
+	Host        string `json:"host"`
+	Agent       string `json:"agent,omitempty"`
+	ExecutionID int64  `json:"execution_id"`
+	Status      string `json:"status"`
+	Source      string `json:"source"`
+	Trigger     string `json:"trigger"` // Commit, tag ou digest ayant déclenché l'exécution
+	Commit      string `json:"commit"`
+	StartedAt   string `json:"started_at"`
+	FinishedAt  string `json:"finished_at"`
+	DurationMs  int64  `json:"duration_ms"`
+	Duration    string `json:"duration"`
+	ExitCode    *int   `json:"exit_code"`
+	Output      string `json:"output"` // Dernières lignes de la sortie
+}
+
+// Notification à envoyer à un notifier
+type delivery struct {
+	name         string
+	notifier     config.Notifier
+	notification Notification
+}
+
+var (
+	mu        sync.RWMutex
+	notifiers map[string]config.Notifier
+	dbPath    string
+	queue     = make(chan delivery, queueSize)
+	startOnce sync.Once
+)
+
+// Fonctions modèles disponibles : json pour insérer une valeur dans un corps JSON
+var templateFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+}
+
+// Appliquer la configuration des notifiers et s'abonner à la fin des exécutions
+func Start(cfg *config.GlobalConfig) {
+	mu.Lock()
+	notifiers = cfg.Global.Notifiers
+	dbPath = cfg.Global.DBPath
+	mu.Unlock()
+	for _, n := range cfg.Global.Notifiers {
+		logger.AddSecrets(n.Password)
+		if n.Type != config.NotifierWebhook {
+			// Les URLs des webhooks entrants Slack et Mattermost contiennent leur secret
+			logger.AddSecrets(n.URL)
+		}
+	}
+
+	startOnce.Do(func() {
+		for i := 0; i < senders; i++ {
+			go sendLoop()
+		}
+		repos.OnExecutionFinished(executionFinished)
+	})
+}
+
+// Événements d'une exécution terminée, d'après son statut et celui de l'exécution précédente
+func events(e db.Execution, previous string) []string {
+	switch e.Status {
+	case "success":
+		if previous == "failed" || previous == "timeout" {
+			return []string{repos.EventChange, repos.EventSuccess, repos.EventRecovery}
+		}
+		return []string{repos.EventChange, repos.EventSuccess}
+	case "failed", "timeout":
+		return []string{repos.EventChange, repos.EventFailure}
+	}
+	// Exécutions ignorées ou annulées
+	return nil
+}
+
+// Événement de l'abonnement concerné par l'exécution ("" si aucun)
+func match(subscription repos.Subscription, events []string) string {
+	on := subscription.On
+	if len(on) == 0 {
+		on = []string{repos.EventFailure, repos.EventRecovery}
+	}
+	// L'événement le plus précis est annoncé : recovery ou failure plutôt que change
+	for _, event := range []string{repos.EventRecovery, repos.EventFailure, repos.EventSuccess, repos.EventChange} {
+		for _, wanted := range on {
+			if wanted != event {
+				continue
+			}
+			for _, e := range events {
+				if e == event {
+					return event
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// Mettre en file les notifications d'une exécution terminée, sans jamais bloquer la tâche
+func executionFinished(e db.Execution) {
+	subscriptions := repos.JobNotifications(e.JobKind, e.JobName)
+	if len(subscriptions) == 0 {
+		return
+	}
+	mu.RLock()
+	configured, path := notifiers, dbPath
+	mu.RUnlock()
+
+	previous := ""
+	if e.Status == "success" && e.ID != 0 {
+		previous, _ = db.GetPreviousExecutionStatus(path, e.JobKind, e.JobName, e.Agent, e.ID)
+	}
+	happened := events(e, previous)
+
+	for _, subscription := range subscriptions {
+		event := match(subscription, happened)
+		if event == "" {
+			continue
+		}
+		notifier, ok := configured[subscription.Notifier]
+		if !ok {
+			logger.Log("ERROR", "Notifier %s inconnu pour la tâche %s/%s", subscription.Notifier, e.JobKind, e.JobName)
+			continue
+		}
+		d := delivery{name: subscription.Notifier, notifier: notifier, notification: newNotification(e, event)}
+		select {
+		case queue <- d:
+		default:
+			logger.Log("WARN", "File des notifications pleine, notification %s de l'exécution %d abandonnée", d.name, e.ID)
+		}
+	}
+}
+
+func newNotification(e db.Execution, event string) Notification {
+	return Notification{
+		Event:       event,
+		Kind:        e.JobKind,
+		Job:         e.JobName,
+		Host:        facts.Get().Hostname,
+		Agent:       e.Agent,
+		ExecutionID: e.ID,
+		Status:      e.Status,
+		Source:      e.Source,
+		Trigger:     e.Trigger,
+		Commit:      e.Commit,
+		StartedAt:   e.StartedAt,
+		FinishedAt:  e.FinishedAt,
+		DurationMs:  e.DurationMs,
+		Duration:    (time.Duration(e.DurationMs) * time.Millisecond).String(),
+		ExitCode:    e.ExitCode,
+		Output:      outputTail(e.Output),
+	}
+}
+
+// Dernières lignes de la sortie, dans la limite de outputTailBytes
+func outputTail(output string) string {
+	output = strings.TrimRight(output, "\n")
+	lines := strings.Split(output, "\n")
+	if len(lines) > outputTailLines {
+		lines = lines[len(lines)-outputTailLines:]
+	}
+	tail := strings.Join(lines, "\n")
+	if len(tail) > outputTailBytes {
+		tail = tail[len(tail)-outputTailBytes:]
+	}
+	return tail
+}
+
+// Envoyer les notifications de la file, en réessayant avec un délai exponentiel
+func sendLoop() {
+	for d := range queue {
+		attempts := d.notifier.MaxAttempts
+		if attempts == 0 {
+			attempts = defaultMaxAttempts
+		}
+		delay := retryInitialDelay
+		for attempt := 1; ; attempt++ {
+			err := send(d.notifier, d.notification)
+			if err == nil {
+				logger.Log("INFO", "Notification %s envoyée à %s pour l'exécution %d", d.notification.Event, d.name, d.notification.ExecutionID)
+				break
+			}
+			if attempt >= attempts {
+				logger.Log("ERROR", "Notification %s abandonnée après %d tentative(s) : %v", d.name, attempt, err)
+				break
+			}
+			logger.Log("WARN", "Envoi de la notification %s impossible (tentative %d/%d), nouvel essai dans %s : %v", d.name, attempt, attempts, delay, err)
+			time.Sleep(delay)
+			if delay *= 2; delay > retryMaxDelay {
+				delay = retryMaxDelay
+			}
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"aidalinfo/ansible-lite/internal/config"
+)
+
+// Délai maximal d'un envoi HTTP
+const httpTimeout = 30 * time.Second
+
+// Port SMTP par défaut (soumission avec STARTTLS)
+const defaultSMTPPort = 587
+
+// Message par défaut (slack, mattermost et corps des mails)
+const defaultText = `{{ if eq .Event "recovery" }}:white_check_mark:{{ else if eq .Status "success" }}:information_source:{{ else }}:x:{{ end }} {{ .Kind }} {{ .Job }} sur {{ .Host }}{{ with .Agent }} ({{ . }}){{ end }} : {{ .Status }} ({{ .Event }})
+Déclencheur : {{ .Trigger }}
+Durée : {{ .Duration }}{{ with .ExitCode }}, code de sortie {{ . }}{{ end }}
+Exécution : {{ .ExecutionID }}
+{{- with .Output }}
+` + "```" + `
+{{ . }}
+` + "```" + `{{ end }}`
+
+// Sujet par défaut des mails
+const defaultSubject = `[ansible-lite] {{ .Kind }} {{ .Job }} sur {{ .Host }} : {{ .Status }}`
+
+var httpClient = &http.Client{Timeout: httpTimeout}
+
+// Rendre un modèle de notification
+func render(name, text string, n Notification) (string, error) {
+	tmpl, err := template.New(name).Funcs(templateFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("modèle %s invalide : %v", name, err)
+	}
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, n); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// Envoyer une notification avec le notifier configuré
+func send(notifier config.Notifier, n Notification) error {
+	switch notifier.Type {
+	case config.NotifierWebhook:
+		return sendWebhook(notifier, n)
+	case config.NotifierSlack, config.NotifierMattermost:
+		return sendChat(notifier, n)
+	case config.NotifierSMTP:
+		return sendMail(notifier, n)
+	}
+	return fmt.Errorf("type de notifier inconnu %q", notifier.Type)
+}
+
+// Webhook générique : la notification en JSON, ou le corps rendu à partir du modèle
+func sendWebhook(notifier config.Notifier, n Notification) error {
+	var body []byte
+	if notifier.Template != "" {
+		rendered, err := render("template", notifier.Template, n)
+		if err != nil {
+			return err
+		}
+		body = []byte(rendered)
+	} else {
+		data, err := json.Marshal(n)
+		if err != nil {
+			return err
+		}
+		body = data
+	}
+	return post(notifier.URL, notifier.Headers, body)
+}
+
+// Webhook entrant Slack ou Mattermost (même format)
+func sendChat(notifier config.Notifier, n Notification) error {
+	text := notifier.Template
+	if text == "" {
+		text = defaultText
+	}
+	rendered, err := render("template", text, n)
+	if err != nil {
+		return err
+	}
+	payload := map[string]string{"text": rendered}
+	if notifier.Channel != "" {
+		payload["channel"] = notifier.Channel
+	}
+	if notifier.Username != "" {
+		payload["username"] = notifier.Username
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return post(notifier.URL, notifier.Headers, body)
+}
+
+// Requête POST JSON ; tout statut hors 2xx est une erreur
+func post(url string, headers map[string]string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		message, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("réponse %d : %s", resp.StatusCode, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
+
+// Mail texte, en TLS direct (tls: true) ou avec STARTTLS si le serveur le propose
+func sendMail(notifier config.Notifier, n Notification) error {
+	subjectTemplate := notifier.Subject
+	if subjectTemplate == "" {
+		subjectTemplate = defaultSubject
+	}
+	subject, err := render("subject", subjectTemplate, n)
+	if err != nil {
+		return err
+	}
+	text := notifier.Template
+	if text == "" {
+		text = defaultText
+	}
+	body, err := render("template", text, n)
+	if err != nil {
+		return err
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", notifier.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(notifier.To, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", strings.ReplaceAll(strings.TrimSpace(subject), "\n", " "))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	msg.WriteString("\r\n")
+
+	port := notifier.Port
+	if port == 0 {
+		port = defaultSMTPPort
+	}
+	addr := net.JoinHostPort(notifier.Host, strconv.Itoa(port))
+
+	var conn net.Conn
+	if notifier.TLS {
+		conn, err = tls.DialWithDialer(&net.Dialer{Timeout: httpTimeout}, "tcp", addr, &tls.Config{ServerName: notifier.Host})
+	} else {
+		conn, err = net.DialTimeout("tcp", addr, httpTimeout)
+	}
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(2 * httpTimeout))
+	client, err := smtp.NewClient(conn, notifier.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok && !notifier.TLS {
+		if err := client.StartTLS(&tls.Config{ServerName: notifier.Host}); err != nil {
+			return err
+		}
+	}
+	if notifier.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", notifier.Username, notifier.Password, notifier.Host)); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(notifier.From); err != nil {
+		return err
+	}
+	for _, to := range notifier.To {
+		if err := client.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg.Bytes()); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
@@ -0,0 +1,141 @@
+package repos
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"aidalinfo/ansible-lite/internal/config"
+)
+
+// Sélection des agents d'une tâche en mode serveur : tous les labels et faits indiqués
+// doivent correspondre (faits à plat, ex. os_id: debian)
+type Selector struct {
+	Labels map[string]string `yaml:"labels"`
+	Facts  map[string]string `yaml:"facts"`
+}
+
+// Indiquer si un agent correspond à la sélection ; une sélection absente correspond à tous les agents
+func (s *Selector) Matches(labels, facts map[string]string) bool {
+	if s == nil {
+		return true
+	}
+	for key, value := range s.Labels {
+		if labels[key] != value {
+			return false
+		}
+	}
+	for key, value := range s.Facts {
+		if facts[strings.ToUpper(key)] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// Catalogue de tâches du serveur : configuration décodée et arbre YAML d'origine, pour
+// transmettre aux agents leurs tâches telles qu'elles sont écrites dans le fichier
+type Catalogue struct {
+	Config *ReposConfig
+	root   *yaml.Node
+}
+
+// Sections de repos.yaml contenant des tâches, avec leur type
+var catalogueSections = []struct{ key, kind string }{
+	{"repos", kindRepo},
+	{"flux", kindFlux},
+	{"continuous", kindContinuous},
+}
+
+// Lire et valider le catalogue de tâches du serveur
+func LoadCatalogue(path string) (*Catalogue, error) {
+	if issues := CheckCatalogueFile(path); len(issues) > 0 {
+		return nil, issuesError(issues)
+	}
+	reposConfig, err := readReposConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	d := config.ParseDocument(path)
+	if d.Root == nil {
+		return nil, issuesError(d.Issues)
+	}
+	return &Catalogue{Config: reposConfig, root: d.Root}, nil
+}
+
+// repos.yaml d'un agent : les tâches du catalogue dont la sélection correspond à ses labels
+// et à ses faits, et la liste de ces tâches (<kind>/<nom>)
+func (c *Catalogue) Select(labels, facts map[string]string) ([]byte, []string, error) {
+	root := &yaml.Node{Kind: yaml.MappingNode}
+	var jobs []string
+	for _, section := range catalogueSections {
+		selected := &yaml.Node{Kind: yaml.MappingNode}
+		var err error
+		config.Entries(config.Field(c.root, section.key), func(key, value *yaml.Node) {
+			var job struct {
+				Selector *Selector `yaml:"selector"`
+			}
+			if decodeErr := value.Decode(&job); decodeErr != nil {
+				err = decodeErr
+				return
+			}
+			if job.Selector.Matches(labels, facts) {
+				selected.Content = append(selected.Content, key, value)
+				jobs = append(jobs, jobKey(section.kind, key.Value))
+			}
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(selected.Content) > 0 {
+			root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: section.key}, selected)
+		}
+	}
+
+	data, err := yaml.Marshal(root)
+	if err != nil {
+		return nil, nil, fmt.Errorf("impossible de sérialiser la configuration : %v", err)
+	}
+	sort.Strings(jobs)
+	return data, jobs, nil
+}
+
+// Empreinte de chaque tâche, indexée par <kind>/<nom>
+func (c *ReposConfig) Fingerprints() map[string]string {
+	fingerprints := make(map[string]string)
+	for name, repo := range c.Repos {
+		fingerprints[jobKey(kindRepo, name)] = fingerprint(repo)
+	}
+	for name, flux := range c.Flux {
+		fingerprints[jobKey(kindFlux, name)] = fingerprint(flux)
+	}
+	for name, continuous := range c.Continuous {
+		fingerprints[jobKey(kindContinuous, name)] = fingerprint(continuous)
+	}
+	return fingerprints
+}
+
+// Tâches ajoutées, modifiées et supprimées entre deux ensembles d'empreintes
+func DiffFingerprints(previous, next map[string]string) ReloadResult {
+	var result ReloadResult
+	for key := range previous {
+		if _, ok := next[key]; !ok {
+			result.Removed = append(result.Removed, key)
+		}
+	}
+	for key, fp := range next {
+		old, ok := previous[key]
+		switch {
+		case !ok:
+			result.Added = append(result.Added, key)
+		case old != fp:
+			result.Updated = append(result.Updated, key)
+		}
+	}
+	sort.Strings(result.Added)
+	sort.Strings(result.Updated)
+	sort.Strings(result.Removed)
+	return result
+}
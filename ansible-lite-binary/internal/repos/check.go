@@ -0,0 +1,249 @@
+package repos
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/robfig/cron/v3"
+	"gopkg.in/yaml.v3"
+
+	"aidalinfo/ansible-lite/internal/config"
+)
+
+// Valider config.yaml puis le repos.yaml qu'il référence
+func CheckConfig(configPath string) []config.Issue {
+	issues, cfg := config.CheckFile(configPath)
+	if cfg == nil || cfg.Global.ReposConfig == "" {
+		return issues
+	}
+	switch {
+	case cfg.Global.Type == config.TypeServer:
+		issues = append(issues, CheckCatalogueFile(cfg.Global.ReposConfig)...)
+	case cfg.Global.ServerURL != "":
+		// Agent : repos.yaml n'existe qu'après la première configuration reçue du serveur
+		if _, err := os.Stat(cfg.Global.ReposConfig); err == nil {
+			issues = append(issues, CheckReposFile(cfg.Global.ReposConfig)...)
+		}
+	default:
+		issues = append(issues, CheckReposFile(cfg.Global.ReposConfig)...)
+		issues = append(issues, checkNotifiers(cfg.Global.ReposConfig, cfg.Global.Notifiers)...)
+	}
+	return issues
+}
+
+// Vérifier que les notifiers des tâches sont définis dans config.yaml
+func checkNotifiers(path string, notifiers map[string]config.Notifier) []config.Issue {
+	d := config.ParseDocument(path)
+	if d.Root == nil {
+		return nil
+	}
+	for _, section := range catalogueSections {
+		config.Entries(config.Field(d.Root, section.key), func(key, node *yaml.Node) {
+			notifications := config.Field(node, "notifications")
+			if notifications == nil || notifications.Kind != yaml.SequenceNode {
+				return
+			}
+			for _, subscription := range notifications.Content {
+				name := config.Field(subscription, "notifier")
+				if name == nil || name.Value == "" {
+					continue
+				}
+				if _, ok := notifiers[name.Value]; !ok {
+					d.Errorf(name, "%s %s : notifier %q absent de config.yaml", section.kind, key.Value, name.Value)
+				}
+			}
+		})
+	}
+	return d.Sorted()
+}
+
+// Valider repos.yaml : clés inconnues, clés obligatoires, syntaxe des watchers, regex,
+// URLs, fichiers référencés et doublons
+func CheckReposFile(path string) []config.Issue {
+	return checkReposFile(config.ParseDocument(path))
+}
+
+// Valider le catalogue d'un serveur : mêmes règles que repos.yaml, sauf l'existence des
+// fichiers référencés, vérifiée par chaque agent à la réception de sa configuration
+func CheckCatalogueFile(path string) []config.Issue {
+	d := config.ParseDocument(path)
+	d.Remote = true
+	return checkReposFile(d)
+}
+
+func checkReposFile(d *config.Document) []config.Issue {
+	if d.Root == nil {
+		return d.Issues
+	}
+	d.CheckType(d.Root, reflect.TypeOf(ReposConfig{}))
+
+	// Dépôts : l'état est conservé par URL, une même URL ne peut pas être surveillée deux fois
+	seenRepos := make(map[string]string)
+	config.Entries(config.Field(d.Root, "repos"), func(key, node *yaml.Node) {
+		what := "dépôt " + key.Value
+		d.Require(node, what, "url", "watcher", "branch", "path")
+		checkWatcher(d, node, what)
+		checkRepoURL(d, config.Field(node, "url"), what)
+		d.CheckParentExists(node, what, "path")
+		checkJobOptions(d, node, what)
+
+		// Dans un catalogue, deux dépôts distribués à des agents différents peuvent partager une URL
+		if url := config.Field(node, "url"); url != nil && url.Value != "" && !d.Remote {
+			id := repoIdentity(url.Value)
+			if other, ok := seenRepos[id]; ok {
+				d.Errorf(url, "%s : URL déjà surveillée par le dépôt %s", what, other)
+			} else if id != "" {
+				seenRepos[id] = key.Value
+			}
+		}
+	})
+
+	config.Entries(config.Field(d.Root, "flux"), func(key, node *yaml.Node) {
+		what := "flux " + key.Value
+		d.Require(node, what, "urls", "watcher", "regex", "init_repo", "branch", "path")
+		checkWatcher(d, node, what)
+		checkRepoURL(d, config.Field(node, "init_repo"), what)
+		d.CheckParentExists(node, what, "path")
+		d.CheckEnum(node, what, "checkout", "branch", checkoutTag)
+		checkJobOptions(d, node, what)
+
+		if regex := config.Field(node, "regex"); regex != nil && regex.Value != "" {
+			if _, err := regexp.Compile(regex.Value); err != nil {
+				d.Errorf(regex, "%s : regex invalide : %v", what, err)
+			}
+		}
+
+		seenURLs := make(map[string]bool)
+		if urls := config.Field(node, "urls"); urls != nil && urls.Kind == yaml.SequenceNode {
+			for _, url := range urls.Content {
+				checkRepoURL(d, url, what)
+				id := repoIdentity(url.Value)
+				if seenURLs[id] && id != "" {
+					d.Errorf(url, "%s : URL en double %s", what, url.Value)
+				}
+				seenURLs[id] = true
+			}
+		}
+	})
+
+	config.Entries(config.Field(d.Root, "continuous"), func(key, node *yaml.Node) {
+		what := "continuous " + key.Value
+		d.Require(node, what, "images", "watcher", "init_repo", "branch", "path")
+		checkWatcher(d, node, what)
+		checkRepoURL(d, config.Field(node, "init_repo"), what)
+		d.CheckParentExists(node, what, "path")
+		checkJobOptions(d, node, what)
+
+		seenImages := make(map[string]bool)
+		if images := config.Field(node, "images"); images != nil && images.Kind == yaml.SequenceNode {
+			for _, image := range images.Content {
+				if seenImages[image.Value] {
+					d.Errorf(image, "%s : image en double %s", what, image.Value)
+				}
+				seenImages[image.Value] = true
+			}
+		}
+	})
+
+	return d.Sorted()
+}
+
+// Vérifier la syntaxe cron du watcher (5 champs ou @every, @hourly...)
+func checkWatcher(d *config.Document, node *yaml.Node, what string) {
+	watcher := config.Field(node, "watcher")
+	if watcher == nil || watcher.Value == "" {
+		return
+	}
+	if _, err := cron.ParseStandard(watcher.Value); err != nil {
+		d.Errorf(watcher, "%s : watcher invalide %q : %v", what, watcher.Value, err)
+	}
+}
+
+// Vérifier qu'une URL de dépôt peut être interprétée
+func checkRepoURL(d *config.Document, url *yaml.Node, what string) {
+	if url == nil || url.Value == "" {
+		return
+	}
+	if _, err := parseRepoURL(url.Value); err != nil {
+		d.Errorf(url, "%s : %v", what, err)
+	}
+}
+
+// Vérifier les options communes aux dépôts, flux et continuous
+func checkJobOptions(d *config.Document, node *yaml.Node, what string) {
+	// Une tâche exécute soit un script d'init, soit un playbook
+	playbook := config.Field(node, "playbook")
+	if playbook == nil && config.Field(node, "tasks") == nil {
+		d.Require(node, what, "init")
+	} else if playbook != nil {
+		d.Require(playbook, what+" (playbook)", "path")
+		if vault := config.Field(playbook, "vault_password_file"); vault != nil && filepath.IsAbs(vault.Value) {
+			d.CheckFileExists(playbook, what+" (playbook)", "vault_password_file")
+		}
+	}
+
+	d.CheckEnum(node, what, "provider", "github", "gitlab", "gitea", "forgejo", "bitbucket")
+	d.CheckEnum(node, what, "detect", detectAPI, detectLsRemote)
+	d.CheckEnum(node, what, "strategy", strategyReclone, strategyFetchReset)
+	d.CheckEnum(node, what, "concurrency", concurrencySkip, concurrencyQueue)
+	d.CheckDuration(node, what, "timeout")
+	d.CheckFileExists(node, what, "ssh_key")
+	d.CheckFileExists(node, what, "known_hosts")
+
+	if providerURL := config.Field(node, "provider_url"); providerURL != nil && providerURL.Value != "" {
+		if !strings.HasPrefix(providerURL.Value, "http://") && !strings.HasPrefix(providerURL.Value, "https://") {
+			d.Errorf(providerURL, "%s : provider_url doit commencer par http:// ou https://", what)
+		}
+	}
+	if maxFailures := config.Field(node, "max_failures"); maxFailures != nil {
+		if n, err := strconv.Atoi(maxFailures.Value); err == nil && n < 0 {
+			d.Errorf(maxFailures, "%s : max_failures ne peut pas être négatif", what)
+		}
+	}
+
+	if notifications := config.Field(node, "notifications"); notifications != nil && notifications.Kind == yaml.SequenceNode {
+		for _, subscription := range notifications.Content {
+			d.Require(subscription, what+" (notifications)", "notifier")
+			if on := config.Field(subscription, "on"); on != nil && on.Kind == yaml.SequenceNode {
+				for _, event := range on.Content {
+					switch event.Value {
+					case EventFailure, EventRecovery, EventSuccess, EventChange:
+					default:
+						d.Errorf(event, "%s (notifications) : événement inconnu %q (valeurs possibles : %s, %s, %s, %s)",
+							what, event.Value, EventFailure, EventRecovery, EventSuccess, EventChange)
+					}
+				}
+			}
+		}
+	}
+
+	retry := config.Field(node, "retry")
+	if retry == nil {
+		return
+	}
+	what = fmt.Sprintf("%s (retry)", what)
+	d.CheckDuration(retry, what, "initial_delay")
+	d.CheckDuration(retry, what, "max_delay")
+	if attempts := config.Field(retry, "max_attempts"); attempts != nil {
+		if n, err := strconv.Atoi(attempts.Value); err == nil && n < 0 {
+			d.Errorf(attempts, "%s : max_attempts ne peut pas être négatif", what)
+		}
+	}
+	if factor := config.Field(retry, "backoff_factor"); factor != nil {
+		if f, err := strconv.ParseFloat(factor.Value, 64); err == nil && f < 1 {
+			d.Errorf(factor, "%s : backoff_factor doit être supérieur ou égal à 1", what)
+		}
+	}
+	if on := config.Field(retry, "on"); on != nil && on.Kind == yaml.SequenceNode {
+		for _, phase := range on.Content {
+			if phase.Value != phaseDetect && phase.Value != phaseClone && phase.Value != phaseScript {
+				d.Errorf(phase, "%s : phase inconnue %q (valeurs possibles : %s, %s, %s)", what, phase.Value, phaseDetect, phaseClone, phaseScript)
+			}
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package repos
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"aidalinfo/ansible-lite/internal/logger"
+)
+
+// Stratégies de mise à jour du répertoire de travail
+const (
+	strategyReclone    = "reclone"
+	strategyFetchReset = "fetch-reset"
+)
+
+// Exécuter une commande git et renvoyer sa sortie combinée, secrets masqués
+func runGit(env []string, dir string, args ...string) (string, error) {
+	var output bytes.Buffer
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = env
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	err := cmd.Run()
+	out := logger.Redact(strings.TrimSpace(output.String()))
+	if err != nil {
+		return out, fmt.Errorf("git %s : %v\n%s", args[0], err, out)
+	}
+	return out, nil
+}
+
+// Mettre à jour un dépôt déjà cloné (fetch puis reset --hard) sans supprimer les fichiers non suivis
+func fetchReset(url, branch, path string, env []string) error {
+	if _, err := os.Stat(filepath.Join(path, ".git")); err != nil {
+		return fmt.Errorf("aucun dépôt git dans %s", path)
+	}
+
+	// Un dépôt corrompu ou pointant vers un autre remote doit être recloné
+	if _, err := runGit(env, path, "rev-parse", "--git-dir"); err != nil {
+		return fmt.Errorf("dépôt git invalide dans %s : %v", path, err)
+	}
+	remote, err := runGit(env, path, "remote", "get-url", "origin")
+	if err != nil {
+		return err
+	}
+	if remote != url {
+		return fmt.Errorf("le dépôt %s pointe vers %s au lieu de %s", path, remote, url)
+	}
+
+	logger.Log("INFO", "Mise à jour du dépôt %s (branche : %s) dans le répertoire %s", url, branch, path)
+	if _, err := runGit(env, path, "fetch", "--depth", "1", "origin", branch); err != nil {
+		return err
+	}
+	if _, err := runGit(env, path, "reset", "--hard", "FETCH_HEAD"); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Révision à déployer : un commit exact, un tag, ou la tête de la branche si les deux sont vides
+type checkoutTarget struct {
+	Commit string
+	Tag    string
+}
+
+// Extraire exactement la révision demandée et renvoyer le SHA réellement extrait
+func pinCheckout(env []string, path, branch string, target checkoutTarget) (string, error) {
+	expected, what := "", ""
+	switch {
+	case target.Tag != "":
+		ref := "refs/tags/" + target.Tag
+		if _, err := runGit(env, path, "fetch", "--depth", "1", "--no-tags", "origin", "+"+ref+":"+ref); err != nil {
+			return "", err
+		}
+		sha, err := runGit(env, path, "rev-parse", ref+"^{commit}")
+		if err != nil {
+			return "", err
+		}
+		expected, what = sha, "du tag "+target.Tag+" (commit "+sha+")"
+	case target.Commit != "":
+		expected, what = target.Commit, "du commit "+target.Commit
+	}
+
+	if expected != "" {
+		head, _ := runGit(env, path, "rev-parse", "HEAD")
+		if head != expected {
+			logger.Log("INFO", "Le clone de la branche %s est sur %s, extraction %s", branch, head, what)
+			// Toutes les forges n'acceptent pas le fetch d'un SHA : repli sur l'historique complet de la branche
+			if _, err := runGit(env, path, "fetch", "--depth", "1", "origin", expected); err != nil {
+				if _, err := runGit(env, path, "fetch", "--unshallow", "origin", "+refs/heads/"+branch); err != nil {
+					if _, err := runGit(env, path, "fetch", "origin", "+refs/heads/"+branch); err != nil {
+						return "", err
+					}
+				}
+			}
+			if _, err := runGit(env, path, "checkout", "-q", "-f", "--detach", expected); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	// Vérifier ce qui a réellement été extrait avant de lancer le script
+	head, err := runGit(env, path, "rev-parse", "HEAD")
+	if err != nil {
+		return "", err
+	}
+	if expected != "" && head != expected {
+		return "", fmt.Errorf("le commit extrait %s ne correspond pas au commit attendu %s", head, expected)
+	}
+	return head, nil
+}
@@ -4,7 +4,7 @@ import (
     "fmt"
     "os/exec"
     "strings"
-    "sync"
+    "time"
     "github.com/robfig/cron/v3"
     "aidalinfo/ansible-lite/internal/logger"
 )
@@ -18,48 +18,75 @@ type Continuous struct {
     Branch    string   `yaml:"branch"`
     Path      string   `yaml:"path"`
     Auth      bool     `yaml:"auth"`
+    JobOptions `yaml:",inline"`
 }
 
-func planContinuousCron(c *cron.Cron, wg *sync.WaitGroup, continuousName string, continuous Continuous, ghToken string) {
-    _, err := c.AddFunc(continuous.Watcher, func() {
-        logger.Log("INFO", fmt.Sprintf("Tâche planifiée exécutée pour le dépôt continuous %s", continuousName))
-        wg.Add(1)
-        go func() {
-            defer wg.Done()
-            err := processContinuous(continuousName, continuous, ghToken)
-            if err != nil {
-                logger.Log("ERROR", fmt.Sprintf("Erreur lors du traitement du continuous %s : %v", continuousName, err))
-            }
-        }()
+// Ajouter la tâche continuous au cron et renvoyer l'identifiant de l'entrée créée
+func planContinuousCron(c *cron.Cron, continuousName string, continuous Continuous, dbPath string, ghToken string) (cron.EntryID, error) {
+    spec := jobSpec{Kind: kindContinuous, Name: continuousName, DBPath: dbPath, Options: continuous.JobOptions}
+    spec.run = func(force bool) error {
+        return processContinuous(dbPath, continuousName, continuous, ghToken, force)
+    }
+    id, err := c.AddFunc(continuous.Watcher, func() {
+        logger.Log("DEBUG", fmt.Sprintf("Tâche planifiée exécutée pour le dépôt continuous %s", continuousName))
+        spec.cronPoll()
     })
     if err != nil {
         logger.Log("ERROR", fmt.Sprintf("Erreur lors de l'ajout du cron pour le continuous %s : %v", continuousName, err))
+        return 0, err
     }
+    registerJob(spec)
+    return id, nil
 }
 
-func processContinuous(continuousName string, continuous Continuous, ghToken string) error {
-	logger.Log("INFO", fmt.Sprintf("Démarrage du traitement pour le continuous %s", continuousName))
+// Avec force, le script est exécuté pour la première image même si son digest n'a pas changé
+func processContinuous(dbPath, continuousName string, continuous Continuous, ghToken string, force bool) error {
+	logger.LogFields("INFO", jobFields(kindContinuous, continuousName), "Démarrage du traitement pour le continuous %s", continuousName)
+	var lastErr error
 	for _, image := range continuous.Images {
 			localSHA, err := getLocalDockerImageSHA(image)
 			if err != nil {
+					recordPoll(kindContinuous, continuousName, false, err)
 					logger.Log("ERROR", fmt.Sprintf("Erreur lors de la récupération du SHA local pour l'image Docker %s : %v", image, err))
+					lastErr = err
 					continue
 			}
 
-			remoteSHA, err := getDockerImageSHA(image)
+			var remoteSHA string
+			err = withRetry(continuous.Retry, phaseDetect, kindContinuous, continuousName, func() error {
+					var err error
+					remoteSHA, err = getDockerImageSHA(image)
+					return err
+			})
+			recordPoll(kindContinuous, continuousName, remoteSHA != localSHA, err)
 			if err != nil {
 					logger.Log("ERROR", fmt.Sprintf("Erreur lors de la récupération du SHA distant pour l'image Docker %s : %v", image, err))
+					lastErr = err
 					continue
 			}
-			if localSHA != remoteSHA {
+			if localSHA != remoteSHA || force {
 					logger.Log("INFO", fmt.Sprintf("Nouveau SHA détecté pour %s (continuous: %s) : %s", image, continuousName, remoteSHA))
-					err := cloneRepo(continuous.InitRepo, continuous.Branch, continuous.Path, ghToken, continuous.Auth)
+					unlock := lockPath(kindContinuous, continuousName, continuous.Path)
+					defer unlock()
+
+					var commit string
+					err := withRetry(continuous.Retry, phaseClone, kindContinuous, continuousName, func() error {
+							var err error
+							commit, err = cloneRepo(continuous.InitRepo, continuous.Branch, checkoutTarget{}, continuous.Path, ghToken, continuous.Auth, continuous.JobOptions)
+							return err
+					})
 					if err != nil {
 							logger.Log("ERROR", fmt.Sprintf("Erreur lors du clonage du dépôt %s : %v", continuous.InitRepo, err))
 							return err
 					}
 
-					err = runInitScript(continuous.Init, continuous.Path)
+					ec := execContext{
+							DBPath: dbPath, Kind: kindContinuous, Name: continuousName, Source: image, Trigger: remoteSHA, Commit: commit,
+							Previous: localSHA, RepoURL: continuous.InitRepo, Branch: continuous.Branch, Env: continuous.Env, Vars: continuous.Vars, Timeout: continuous.scriptTimeout(),
+					}
+					err = withRetry(continuous.Retry, phaseScript, kindContinuous, continuousName, func() error {
+							return runJobAction(ec, continuous.Init, continuous.JobOptions, continuous.Path)
+					})
 					if err != nil {
 							logger.Log("ERROR", fmt.Sprintf("Erreur lors de l'exécution du script init pour le continuous %s : %v", continuousName, err))
 							return err
@@ -67,15 +94,18 @@ func processContinuous(continuousName string, continuous Continuous, ghToken str
 
 					break // Sortir de la boucle dès qu'un SHA change
 			} else {
-					logger.Log("INFO", fmt.Sprintf("Aucun changement de SHA pour l'image Docker %s", image))
+					logger.Log("DEBUG", fmt.Sprintf("Aucun changement de SHA pour l'image Docker %s", image))
 			}
 	}
 
-	return nil
+	return lastErr
 }
 
 
-func getLocalDockerImageSHA(image string) (string, error) {
+func getLocalDockerImageSHA(image string) (digest string, err error) {
+    started := time.Now()
+    defer func() { observeDockerCheck(image, "local", started, err) }()
+
     cmd := exec.Command("docker", "inspect", "--format={{index .RepoDigests 0}}", image)
     output, err := cmd.Output()
     if err != nil {
@@ -90,7 +120,10 @@ func getLocalDockerImageSHA(image string) (string, error) {
     return sha[1], nil // Retourner le SHA256
 }
 
-func getDockerImageSHA(image string) (string, error) {
+func getDockerImageSHA(image string) (digest string, err error) {
+    started := time.Now()
+    defer func() { observeDockerCheck(image, "registry", started, err) }()
+
     // Pull l'image la plus récente depuis le registre Docker
     pullCmd := exec.Command("docker", "pull", image)
     pullOutput, err := pullCmd.CombinedOutput()
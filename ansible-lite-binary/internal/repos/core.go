@@ -16,7 +16,8 @@ type ReposConfig struct {
     Continuous map[string]Continuous `yaml:"continuous"`
 }
 
-func LoadReposConfig(path string, dbPath string, ghToken string) (*ReposConfig, error) {
+// Lire et décoder le fichier repos.yaml
+func readReposConfig(path string) (*ReposConfig, error) {
     var reposConfig ReposConfig
     data, err := ioutil.ReadFile(path)
     if err != nil {
@@ -29,6 +30,21 @@ func LoadReposConfig(path string, dbPath string, ghToken string) (*ReposConfig,
         logger.Log("ERROR", fmt.Sprintf("Erreur lors du parsing du fichier repos.yaml : %v", err))
         return nil, err
     }
+    return &reposConfig, nil
+}
+
+// Lire et valider repos.yaml au démarrage, avec les mêmes règles que --check et le rechargement
+func LoadReposConfig(path string, dbPath string, ghToken string) (*ReposConfig, error) {
+    if issues := CheckReposFile(path); len(issues) > 0 {
+        return nil, issuesError(issues)
+    }
+    parsed, err := readReposConfig(path)
+    if err != nil {
+        return nil, err
+    }
+    reposConfig := *parsed
+
+    registerSecrets(&reposConfig)
 
     // Utilisation d'un WaitGroup pour synchroniser les goroutines
     var wg sync.WaitGroup
@@ -48,7 +64,7 @@ func LoadReposConfig(path string, dbPath string, ghToken string) (*ReposConfig,
     wg.Add(1)
     go func() {
         defer wg.Done() // Décrémenter le compteur pour la tâche de flux
-        err := loadFluxs(dbPath, path, ghToken)
+        err := loadFluxs(dbPath, reposConfig.Flux, ghToken)
         if err != nil {
             logger.Log("ERROR", fmt.Sprintf("Erreur lors du chargement des flux : %v", err))
         } else {
@@ -63,25 +79,23 @@ func LoadReposConfig(path string, dbPath string, ghToken string) (*ReposConfig,
 
 // Planifier les tâches pour chaque dépôt, flux, et continuous
 func ScheduleRepos(reposConfig *ReposConfig, dbPath string, ghToken string) {
-    c := cron.New()
-    var wg sync.WaitGroup
+    schedulerMu.Lock()
+    scheduler = cron.New()
+    schedulerMu.Unlock()
 
-    // Planifier les dépôts
-    for name, repo := range reposConfig.Repos {
-        repo.Name = name
-        planRepoCron(c, &wg, repo, dbPath, ghToken)
-    }
+    applyReposConfig(reposConfig, dbPath, ghToken, false)
 
-    // Planifier les flux
-    for fluxName, flux := range reposConfig.Flux {
-        planFluxCron(c, &wg, fluxName, flux, dbPath, ghToken)
+    scheduler.Start()
+}
+// Masquer dans les logs les secrets propres aux tâches
+func registerSecrets(reposConfig *ReposConfig) {
+    for _, repo := range reposConfig.Repos {
+        logger.AddSecrets(repo.Token, repo.WebhookSecret)
     }
-
-    // Planifier les tâches continues (Docker images)
-    for continuousName, continuous := range reposConfig.Continuous {
-        planContinuousCron(c, &wg, continuousName, continuous, ghToken)
+    for _, flux := range reposConfig.Flux {
+        logger.AddSecrets(flux.Token, flux.WebhookSecret)
     }
-
-    c.Start()
-    wg.Wait()
-}
\ No newline at end of file
+    for _, continuous := range reposConfig.Continuous {
+        logger.AddSecrets(continuous.Token, continuous.WebhookSecret)
+    }
+}
@@ -0,0 +1,101 @@
+package repos
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Helper GIT_ASKPASS : renvoie les identifiants lus dans l'environnement, il ne contient aucun secret
+const askPassScript = `#!/bin/sh
+case "$1" in
+Username*) printf '%s\n' "$ANSIBLE_LITE_GIT_USERNAME" ;;
+*) printf '%s\n' "$ANSIBLE_LITE_GIT_PASSWORD" ;;
+esac
+`
+
+var (
+	askPassMu   sync.Mutex
+	askPassPath string
+)
+
+// Chemin du helper GIT_ASKPASS, recréé s'il a disparu (nettoyage de /tmp par exemple)
+func askPassHelper() (string, error) {
+	askPassMu.Lock()
+	defer askPassMu.Unlock()
+
+	if askPassPath != "" {
+		if _, err := os.Stat(askPassPath); err == nil {
+			return askPassPath, nil
+		}
+	}
+
+	f, err := ioutil.TempFile("", "ansible-lite-askpass-*.sh")
+	if err != nil {
+		return "", fmt.Errorf("impossible de créer le helper GIT_ASKPASS : %v", err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(askPassScript); err != nil {
+		return "", fmt.Errorf("impossible d'écrire le helper GIT_ASKPASS : %v", err)
+	}
+	if err := f.Chmod(0700); err != nil {
+		return "", fmt.Errorf("impossible de rendre le helper GIT_ASKPASS exécutable : %v", err)
+	}
+
+	askPassPath = f.Name()
+	return askPassPath, nil
+}
+
+// Identifiants HTTP(S) attendus par la forge pour un token (vides sans authentification)
+func httpCredentials(repoURL string, opts JobOptions, ghToken string, auth bool) (string, string) {
+	token := opts.forgeToken(ghToken)
+	lower := strings.ToLower(repoURL)
+	if !auth || token == "" || !(strings.HasPrefix(lower, "https://") || strings.HasPrefix(lower, "http://")) {
+		return "", ""
+	}
+
+	name := strings.ToLower(opts.Provider)
+	if name == "" {
+		if ref, err := parseRepoURL(repoURL); err == nil {
+			name = detectProvider(ref.Host)
+		}
+	}
+
+	switch name {
+	case "gitlab", "gitea", "forgejo":
+		return "oauth2", token
+	case "bitbucket":
+		// Un token "utilisateur:app_password" porte déjà le nom d'utilisateur
+		if i := strings.Index(token, ":"); i > 0 {
+			return token[:i], token[i+1:]
+		}
+		return "x-token-auth", token
+	}
+	return "x-access-token", token
+}
+
+// Environnement des commandes git d'une tâche : jamais interactif, avec la clé SSH
+// et les identifiants HTTP passés par GIT_ASKPASS plutôt que dans l'URL
+func gitEnv(repoURL string, opts JobOptions, ghToken string, auth bool) ([]string, error) {
+	env := append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	if cmd := sshCommand(opts); cmd != "" {
+		env = append(env, fmt.Sprintf("GIT_SSH_COMMAND=%s", cmd))
+	}
+
+	user, password := httpCredentials(repoURL, opts, ghToken, auth)
+	if password == "" {
+		return env, nil
+	}
+	helper, err := askPassHelper()
+	if err != nil {
+		return nil, err
+	}
+	env = append(env,
+		"GIT_ASKPASS="+helper,
+		"ANSIBLE_LITE_GIT_USERNAME="+user,
+		"ANSIBLE_LITE_GIT_PASSWORD="+password,
+	)
+	return env, nil
+}
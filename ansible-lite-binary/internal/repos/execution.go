@@ -0,0 +1,303 @@
+package repos
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"aidalinfo/ansible-lite/internal/db"
+	"aidalinfo/ansible-lite/internal/facts"
+	"aidalinfo/ansible-lite/internal/logger"
+)
+
+// Taille maximale de la sortie conservée pour une exécution (les derniers octets sont gardés)
+const maxCapturedOutput = 256 * 1024
+
+// Types de tâches enregistrés dans la table executions
+const (
+	kindRepo       = "repo"
+	kindFlux       = "flux"
+	kindContinuous = "continuous"
+)
+
+// Statuts possibles d'une exécution
+const (
+	statusRunning = "running"
+	statusSuccess = "success"
+	statusFailed  = "failed"
+	statusSkipped = "skipped"
+)
+
+// Contexte d'une exécution du script d'init
+type execContext struct {
+	DBPath  string
+	Kind    string // repo, flux ou continuous
+	Name    string // Nom de la tâche dans repos.yaml
+	Source  string // URL du dépôt, URL surveillée par le flux ou image Docker
+	Trigger string // SHA du commit, tag ou digest ayant déclenché l'exécution
+	Commit  string // SHA réellement extrait dans le répertoire de travail
+
+	Previous string // Commit, tag ou digest précédemment déployé
+	RepoURL  string // Dépôt contenant le script (url du dépôt ou init_repo)
+	Branch   string
+	Env      map[string]string // Variables d'environnement définies dans repos.yaml (env:)
+	Vars     map[string]string // Variables exposées en ANSIBLE_LITE_VAR_<NOM> (vars:)
+	Timeout  time.Duration     // Durée maximale du script (0 = illimitée)
+}
+
+// Buffer qui ne conserve que la fin de la sortie d'un script
+type tailBuffer struct {
+	mu        sync.Mutex
+	data      []byte
+	truncated bool
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.data = append(b.data, p...)
+	if len(b.data) > maxCapturedOutput {
+		b.data = b.data[len(b.data)-maxCapturedOutput:]
+		b.truncated = true
+	}
+	return len(p), nil
+}
+
+func (b *tailBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.truncated {
+		return "[... sortie tronquée ...]\n" + string(b.data)
+	}
+	return string(b.data)
+}
+
+// Sortie d'un script capturée dans un fichier temporaire. Contrairement à un buffer, un *os.File est
+// transmis tel quel au script : cmd.Wait() n'attend donc pas les processus que le script laisse en
+// arrière-plan (nohup ./app &) et qui héritent de sa sortie
+type outputFile struct {
+	f *os.File
+}
+
+func newOutputFile() (*outputFile, error) {
+	f, err := os.CreateTemp("", "ansible-lite-output-")
+	if err != nil {
+		return nil, fmt.Errorf("impossible de créer le fichier de sortie du script : %v", err)
+	}
+	// Seul le descripteur reste ouvert : le fichier disparaît avec le dernier processus qui l'utilise
+	os.Remove(f.Name())
+	return &outputFile{f: f}, nil
+}
+
+// Lire au plus size octets à partir de la position offset (une position négative part de la fin)
+func (o *outputFile) read(offset, size int64) ([]byte, bool) {
+	info, err := o.f.Stat()
+	if err != nil {
+		return nil, false
+	}
+	total := info.Size()
+	if offset < 0 {
+		offset = total + offset
+		if offset < 0 {
+			offset = 0
+		}
+	}
+	length := total - offset
+	if length > size {
+		length = size
+	}
+	data := make([]byte, length)
+	n, _ := o.f.ReadAt(data, offset)
+	return data[:n], offset > 0 || offset+length < total
+}
+
+// Début de la sortie (au plus size octets) et indicateur de dépassement
+func (o *outputFile) head(size int64) ([]byte, bool) {
+	return o.read(0, size)
+}
+
+// Fin de la sortie, au format de tailBuffer
+func (o *outputFile) String() string {
+	data, truncated := o.read(-maxCapturedOutput, maxCapturedOutput)
+	if truncated {
+		return "[... sortie tronquée ...]\n" + string(data)
+	}
+	return string(data)
+}
+
+func (o *outputFile) Close() error {
+	return o.f.Close()
+}
+
+// Informations structurées des logs d'une tâche
+func jobFields(kind, name string) logger.Fields {
+	return logger.Fields{"job": name, "kind": kind}
+}
+
+// Informations structurées des logs d'une exécution, avec son statut, sa durée et son code de sortie
+// une fois terminée
+func executionFields(ec execContext, e *db.Execution) logger.Fields {
+	fields := jobFields(ec.Kind, ec.Name)
+	fields["repo_url"] = ec.RepoURL
+	fields["commit"] = ec.Commit
+	fields["trigger"] = ec.Trigger
+	if e.ID != 0 {
+		fields["execution_id"] = e.ID
+	}
+	if e.FinishedAt != "" {
+		fields["status"] = e.Status
+		fields["duration"] = (time.Duration(e.DurationMs) * time.Millisecond).String()
+		fields["duration_ms"] = e.DurationMs
+		if e.ExitCode != nil {
+			fields["exit_code"] = *e.ExitCode
+		}
+	}
+	return fields
+}
+
+// Enregistrer le début d'une exécution ; une erreur de base n'empêche pas le script de tourner
+func startExecution(ec execContext) *db.Execution {
+	e := &db.Execution{
+		JobKind:   ec.Kind,
+		JobName:   ec.Name,
+		Source:    ec.Source,
+		Trigger:   ec.Trigger,
+		Commit:    ec.Commit,
+		StartedAt: time.Now().Format(time.RFC3339),
+		Status:    statusRunning,
+	}
+	if _, err := db.LogExecution(ec.DBPath, e); err != nil {
+		logger.Log("ERROR", "Impossible d'enregistrer le début de l'exécution pour %s %s : %v", ec.Kind, ec.Name, err)
+	}
+	observeExecutionStarted(ec)
+	return e
+}
+
+// Enregistrer la fin d'une exécution à partir de l'erreur renvoyée par la commande
+func finishExecution(ec execContext, e *db.Execution, started time.Time, status string, runErr error, output string) {
+	e.FinishedAt = time.Now().Format(time.RFC3339)
+	e.DurationMs = time.Since(started).Milliseconds()
+	e.Status = status
+	e.Output = output
+
+	if status != statusSkipped && status != statusTimeout && status != statusCancelled {
+		code := 0
+		var exitErr *exec.ExitError
+		if errors.As(runErr, &exitErr) {
+			code = exitErr.ExitCode()
+		} else if runErr != nil {
+			code = -1
+		}
+		e.ExitCode = &code
+	}
+
+	if e.ID != 0 {
+		if err := db.FinishExecution(ec.DBPath, e); err != nil {
+			logger.Log("ERROR", "Impossible d'enregistrer la fin de l'exécution %d : %v", e.ID, err)
+		}
+	}
+	observeExecutionFinished(ec, e, started)
+
+	hooksMu.RLock()
+	defer hooksMu.RUnlock()
+	for _, h := range executionHooks {
+		h.hook(*e)
+	}
+}
+
+// Fonction appelée à la fin de chaque exécution (remontée au serveur...)
+type executionHook struct {
+	id   int
+	hook func(db.Execution)
+}
+
+var (
+	hooksMu        sync.RWMutex
+	executionHooks []executionHook
+	nextHookID     int
+)
+
+// Être prévenu de la fin de chaque exécution ; la fonction ne doit pas bloquer.
+// La fonction renvoyée retire le hook.
+func OnExecutionFinished(hook func(db.Execution)) func() {
+	hooksMu.Lock()
+	defer hooksMu.Unlock()
+	nextHookID++
+	id := nextHookID
+	executionHooks = append(executionHooks, executionHook{id: id, hook: hook})
+	return func() {
+		hooksMu.Lock()
+		defer hooksMu.Unlock()
+		for i, h := range executionHooks {
+			if h.id == id {
+				executionHooks = append(executionHooks[:i:i], executionHooks[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// Préfixe des variables d'environnement transmises aux scripts
+const envPrefix = "ANSIBLE_LITE_"
+
+// Convertir un nom de variable utilisateur en nom de variable d'environnement (A-Z, 0-9, _)
+func envName(name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToUpper(name) {
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_' {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune('_')
+		}
+	}
+	return b.String()
+}
+
+// Variables d'environnement du script : contexte de l'exécution et variables de la tâche
+func scriptEnv(ec execContext, executionID int64, repoPath string) []string {
+	env := os.Environ()
+
+	// Variables libres de la tâche, qui ne peuvent pas écraser les variables ANSIBLE_LITE_
+	for key, value := range ec.Env {
+		env = append(env, key+"="+value)
+	}
+	for key, value := range ec.Vars {
+		env = append(env, envPrefix+"VAR_"+envName(key)+"="+value)
+	}
+
+	vars := map[string]string{
+		"JOB_NAME":      ec.Name,
+		"JOB_KIND":      ec.Kind,
+		"REPO_URL":      ec.RepoURL,
+		"BRANCH":        ec.Branch,
+		"COMMIT":        ec.Commit,
+		"EXECUTION_ID":  strconv.FormatInt(executionID, 10),
+		"CHECKOUT_PATH": repoPath,
+		"FACTS_FILE":    facts.File(),
+	}
+	// Faits de la machine, en ANSIBLE_LITE_FACT_<NOM>
+	for key, value := range facts.Get().Flatten() {
+		vars["FACT_"+envName(key)] = value
+	}
+	switch ec.Kind {
+	case kindRepo:
+		vars["PREVIOUS_COMMIT"] = ec.Previous
+	case kindFlux:
+		vars["FLUX_TAG"] = ec.Trigger
+		vars["FLUX_PREVIOUS_TAG"] = ec.Previous
+		vars["FLUX_SOURCE_URL"] = ec.Source
+	case kindContinuous:
+		vars["IMAGE"] = ec.Source
+		vars["IMAGE_OLD_DIGEST"] = ec.Previous
+		vars["IMAGE_NEW_DIGEST"] = ec.Trigger
+	}
+	for key, value := range vars {
+		env = append(env, envPrefix+key+"="+value)
+	}
+	return env
+}
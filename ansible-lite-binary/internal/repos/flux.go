@@ -2,19 +2,15 @@ package repos
 
 import (
     "fmt"
-    "io/ioutil"
-    "sync"
-    "gopkg.in/yaml.v2"
-    "net/http"
-    "encoding/json"
-    "strings"
     "github.com/robfig/cron/v3"
     "aidalinfo/ansible-lite/internal/db"
     "aidalinfo/ansible-lite/internal/logger"
-    "log"
     "regexp"
 )
 
+// Valeur de checkout pour extraire le tag détecté plutôt que la branche
+const checkoutTag = "tag"
+
 type Flux struct {
 	Name     string   `yaml:"name"`   // Nom du flux
 	URLs     []string `yaml:"urls"`   // Liste d'URLs
@@ -25,28 +21,13 @@ type Flux struct {
 	Branch   string   `yaml:"branch"`
 	Path     string   `yaml:"path"`
 	Auth		 bool			`yaml:"auth"` 
+	Checkout string   `yaml:"checkout"` // branch (défaut) ou tag pour extraire le tag détecté dans init_repo
+	JobOptions `yaml:",inline"`
 }
 
-type GithubTag struct {
-	Name string `json:"name"`
-}
-
-// Charger les flux depuis le fichier repos.yaml et les insérer dans la base de données
-func loadFluxs(dbPath, reposConfigPath, ghToken string) error {
-	var reposConfig ReposConfig
-	data, err := ioutil.ReadFile(reposConfigPath)
-	if err != nil {
-			log.Printf("Impossible de lire le fichier repos.yaml : %v", err)
-			return err
-	}
-
-	err = yaml.Unmarshal(data, &reposConfig)
-	if err != nil {
-			logger.Log("ERROR", "Erreur lors du parsing du fichier repos.yaml : %v", err)
-			return err
-	}
-
-	for fluxName, flux := range reposConfig.Flux {
+// Insérer dans la base de données les flux de repos.yaml qui n'y sont pas encore
+func loadFluxs(dbPath string, fluxs map[string]Flux, ghToken string) error {
+	for fluxName, flux := range fluxs {
 			for _, url := range flux.URLs {
 					exists, err := db.FluxExists(dbPath, fluxName, url)
 					if err != nil {
@@ -55,7 +36,7 @@ func loadFluxs(dbPath, reposConfigPath, ghToken string) error {
 					}
 
 					if !exists {
-							latestTag, err := getLatestTagFromAPI(url, flux.Regex, ghToken, flux.Auth)
+							latestTag, err := getLatestTagFromAPI(url, flux, ghToken)
 							if err != nil {
 									logger.Log("ERROR", "Erreur lors de la récupération des tags pour %s : %v", url, err)
 									continue 
@@ -75,7 +56,7 @@ func loadFluxs(dbPath, reposConfigPath, ghToken string) error {
 
 							logger.Log("INFO", "Flux %s avec l'URL %s et le dernier tag %s inséré dans la base de données", fluxName, url, latestTag)
 					} else {
-							logger.Log("INFO", "Flux %s avec l'URL %s existe déjà dans la base de données", fluxName, url)
+							logger.Log("DEBUG", "Flux %s avec l'URL %s existe déjà dans la base de données", fluxName, url)
 					}
 			}
 	}
@@ -83,134 +64,139 @@ func loadFluxs(dbPath, reposConfigPath, ghToken string) error {
 	return nil
 }
 
-func planFluxCron(c *cron.Cron, wg *sync.WaitGroup, fluxName string, flux Flux, dbPath string, ghToken string) {
-	_, err := c.AddFunc(flux.Watcher, func() {
-			logger.Log("INFO", "Tâche planifiée exécutée pour le flux %s", fluxName)
-			wg.Add(1)
-			go func() {
-					defer wg.Done()
-					err := processFlux(dbPath, fluxName, flux, ghToken)
-					if err != nil {
-							logger.Log("ERROR", "Erreur lors du traitement du flux %s : %v", fluxName, err)
-					}
-			}()
+// Ajouter le flux au cron et renvoyer l'identifiant de l'entrée créée
+func planFluxCron(c *cron.Cron, fluxName string, flux Flux, dbPath string, ghToken string) (cron.EntryID, error) {
+	spec := jobSpec{Kind: kindFlux, Name: fluxName, DBPath: dbPath, Options: flux.JobOptions, URLs: flux.URLs, Regex: flux.Regex}
+	spec.run = func(force bool) error {
+			return processFlux(dbPath, fluxName, flux, ghToken, force)
+	}
+	id, err := c.AddFunc(flux.Watcher, func() {
+			logger.Log("DEBUG", "Tâche planifiée exécutée pour le flux %s", fluxName)
+			spec.cronPoll()
 	})
 	if err != nil {
 			logger.Log("ERROR", "Erreur lors de l'ajout du cron pour le flux %s : %v", fluxName, err)
+			return 0, err
 	}
+	registerJob(spec)
+	return id, nil
 }
 
-func processFlux(dbPath, fluxName string, flux Flux, ghToken string) error {
-	logger.Log("INFO", "Démarrage du traitement pour le flux %s", fluxName)
+// Traiter un flux : chaque URL est traitée indépendamment, la dernière erreur rencontrée est renvoyée.
+// Avec force, le script est exécuté pour le dernier tag même s'il est déjà déployé.
+func processFlux(dbPath, fluxName string, flux Flux, ghToken string, force bool) error {
+	logger.LogFields("INFO", jobFields(kindFlux, fluxName), "Démarrage du traitement pour le flux %s", fluxName)
 
+	var lastErr error
 	for _, url := range flux.URLs {
-			lastTag, err := db.GetLastTag(dbPath, fluxName, url)
-			if err != nil {
-					logger.Log("ERROR", "Erreur lors de la récupération du dernier tag pour l'URL %s dans le flux %s : %v", url, fluxName, err)
-					continue 
-			}
-
-			// Récupérer le dernier tag correspondant à la regex en utilisant l'API GitHub et le token
-			newTag, err := getLatestTagFromAPI(url, flux.Regex, ghToken, flux.Auth)
-			if err != nil {
-					logger.Log("ERROR", "Erreur lors de la récupération du tag GitHub pour l'URL %s : %v", url, err)
-					continue 
+			if err := processFluxURL(dbPath, fluxName, flux, url, ghToken, force); err != nil {
+					lastErr = err
 			}
+	}
+	return lastErr
+}
 
-			// Si un nouveau tag est détecté
-			if newTag != "" && newTag != lastTag {
-					logger.Log("INFO", "Nouveau tag détecté pour %s (flux: %s) : %s", url, fluxName, newTag)
-
-					// Cloner le dépôt d'initialisation
-					err := cloneRepo(flux.InitRepo, flux.Branch, flux.Path, ghToken, flux.Auth)
-					if err != nil {
-							logger.Log("ERROR", "Erreur lors du clonage du dépôt %s : %v", flux.InitRepo, err)
-							continue 
-					}
+func processFluxURL(dbPath, fluxName string, flux Flux, url string, ghToken string, force bool) error {
+	lastTag, err := db.GetLastTag(dbPath, fluxName, url)
+	if err != nil {
+			logger.Log("ERROR", "Erreur lors de la récupération du dernier tag pour l'URL %s dans le flux %s : %v", url, fluxName, err)
+			return err
+	}
 
-					// Exécuter le script init
-					err = runInitScript(flux.Init, flux.Path)
-					if err != nil {
-							logger.Log("ERROR", "Erreur lors de l'exécution du script init pour le flux %s : %v", fluxName, err)
-							continue
-					}
+	// Récupérer le dernier tag correspondant à la regex en utilisant l'API de la forge et le token
+	var newTag string
+	err = withRetry(flux.Retry, phaseDetect, kindFlux, fluxName, func() error {
+			var err error
+			newTag, err = getLatestTagFromAPI(url, flux, ghToken)
+			return err
+	})
+	recordPoll(kindFlux, fluxName, newTag != "" && newTag != lastTag, err)
+	if err != nil {
+			logger.Log("ERROR", "Erreur lors de la récupération du tag distant pour l'URL %s : %v", url, err)
+			return err
+	}
 
-					// Mettre à jour le dernier tag dans la base de données
-					err = db.UpdateFluxLastTag(dbPath, fluxName, url, newTag)
-					if err != nil {
-							logger.Log("ERROR", "Erreur lors de la mise à jour du dernier tag pour %s : %v", url, err)
-							continue
-					}
-			} else {
-					logger.Log("INFO", "Aucun nouveau tag détecté pour %s dans le flux %s", url, fluxName)
-			}
+	// Une exécution forcée redéploie le dernier tag connu si la forge n'en renvoie aucun
+	if force && newTag == "" {
+			newTag = lastTag
 	}
-	return nil 
-}
 
-// Fonction pour obtenir le dernier tag depuis l'API GitHub en utilisant un token
-func getLatestTagFromAPI(repoURL, regexPattern, ghToken string, auth bool) (string, error) {
-	apiURL := convertRepoURLToAPITags(repoURL)
-	client := &http.Client{}
-	page := 1
-	var allTags []GithubTag
-
-	// Boucle pour paginer et récupérer tous les tags
-	for {
-			paginatedURL := fmt.Sprintf("%s?page=%d", apiURL, page)
-			req, err := http.NewRequest("GET", paginatedURL, nil)
-			if err != nil {
-					logger.Log("ERROR", "Erreur lors de la création de la requête HTTP : %v", err)
-					return "", err 
-			}
+	// Si aucun nouveau tag n'est détecté
+	if newTag == "" || (newTag == lastTag && !force) {
+			logger.Log("DEBUG", "Aucun nouveau tag détecté pour %s dans le flux %s", url, fluxName)
+			return nil
+	}
+	logger.Log("INFO", "Nouveau tag détecté pour %s (flux: %s) : %s", url, fluxName, newTag)
 
-			// Ajouter l'authentification si nécessaire
-			if auth {
-					req.Header.Set("Authorization", "token "+ghToken)
-			}
+	// Cloner le dépôt d'initialisation, sur le tag détecté si demandé
+	target := checkoutTarget{}
+	if flux.Checkout == checkoutTag {
+			target.Tag = newTag
+	}
+	unlock := lockPath(kindFlux, fluxName, flux.Path)
+	defer unlock()
 
-			resp, err := client.Do(req)
-			if err != nil {
-					logger.Log("ERROR", "Erreur lors de la requête HTTP pour %s : %v", repoURL, err)
-					return "", err
-			}
-			defer resp.Body.Close()
+	var commit string
+	err = withRetry(flux.Retry, phaseClone, kindFlux, fluxName, func() error {
+			var err error
+			commit, err = cloneRepo(flux.InitRepo, flux.Branch, target, flux.Path, ghToken, flux.Auth, flux.JobOptions)
+			return err
+	})
+	if err != nil {
+			logger.Log("ERROR", "Erreur lors du clonage du dépôt %s : %v", flux.InitRepo, err)
+			return err
+	}
 
-			if resp.StatusCode != http.StatusOK {
-					logger.Log("ERROR", "Réponse HTTP inattendue pour %s : %s", repoURL, resp.Status)
-					return "", err
-			}
+	// Exécuter le script init
+	ec := execContext{
+			DBPath: dbPath, Kind: kindFlux, Name: fluxName, Source: url, Trigger: newTag, Commit: commit,
+			Previous: lastTag, RepoURL: flux.InitRepo, Branch: flux.Branch, Env: flux.Env, Vars: flux.Vars, Timeout: flux.scriptTimeout(),
+	}
+	err = withRetry(flux.Retry, phaseScript, kindFlux, fluxName, func() error {
+			return runJobAction(ec, flux.Init, flux.JobOptions, flux.Path)
+	})
+	if err != nil {
+			logger.Log("ERROR", "Erreur lors de l'exécution du script init pour le flux %s : %v", fluxName, err)
+			return err
+	}
 
-			var tags []GithubTag
-			err = json.NewDecoder(resp.Body).Decode(&tags)
-			if err != nil {
-					logger.Log("ERROR", "Erreur lors du décodage de la réponse JSON pour %s : %v", repoURL, err)
-					return "", err
-			}
+	// Mettre à jour le dernier tag dans la base de données
+	err = db.UpdateFluxLastTag(dbPath, fluxName, url, newTag)
+	if err != nil {
+			logger.Log("ERROR", "Erreur lors de la mise à jour du dernier tag pour %s : %v", url, err)
+			return err
+	}
+	return nil
+}
 
-			if len(tags) == 0 {
-					break
-			}
+// Fonction pour obtenir le dernier tag depuis l'API de la forge (ou git ls-remote) en utilisant un token
+func getLatestTagFromAPI(repoURL string, flux Flux, ghToken string) (string, error) {
+	p, err := newProvider(repoURL, flux.JobOptions, ghToken, flux.Auth)
+	if err != nil {
+			logger.Log("ERROR", "Impossible de déterminer le fournisseur du dépôt %s : %v", repoURL, err)
+			return "", err
+	}
 
-			allTags = append(allTags, tags...)
-			page++
+	allTags, err := p.listTags()
+	if err != nil {
+			return "", err
 	}
 
 	// Vérifier chaque tag avec la regex
-	re, err := regexp.Compile(regexPattern)
+	re, err := regexp.Compile(flux.Regex)
 	if err != nil {
 			logger.Log("ERROR", fmt.Sprintf("Erreur lors de la compilation de la regex : %v", err))
 			return "", err
 	}
 
 	for _, tag := range allTags {
-			if re.MatchString(tag.Name) {
-					return tag.Name, nil
+			if re.MatchString(tag) {
+					return tag, nil
 			}
 	}
 
-	logger.Log("ERROR", "Aucun tag trouvé correspondant à la regex : %s", regexPattern)
-	return "", err
+	logger.Log("ERROR", "Aucun tag trouvé correspondant à la regex : %s", flux.Regex)
+	return "", nil
 }
 
 // Compiler la regex pour vérifier les tags
@@ -221,13 +207,3 @@ func compileRegex(pattern string) (*regexp.Regexp, error) {
 	}
 	return re, nil
 }
-
-// Convertir l'URL du dépôt en URL de l'API GitHub pour récupérer les tags
-func convertRepoURLToAPITags(repoURL string) string {
-	// Remplacer la partie de l'URL GitHub par celle de l'API
-	repoAPIURL := strings.Replace(repoURL, "https://github.com/", "https://api.github.com/repos/", 1)
-	// Supprimer l'éventuel suffixe .git dans l'URL
-	repoAPIURL = strings.TrimSuffix(repoAPIURL, ".git")
-	// Ajouter le chemin pour accéder aux tags
-	return fmt.Sprintf("%s/tags", repoAPIURL)
-}
\ No newline at end of file
@@ -0,0 +1,352 @@
+package repos
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"aidalinfo/ansible-lite/internal/db"
+	"aidalinfo/ansible-lite/internal/logger"
+)
+
+// Politiques lorsqu'une tâche est déclenchée alors que sa précédente exécution n'est pas terminée
+const (
+	concurrencySkip  = "skip"  // Ignorer le déclenchement (défaut)
+	concurrencyQueue = "queue" // Relancer une seule fois à la fin de l'exécution en cours
+)
+
+// Description d'une tâche planifiée
+type jobSpec struct {
+	Kind    string // repo, flux ou continuous
+	Name    string
+	DBPath  string
+	Options JobOptions
+
+	// Références surveillées, pour le déclenchement par webhook
+	URLs   []string // Dépôts surveillés
+	Branch string   // Branche surveillée (repo)
+	Regex  string   // Regex des tags surveillés (flux)
+
+	run func(force bool) error // Traitement complet de la tâche, force exécute le script même sans changement
+}
+
+// État d'une tâche exposé par l'API
+type JobStatus struct {
+	Kind                string
+	Name                string
+	Running             bool
+	Disabled            bool
+	Paused              bool
+	ConsecutiveFailures int
+	LastError           string
+}
+
+// État d'exécution d'une tâche
+type jobRunner struct {
+	running bool
+	next    func() error // Exécution mise en attente (une seule)
+	slot    *jobSlot     // Ressources tenues par l'exécution en cours
+}
+
+// Place de worker tenue par l'exécution en cours d'une tâche, rendue pendant l'attente entre
+// deux tentatives (withRetry)
+type jobSlot struct {
+	release func() // Libérer la place de worker
+}
+
+var (
+	jobsMu     sync.Mutex
+	jobs       = make(map[string]*jobRunner)
+	configured = make(map[string]jobSpec) // Tâches de repos.yaml actuellement planifiées
+
+	pathLocksMu sync.Mutex
+	pathLocks   = make(map[string]*sync.Mutex)
+)
+
+// Tâche absente de repos.yaml
+var ErrUnknownJob = errors.New("tâche inconnue")
+
+// Identifiant unique d'une tâche, les noms pouvant se répéter entre repos, flux et continuous
+func jobKey(kind, name string) string {
+	return kind + "/" + name
+}
+
+// Abonnements aux notifications d'une tâche planifiée
+func JobNotifications(kind, name string) []Subscription {
+	jobsMu.Lock()
+	defer jobsMu.Unlock()
+	return configured[jobKey(kind, name)].Options.Notifications
+}
+
+// Traitement d'un déclenchement automatique (cron ou webhook), sans forcer le script
+func (spec jobSpec) poll() error {
+	return spec.run(false)
+}
+
+// Déclarer une tâche planifiée, pour la retrouver depuis l'API
+func registerJob(spec jobSpec) {
+	jobsMu.Lock()
+	configured[jobKey(spec.Kind, spec.Name)] = spec
+	jobsMu.Unlock()
+	initJobMetrics(spec)
+}
+
+// Retirer une tâche supprimée de repos.yaml ; une exécution en cours se termine normalement
+func unregisterJob(key string) {
+	jobsMu.Lock()
+	defer jobsMu.Unlock()
+	delete(configured, key)
+}
+
+// Retrouver une tâche à partir de "kind/nom" ou de son seul nom s'il n'est pas ambigu
+func resolveJob(ref string) (jobSpec, error) {
+	jobsMu.Lock()
+	defer jobsMu.Unlock()
+
+	if spec, ok := configured[ref]; ok {
+		return spec, nil
+	}
+	var matches []jobSpec
+	for _, spec := range configured {
+		if spec.Name == ref {
+			matches = append(matches, spec)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return jobSpec{}, fmt.Errorf("%w : %s", ErrUnknownJob, ref)
+	case 1:
+		return matches[0], nil
+	}
+	var keys []string
+	for _, spec := range matches {
+		keys = append(keys, jobKey(spec.Kind, spec.Name))
+	}
+	sort.Strings(keys)
+	return jobSpec{}, fmt.Errorf("nom de tâche ambigu %s, précisez : %s", ref, strings.Join(keys, ", "))
+}
+
+// Lister les tâches planifiées avec leur état
+func ListJobs() ([]JobStatus, error) {
+	jobsMu.Lock()
+	specs := make([]jobSpec, 0, len(configured))
+	runningJobs := make(map[string]bool)
+	for key, spec := range configured {
+		specs = append(specs, spec)
+		if runner, ok := jobs[key]; ok && runner.running {
+			runningJobs[key] = true
+		}
+	}
+	jobsMu.Unlock()
+
+	sort.Slice(specs, func(i, j int) bool {
+		return jobKey(specs[i].Kind, specs[i].Name) < jobKey(specs[j].Kind, specs[j].Name)
+	})
+
+	statuses := make([]JobStatus, 0, len(specs))
+	for _, spec := range specs {
+		state, err := db.GetJobState(spec.DBPath, spec.Kind, spec.Name)
+		if err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, JobStatus{
+			Kind:                spec.Kind,
+			Name:                spec.Name,
+			Running:             runningJobs[jobKey(spec.Kind, spec.Name)],
+			Disabled:            state.Disabled,
+			Paused:              state.Paused,
+			ConsecutiveFailures: state.ConsecutiveFailures,
+			LastError:           state.LastError,
+		})
+	}
+	return statuses, nil
+}
+
+// Réactiver une tâche désactivée par le disjoncteur
+func EnableJob(ref string) error {
+	spec, err := resolveJob(ref)
+	if err != nil {
+		return err
+	}
+	if err := db.SetJobDisabled(spec.DBPath, spec.Kind, spec.Name, false); err != nil {
+		return err
+	}
+	logger.Log("INFO", "Tâche %s réactivée", jobKey(spec.Kind, spec.Name))
+	return nil
+}
+
+// Mettre en pause une tâche : ses déclenchements par cron ou webhook sont ignorés jusqu'à sa reprise
+func PauseJob(ref string) error {
+	return setJobPaused(ref, true)
+}
+
+// Reprendre une tâche mise en pause
+func ResumeJob(ref string) error {
+	return setJobPaused(ref, false)
+}
+
+func setJobPaused(ref string, paused bool) error {
+	spec, err := resolveJob(ref)
+	if err != nil {
+		return err
+	}
+	if err := db.SetJobPaused(spec.DBPath, spec.Kind, spec.Name, paused); err != nil {
+		return err
+	}
+	if paused {
+		logger.Log("INFO", "Tâche %s mise en pause", jobKey(spec.Kind, spec.Name))
+	} else {
+		logger.Log("INFO", "Tâche %s reprise", jobKey(spec.Kind, spec.Name))
+	}
+	return nil
+}
+
+// Déclencher manuellement une tâche ; avec force, le script est exécuté même si
+// le commit, le tag ou le digest n'a pas changé
+func RunJob(ref string, force bool) error {
+	spec, err := resolveJob(ref)
+	if err != nil {
+		return err
+	}
+	logger.Log("INFO", "Déclenchement manuel de la tâche %s (force : %t)", jobKey(spec.Kind, spec.Name), force)
+	return dispatchJob(spec, func() error {
+		return spec.run(force)
+	})
+}
+
+// Enregistrer le résultat d'une exécution et désactiver la tâche après max_failures échecs consécutifs
+func recordJobResult(spec jobSpec, runErr error) {
+	key := jobKey(spec.Kind, spec.Name)
+	if runErr == nil {
+		db.RecordJobSuccess(spec.DBPath, spec.Kind, spec.Name)
+		return
+	}
+
+	failures, err := db.RecordJobFailure(spec.DBPath, spec.Kind, spec.Name, logger.Redact(runErr.Error()))
+	if err != nil || spec.Options.MaxFailures <= 0 || failures < spec.Options.MaxFailures {
+		return
+	}
+	if err := db.SetJobDisabled(spec.DBPath, spec.Kind, spec.Name, true); err == nil {
+		logger.Log("ERROR", "Tâche %s désactivée après %d échecs consécutifs, réactivation avec : alcli jobs enable %s", key, failures, key)
+	}
+}
+
+// Lancer une tâche en arrière-plan, sauf si elle est désactivée, en pause ou si une exécution
+// de la même tâche est déjà en cours : le déclenchement est alors ignoré ou mis en attente
+// selon sa politique. Une erreur indique que le déclenchement n'a pas été pris en compte.
+func dispatchJob(spec jobSpec, run func() error) error {
+	key := jobKey(spec.Kind, spec.Name)
+
+	state, err := db.GetJobState(spec.DBPath, spec.Kind, spec.Name)
+	if err == nil && state.Disabled {
+		logger.Log("INFO", "La tâche %s est désactivée après %d échecs consécutifs, déclenchement ignoré", key, state.ConsecutiveFailures)
+		return fmt.Errorf("tâche %s désactivée, réactivation avec : alcli jobs enable %s", key, key)
+	}
+	if err == nil && state.Paused {
+		logger.Log("INFO", "La tâche %s est en pause, déclenchement ignoré", key)
+		return fmt.Errorf("tâche %s en pause, reprise avec : alcli jobs resume %s", key, key)
+	}
+
+	jobsMu.Lock()
+	runner, ok := jobs[key]
+	if !ok {
+		runner = &jobRunner{}
+		jobs[key] = runner
+	}
+	if runner.running {
+		defer jobsMu.Unlock()
+		if spec.Options.Concurrency == concurrencyQueue {
+			runner.next = run
+			logger.Log("INFO", "La tâche %s est en cours, nouvelle exécution mise en attente", key)
+			return nil
+		}
+		logger.Log("INFO", "La tâche %s est encore en cours, déclenchement ignoré", key)
+		return fmt.Errorf("tâche %s déjà en cours d'exécution", key)
+	}
+	runner.running = true
+	jobsMu.Unlock()
+
+	go func() {
+		for run != nil {
+			slot := &jobSlot{release: acquireWorker()}
+			jobsMu.Lock()
+			runner.slot = slot
+			jobsMu.Unlock()
+
+			err := run()
+
+			jobsMu.Lock()
+			runner.slot = nil
+			jobsMu.Unlock()
+			slot.release()
+			if err != nil {
+				logger.LogFields("ERROR", jobFields(spec.Kind, spec.Name), "Erreur lors du traitement de la tâche %s : %v", key, err)
+			}
+			recordJobResult(spec, err)
+
+			jobsMu.Lock()
+			run, runner.next = runner.next, nil
+			if run == nil {
+				runner.running = false
+			}
+			jobsMu.Unlock()
+		}
+	}()
+	return nil
+}
+
+// Prendre une place parmi les workers globaux et renvoyer la fonction qui la libère
+func acquireWorker() func() {
+	settingsMu.RLock()
+	sem := workers
+	settingsMu.RUnlock()
+	if sem == nil {
+		return func() {}
+	}
+	sem <- struct{}{}
+	return func() { <-sem }
+}
+
+// Verrou d'un répertoire de travail, partagé éventuellement par plusieurs tâches
+func pathLock(path string) *sync.Mutex {
+	pathLocksMu.Lock()
+	defer pathLocksMu.Unlock()
+	mu, ok := pathLocks[path]
+	if !ok {
+		mu = &sync.Mutex{}
+		pathLocks[path] = mu
+	}
+	return mu
+}
+
+// Verrouiller le répertoire de travail d'une tâche pendant le clonage et l'exécution du script.
+// La tâche attend le répertoire sans garder sa place de worker : celle qui le tient peut en avoir
+// besoin pour reprendre après une attente entre deux tentatives
+func lockPath(kind, name, path string) func() {
+	mu := pathLock(path)
+	if !mu.TryLock() {
+		resume := suspendJob(kind, name)
+		mu.Lock()
+		resume()
+	}
+	return mu.Unlock
+}
+
+// Rendre la place de worker d'une tâche le temps d'une attente, pour qu'une tâche en échec
+// n'empêche pas les autres de s'exécuter ; la fonction renvoyée la reprend. Les répertoires
+// verrouillés restent tenus : une autre tâche ne doit pas modifier le clone entre deux tentatives
+func suspendJob(kind, name string) func() {
+	jobsMu.Lock()
+	var slot *jobSlot
+	if runner, ok := jobs[jobKey(kind, name)]; ok {
+		slot = runner.slot
+	}
+	jobsMu.Unlock()
+	if slot == nil {
+		return func() {}
+	}
+	slot.release()
+	return func() { slot.release = acquireWorker() }
+}
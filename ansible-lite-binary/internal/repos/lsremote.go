@@ -0,0 +1,78 @@
+package repos
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"aidalinfo/ansible-lite/internal/logger"
+)
+
+// Modes de détection des changements
+const (
+	detectAPI      = "api"
+	detectLsRemote = "ls-remote"
+)
+
+// Fournisseur sans API HTTP : interroge directement le dépôt avec git ls-remote
+type lsRemoteProvider struct {
+	url string
+	env []string // Environnement git de la tâche (clé SSH, identifiants)
+}
+
+func (p *lsRemoteProvider) name() string { return detectLsRemote }
+
+func (p *lsRemoteProvider) authHeader() (string, string) { return "", "" }
+
+// Exécuter git ls-remote et renvoyer les couples (sha, ref)
+func (p *lsRemoteProvider) lsRemote(options []string, patterns ...string) ([][2]string, error) {
+	cmdArgs := append([]string{"ls-remote"}, options...)
+	cmdArgs = append(cmdArgs, p.url)
+	cmdArgs = append(cmdArgs, patterns...)
+	cmd := exec.Command("git", cmdArgs...)
+	cmd.Env = p.env
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("erreur lors du git ls-remote sur %s : %v (%s)", p.url, err, logger.Redact(strings.TrimSpace(stderr.String())))
+	}
+
+	var refs [][2]string
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 {
+			refs = append(refs, [2]string{fields[0], fields[1]})
+		}
+	}
+	return refs, nil
+}
+
+func (p *lsRemoteProvider) latestCommit(branch string) (string, error) {
+	ref := "refs/heads/" + branch
+	refs, err := p.lsRemote([]string{"--heads"}, ref)
+	if err != nil {
+		return "", err
+	}
+	for _, r := range refs {
+		if r[1] == ref {
+			return r[0], nil
+		}
+	}
+	return "", fmt.Errorf("branche %s introuvable sur %s", branch, p.url)
+}
+
+// Sans date de création disponible, les tags sont triés par version décroissante
+func (p *lsRemoteProvider) listTags() ([]string, error) {
+	refs, err := p.lsRemote([]string{"--tags", "--refs", "--sort=-v:refname"})
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, r := range refs {
+		names = append(names, strings.TrimPrefix(r[1], "refs/tags/"))
+	}
+	return names, nil
+}
@@ -0,0 +1,141 @@
+package repos
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"aidalinfo/ansible-lite/internal/db"
+	"aidalinfo/ansible-lite/internal/metrics"
+)
+
+// Résultats d'une vérification (commit, tag ou digest)
+const (
+	pollChanged   = "changed"
+	pollUnchanged = "unchanged"
+	pollError     = "error"
+)
+
+var (
+	pollsTotal = metrics.NewCounter("ansible_lite_polls_total",
+		"Vérifications des tâches par résultat (changed, unchanged, error).", "kind", "job", "result")
+	forgeRequestsTotal = metrics.NewCounter("ansible_lite_forge_api_requests_total",
+		"Requêtes envoyées aux API des forges (GitHub, GitLab, Gitea, Bitbucket) par code de réponse.", "provider", "host", "code")
+	forgeRateLimitRemaining = metrics.NewGauge("ansible_lite_forge_rate_limit_remaining",
+		"Requêtes restantes dans la limite de l'API de la forge (X-RateLimit-Remaining).", "provider", "host")
+	cloneDuration = metrics.NewHistogram("ansible_lite_clone_duration_seconds",
+		"Durée du clonage ou de la mise à jour des dépôts.", metrics.DurationBuckets, "repo_url", "result")
+	dockerChecksTotal = metrics.NewCounter("ansible_lite_docker_digest_checks_total",
+		"Récupérations du digest des images Docker, locales ou depuis le registre.", "image", "source", "result")
+	dockerCheckDuration = metrics.NewHistogram("ansible_lite_docker_digest_check_duration_seconds",
+		"Durée de récupération du digest des images Docker (pull compris pour le registre).", metrics.DurationBuckets, "source")
+	scriptDuration = metrics.NewHistogram("ansible_lite_script_duration_seconds",
+		"Durée des exécutions (script d'init, playbook ou tasks.yaml) par statut.", metrics.DurationBuckets, "kind", "job", "status")
+	scriptExitCode = metrics.NewGauge("ansible_lite_script_last_exit_code",
+		"Code de sortie de la dernière exécution terminée de la tâche.", "kind", "job")
+	executionsInProgress = metrics.NewGauge("ansible_lite_executions_in_progress",
+		"Exécutions en cours.", "kind", "job")
+	lastSuccess = metrics.NewGauge("ansible_lite_last_success_timestamp_seconds",
+		"Date (timestamp Unix) de la dernière exécution réussie de la tâche.", "kind", "job")
+	cronLag = metrics.NewHistogram("ansible_lite_cron_lag_seconds",
+		"Retard entre l'horaire prévu par le cron et le démarrage effectif de la tâche (attente d'un worker comprise).",
+		[]float64{0.01, 0.1, 0.5, 1, 5, 10, 30, 60, 300, 900, 3600}, "kind", "job")
+)
+
+func resultLabel(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "success"
+}
+
+// Compter la vérification d'une tâche
+func recordPoll(kind, name string, changed bool, err error) {
+	result := pollUnchanged
+	switch {
+	case err != nil:
+		result = pollError
+	case changed:
+		result = pollChanged
+	}
+	pollsTotal.Inc(kind, name, result)
+}
+
+// Compter une requête à l'API d'une forge et relever la limite restante
+func recordForgeRequest(p provider, apiURL string, resp *http.Response, err error) {
+	host := apiURL
+	if u, parseErr := url.Parse(apiURL); parseErr == nil {
+		host = u.Host
+	}
+	if err != nil {
+		forgeRequestsTotal.Inc(p.name(), host, "error")
+		return
+	}
+	forgeRequestsTotal.Inc(p.name(), host, strconv.Itoa(resp.StatusCode))
+
+	// GitHub et Gitea utilisent X-RateLimit-Remaining, GitLab RateLimit-Remaining
+	remaining := resp.Header.Get("X-RateLimit-Remaining")
+	if remaining == "" {
+		remaining = resp.Header.Get("RateLimit-Remaining")
+	}
+	if n, err := strconv.ParseFloat(remaining, 64); err == nil {
+		forgeRateLimitRemaining.Set(n, p.name(), host)
+	}
+}
+
+// Mesurer la récupération d'un digest Docker
+func observeDockerCheck(image, source string, started time.Time, err error) {
+	dockerChecksTotal.Inc(image, source, resultLabel(err))
+	dockerCheckDuration.Observe(time.Since(started).Seconds(), source)
+}
+
+// Exécution démarrée
+func observeExecutionStarted(ec execContext) {
+	executionsInProgress.Inc(ec.Kind, ec.Name)
+}
+
+// Exécution terminée : durée, code de sortie et date de la dernière réussite
+func observeExecutionFinished(ec execContext, e *db.Execution, started time.Time) {
+	executionsInProgress.Dec(ec.Kind, ec.Name)
+	if e.Status == statusSkipped {
+		return
+	}
+	scriptDuration.Observe(time.Since(started).Seconds(), ec.Kind, ec.Name, e.Status)
+	if e.ExitCode != nil {
+		scriptExitCode.Set(float64(*e.ExitCode), ec.Kind, ec.Name)
+	}
+	if e.Status == statusSuccess {
+		lastSuccess.Set(float64(time.Now().Unix()), ec.Kind, ec.Name)
+	}
+}
+
+// Reprendre de la base la date de la dernière réussite d'une tâche, pour qu'elle soit exposée dès le démarrage
+func initJobMetrics(spec jobSpec) {
+	finishedAt, err := db.GetLastSuccessTime(spec.DBPath, spec.Kind, spec.Name)
+	if err != nil || finishedAt == "" {
+		return
+	}
+	if t, err := time.Parse(time.RFC3339, finishedAt); err == nil {
+		lastSuccess.Set(float64(t.Unix()), spec.Kind, spec.Name)
+	}
+}
+
+// Retirer les séries d'une tâche supprimée de repos.yaml
+func forgetJobMetrics(key string) {
+	kind, name, _ := strings.Cut(key, "/")
+	lastSuccess.Delete(kind, name)
+	scriptExitCode.Delete(kind, name)
+}
+
+// Déclenchement par le cron : le retard sur l'horaire prévu est mesuré au démarrage effectif du traitement
+func (spec jobSpec) cronPoll() {
+	planned := plannedTime(jobKey(spec.Kind, spec.Name))
+	dispatchJob(spec, func() error {
+		if !planned.IsZero() {
+			cronLag.Observe(time.Since(planned).Seconds(), spec.Kind, spec.Name)
+		}
+		return spec.poll()
+	})
+}
@@ -0,0 +1,57 @@
+package repos
+
+// Options communes aux dépôts, flux et tâches continuous (intégrées à plat dans repos.yaml)
+type JobOptions struct {
+	Provider    string `yaml:"provider"`     // github, gitlab, gitea, forgejo ou bitbucket (détecté depuis l'URL si vide)
+	ProviderURL string `yaml:"provider_url"` // URL de base d'une forge auto-hébergée
+	Token       string `yaml:"token"`        // Token propre à la tâche, remplace gh_token
+	Detect      string `yaml:"detect"`       // api (défaut) ou ls-remote pour interroger directement le dépôt git
+
+	// Authentification SSH par clé de déploiement, pour le clonage et git ls-remote
+	SSHKey                string `yaml:"ssh_key"`                  // Chemin de la clé privée
+	KnownHosts            string `yaml:"known_hosts"`              // Fichier known_hosts dédié
+	StrictHostKeyChecking *bool  `yaml:"strict_host_key_checking"` // true par défaut
+
+	Strategy string `yaml:"strategy"` // reclone (défaut) ou fetch-reset pour mettre à jour le dépôt existant
+
+	Env  map[string]string `yaml:"env"`  // Variables d'environnement passées telles quelles au script
+	Vars map[string]string `yaml:"vars"` // Variables passées au script sous la forme ANSIBLE_LITE_VAR_<NOM>
+
+	Timeout string `yaml:"timeout"` // Durée maximale du script (ex. 30m), script_timeout de config.yaml par défaut
+
+	Concurrency string `yaml:"concurrency"` // skip (défaut) ou queue si la tâche est déclenchée pendant son exécution
+
+	Retry       *RetryPolicy `yaml:"retry"`        // Relance des phases en échec avec délai exponentiel
+	MaxFailures int          `yaml:"max_failures"` // Désactiver la tâche après N échecs consécutifs (0 = jamais)
+
+	WebhookSecret string `yaml:"webhook_secret"` // Secret partagé avec la forge pour déclencher la tâche par webhook
+
+	Playbook *PlaybookAction `yaml:"playbook"` // Playbook Ansible exécuté à la place du script init
+	Tasks    string          `yaml:"tasks"`    // Fichier de tâches déclaratives (tasks.yaml) exécuté à la place du script init
+
+	Selector *Selector `yaml:"selector"` // Agents auxquels la tâche est distribuée en mode serveur (tous si absent)
+
+	Notifications []Subscription `yaml:"notifications"` // Notifications envoyées à la fin des exécutions
+}
+
+// Événements déclenchant une notification
+const (
+	EventFailure  = "failure"  // Exécution en échec ou interrompue par son timeout
+	EventRecovery = "recovery" // Premier succès après un échec
+	EventSuccess  = "success"  // Exécution réussie
+	EventChange   = "change"   // Toute exécution du script (nouveau commit, tag ou digest, ou exécution forcée)
+)
+
+// Abonnement d'une tâche à un notifier de config.yaml
+type Subscription struct {
+	Notifier string   `yaml:"notifier"`
+	On       []string `yaml:"on"` // failure et recovery par défaut
+}
+
+// Token à utiliser pour la forge : celui de la tâche s'il est défini, sinon le token global
+func (o JobOptions) forgeToken(ghToken string) string {
+	if o.Token != "" {
+		return o.Token
+	}
+	return ghToken
+}
@@ -0,0 +1,261 @@
+package repos
+
+import (
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"aidalinfo/ansible-lite/internal/db"
+	"aidalinfo/ansible-lite/internal/logger"
+)
+
+// Taille maximale de la sortie JSON d'ansible-playbook analysée
+const maxPlaybookJSON = 64 * 1024 * 1024
+
+// Longueur maximale du message conservé pour une tâche en échec
+const maxTaskMessage = 1024
+
+// Action playbook: d'une tâche, exécutée à la place du script d'init
+type PlaybookAction struct {
+	Path              string            `yaml:"path"`                // Playbook, relatif au répertoire cloné
+	Inventory         string            `yaml:"inventory"`           // Inventaire (-i)
+	Limit             string            `yaml:"limit"`               // Hôtes ciblés (--limit)
+	Tags              []string          `yaml:"tags"`                // Tags exécutés (--tags)
+	ExtraVars         map[string]string `yaml:"extra_vars"`          // Variables supplémentaires (-e)
+	VaultPasswordFile string            `yaml:"vault_password_file"` // Fichier du mot de passe Ansible Vault
+}
+
+// Arguments de la ligne de commande ansible-playbook
+func (p *PlaybookAction) args() ([]string, error) {
+	var args []string
+	if p.Inventory != "" {
+		args = append(args, "-i", p.Inventory)
+	}
+	if p.Limit != "" {
+		args = append(args, "--limit", p.Limit)
+	}
+	if len(p.Tags) > 0 {
+		args = append(args, "--tags", strings.Join(p.Tags, ","))
+	}
+	if len(p.ExtraVars) > 0 {
+		// En JSON pour que les valeurs contenant des espaces ou des = restent intactes
+		extraVars, err := json.Marshal(p.ExtraVars)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, "-e", string(extraVars))
+	}
+	if p.VaultPasswordFile != "" {
+		args = append(args, "--vault-password-file", p.VaultPasswordFile)
+	}
+	return append(args, p.Path), nil
+}
+
+// Exécuter l'action d'une tâche : le playbook ou le fichier de tâches s'il est configuré,
+// sinon le script d'init
+func runJobAction(ec execContext, scriptName string, opts JobOptions, repoPath string) error {
+	switch {
+	case opts.Playbook != nil:
+		return runPlaybook(ec, opts.Playbook, repoPath)
+	case opts.Tasks != "":
+		return runTasks(ec, opts.Tasks, repoPath)
+	}
+	return runInitScript(ec, scriptName, repoPath)
+}
+
+// Exécuter ansible-playbook avec le callback JSON et enregistrer son récapitulatif avec l'exécution
+func runPlaybook(ec execContext, playbook *PlaybookAction, repoPath string) error {
+	started := time.Now()
+	execution := startExecution(ec)
+
+	args, err := playbook.args()
+	if err != nil {
+		finishExecution(ec, execution, started, statusFailed, err, err.Error())
+		logger.LogFields("ERROR", executionFields(ec, execution), "Arguments du playbook %s invalides : %v", playbook.Path, err)
+		return err
+	}
+
+	logger.LogFields("INFO", executionFields(ec, execution), "Exécution du playbook %s dans le dépôt %s (exécution %d)", playbook.Path, repoPath, execution.ID)
+
+	// La sortie standard contient le JSON du callback, les erreurs restent sur stderr
+	stdout, err := newOutputFile()
+	if err != nil {
+		finishExecution(ec, execution, started, statusFailed, err, err.Error())
+		logger.LogFields("ERROR", executionFields(ec, execution), "Exécution du playbook %s impossible : %v", playbook.Path, err)
+		return err
+	}
+	defer stdout.Close()
+	stderr, err := newOutputFile()
+	if err != nil {
+		finishExecution(ec, execution, started, statusFailed, err, err.Error())
+		logger.LogFields("ERROR", executionFields(ec, execution), "Exécution du playbook %s impossible : %v", playbook.Path, err)
+		return err
+	}
+	defer stderr.Close()
+	cmd := exec.Command("ansible-playbook", args...)
+	cmd.Dir = repoPath
+	cmd.Env = append(scriptEnv(ec, execution.ID, repoPath),
+		"ANSIBLE_STDOUT_CALLBACK=json",
+		"ANSIBLE_NOCOLOR=1",
+		envPrefix+"PLAYBOOK="+filepath.Join(repoPath, playbook.Path),
+	)
+	cmd.Stdout = stdout.f
+	cmd.Stderr = stderr.f
+
+	status, err := runProcess(cmd, execution.ID, ec.Timeout)
+	switch status {
+	case statusTimeout:
+		err = fmt.Errorf("délai de %s dépassé", ec.Timeout)
+	case statusCancelled:
+		err = errExecutionCancelled
+	}
+
+	// Le récapitulatif est analysé même en cas d'échec : c'est là que se trouvent les hôtes en erreur
+	stdoutData, _ := stdout.head(maxPlaybookJSON)
+	recap, parseErr := parsePlaybookJSON(stdoutData)
+	output := stderr.String()
+	if parseErr != nil {
+		if len(stdoutData) > 0 {
+			logger.Log("ERROR", "Sortie JSON du playbook %s illisible : %v", playbook.Path, parseErr)
+		}
+		output += string(tailOf(stdoutData, maxCapturedOutput))
+	} else {
+		execution.Recap = recap
+		output += formatRecap(recap)
+	}
+
+	if err != nil {
+		finishExecution(ec, execution, started, status, err, logger.Redact(output))
+		logger.LogFields("ERROR", executionFields(ec, execution), "Erreur lors de l'exécution du playbook %s : %v", playbook.Path, err)
+		return err
+	}
+
+	finishExecution(ec, execution, started, statusSuccess, nil, logger.Redact(output))
+	logger.LogFields("INFO", executionFields(ec, execution), "Playbook %s exécuté avec succès", playbook.Path)
+	return nil
+}
+
+// Derniers octets d'une sortie
+func tailOf(data []byte, size int) []byte {
+	if len(data) > size {
+		return data[len(data)-size:]
+	}
+	return data
+}
+
+// Sortie du callback json d'Ansible (ANSIBLE_STDOUT_CALLBACK=json)
+type playbookJSON struct {
+	Plays []struct {
+		Play struct {
+			Name string `json:"name"`
+		} `json:"play"`
+		Tasks []struct {
+			Task struct {
+				Name string `json:"name"`
+			} `json:"task"`
+			Hosts map[string]struct {
+				Changed     bool            `json:"changed"`
+				Failed      bool            `json:"failed"`
+				Unreachable bool            `json:"unreachable"`
+				Skipped     bool            `json:"skipped"`
+				Msg         json.RawMessage `json:"msg"`
+			} `json:"hosts"`
+		} `json:"tasks"`
+	} `json:"plays"`
+	Stats map[string]struct {
+		Ok          int `json:"ok"`
+		Changed     int `json:"changed"`
+		Failures    int `json:"failures"`
+		Unreachable int `json:"unreachable"`
+		Skipped     int `json:"skipped"`
+		Rescued     int `json:"rescued"`
+		Ignored     int `json:"ignored"`
+	} `json:"stats"`
+}
+
+// Analyser la sortie du callback JSON en récapitulatif par hôte et par tâche
+func parsePlaybookJSON(data []byte) (*db.PlaybookRecap, error) {
+	// Des avertissements peuvent précéder le document JSON
+	start := strings.Index(string(data), "{")
+	if start < 0 {
+		return nil, fmt.Errorf("aucun document JSON dans la sortie")
+	}
+	var out playbookJSON
+	if err := json.Unmarshal(data[start:], &out); err != nil {
+		return nil, err
+	}
+
+	recap := &db.PlaybookRecap{}
+	for host, stats := range out.Stats {
+		recap.Hosts = append(recap.Hosts, db.HostRecap{
+			Host: host, Ok: stats.Ok, Changed: stats.Changed, Failed: stats.Failures,
+			Unreachable: stats.Unreachable, Skipped: stats.Skipped, Rescued: stats.Rescued, Ignored: stats.Ignored,
+		})
+	}
+	sort.Slice(recap.Hosts, func(i, j int) bool { return recap.Hosts[i].Host < recap.Hosts[j].Host })
+
+	for _, play := range out.Plays {
+		for _, task := range play.Tasks {
+			hosts := make([]string, 0, len(task.Hosts))
+			for host := range task.Hosts {
+				hosts = append(hosts, host)
+			}
+			sort.Strings(hosts)
+
+			for _, host := range hosts {
+				result := task.Hosts[host]
+				t := db.TaskRecap{Play: play.Play.Name, Task: task.Task.Name, Host: host}
+				switch {
+				case result.Unreachable:
+					t.Status = "unreachable"
+				case result.Failed:
+					t.Status = "failed"
+				case result.Skipped:
+					t.Status = "skipped"
+				case result.Changed:
+					t.Status = "changed"
+				default:
+					t.Status = "ok"
+				}
+				if result.Failed || result.Unreachable {
+					t.Message = taskMessage(result.Msg)
+				}
+				recap.Tasks = append(recap.Tasks, t)
+			}
+		}
+	}
+	return recap, nil
+}
+
+// Message d'une tâche, texte brut ou JSON tronqué
+func taskMessage(raw json.RawMessage) string {
+	var msg string
+	if err := json.Unmarshal(raw, &msg); err != nil {
+		msg = string(raw)
+	}
+	msg = logger.Redact(msg)
+	if len(msg) > maxTaskMessage {
+		msg = msg[:maxTaskMessage] + "..."
+	}
+	return msg
+}
+
+// Représentation texte du récapitulatif, ajoutée à la sortie de l'exécution
+func formatRecap(recap *db.PlaybookRecap) string {
+	var b strings.Builder
+	for _, t := range recap.Tasks {
+		if t.Status == "failed" || t.Status == "unreachable" {
+			fmt.Fprintf(&b, "%s: [%s] %s => %s\n", strings.ToUpper(t.Status), t.Host, t.Task, t.Message)
+		}
+	}
+	b.WriteString("PLAY RECAP\n")
+	for _, h := range recap.Hosts {
+		fmt.Fprintf(&b, "%s : ok=%d changed=%d unreachable=%d failed=%d skipped=%d rescued=%d ignored=%d\n",
+			h.Host, h.Ok, h.Changed, h.Unreachable, h.Failed, h.Skipped, h.Rescued, h.Ignored)
+	}
+	return b.String()
+}
@@ -0,0 +1,115 @@
+package repos
+
+import (
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+
+	"aidalinfo/ansible-lite/internal/db"
+)
+
+// Sortie réelle d'ansible-playbook avec ANSIBLE_STDOUT_CALLBACK=json : trois hôtes, dont un
+// injoignable et un en échec, une erreur ignorée, une erreur rattrapée par rescue, une tâche
+// sautée et deux plays
+func TestParsePlaybookJSON(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/playbook-recap.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	recap, err := parsePlaybookJSON(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantHosts := []db.HostRecap{
+		{Host: "db-01", Unreachable: 1},
+		{Host: "web-01", Ok: 5, Changed: 3, Skipped: 1, Rescued: 1, Ignored: 1},
+		{Host: "web-02", Ok: 1, Failed: 1},
+	}
+	if !reflect.DeepEqual(recap.Hosts, wantHosts) {
+		t.Errorf("hôtes :\n%+v\nattendu :\n%+v", recap.Hosts, wantHosts)
+	}
+
+	wantTasks := []db.TaskRecap{
+		{Play: "Déployer l'application", Task: "Gathering Facts", Host: "db-01", Status: "unreachable",
+			Message: "Failed to connect to the host via ssh: ssh: connect to host db-01 port 22: No route to host"},
+		{Play: "Déployer l'application", Task: "Gathering Facts", Host: "web-01", Status: "ok"},
+		{Play: "Déployer l'application", Task: "Gathering Facts", Host: "web-02", Status: "ok"},
+		{Play: "Déployer l'application", Task: "Installer nginx", Host: "web-01", Status: "changed"},
+		{Play: "Déployer l'application", Task: "Installer nginx", Host: "web-02", Status: "failed",
+			Message: "No package matching 'nginx-full' is available"},
+		{Play: "Déployer l'application", Task: "Vérifier la configuration", Host: "web-01", Status: "failed",
+			Message: "non-zero return code"},
+		{Play: "Déployer l'application", Task: "Migrer la base", Host: "web-01", Status: "failed",
+			Message: `"error": "relation \"users\" already exists"`},
+		{Play: "Déployer l'application", Task: "Restaurer la sauvegarde", Host: "web-01", Status: "changed"},
+		{Play: "Déployer l'application", Task: "Activer le debug", Host: "web-01", Status: "skipped"},
+		{Play: "Vérifier le service", Task: "Contrôler /health", Host: "web-01", Status: "ok"},
+	}
+	if len(recap.Tasks) != len(wantTasks) {
+		t.Fatalf("%d résultats de tâches, attendu %d : %+v", len(recap.Tasks), len(wantTasks), recap.Tasks)
+	}
+	// Le message d'un échec est le texte de msg, ou son JSON quand msg est un objet
+	for i, want := range wantTasks {
+		got := recap.Tasks[i]
+		if !strings.Contains(got.Message, want.Message) || (want.Message == "") != (got.Message == "") {
+			t.Errorf("tâche %d : message %q, attendu %q", i, got.Message, want.Message)
+		}
+		got.Message, want.Message = "", ""
+		if got != want {
+			t.Errorf("tâche %d :\n%+v\nattendu :\n%+v", i, got, want)
+		}
+	}
+
+	text := formatRecap(recap)
+	for _, line := range []string{
+		"UNREACHABLE: [db-01] Gathering Facts => Failed to connect to the host via ssh",
+		"FAILED: [web-02] Installer nginx => No package matching 'nginx-full' is available",
+		"PLAY RECAP\n",
+		"db-01 : ok=0 changed=0 unreachable=1 failed=0 skipped=0 rescued=0 ignored=0\n",
+		"web-01 : ok=5 changed=3 unreachable=0 failed=0 skipped=1 rescued=1 ignored=1\n",
+		"web-02 : ok=1 changed=0 unreachable=0 failed=1 skipped=0 rescued=0 ignored=0\n",
+	} {
+		if !strings.Contains(text, line) {
+			t.Errorf("récapitulatif sans %q :\n%s", line, text)
+		}
+	}
+}
+
+// Des lignes peuvent précéder le document JSON, qui peut aussi ne contenir aucun hôte
+func TestParsePlaybookJSONWithoutRecap(t *testing.T) {
+	empty := "[DEPRECATION WARNING]: community.general.yaml has been deprecated.\n" +
+		`{"custom_stats": {}, "global_custom_stats": {}, "plays": [], "stats": {}}`
+	recap, err := parsePlaybookJSON([]byte(empty))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recap.Hosts) != 0 || len(recap.Tasks) != 0 {
+		t.Errorf("récapitulatif non vide : %+v", recap)
+	}
+	if text := formatRecap(recap); text != "PLAY RECAP\n" {
+		t.Errorf("récapitulatif : %q", text)
+	}
+
+	data, err := ioutil.ReadFile("testdata/playbook-recap.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, output := range map[string]string{
+		"sortie vide":               "",
+		"erreur d'ansible-playbook": "ERROR! the playbook: site.yml could not be found\n",
+		"sortie tronquée":           string(data[:len(data)/2]),
+	} {
+		if _, err := parsePlaybookJSON([]byte(output)); err == nil {
+			t.Errorf("%s : pas d'erreur", name)
+		}
+	}
+}
+
+func TestTaskMessageTruncated(t *testing.T) {
+	msg := taskMessage([]byte(`"` + strings.Repeat("x", maxTaskMessage+10) + `"`))
+	if len(msg) != maxTaskMessage+len("...") || !strings.HasSuffix(msg, "...") {
+		t.Errorf("message de %d octets", len(msg))
+	}
+}
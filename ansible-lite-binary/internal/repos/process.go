@@ -0,0 +1,117 @@
+package repos
+
+import (
+	"fmt"
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+
+	"aidalinfo/ansible-lite/internal/logger"
+)
+
+// Statuts d'une exécution interrompue
+const (
+	statusTimeout   = "timeout"
+	statusCancelled = "cancelled"
+)
+
+// Exécution de script en cours, annulable depuis l'API
+type runningExecution struct {
+	cancel chan struct{}
+	once   sync.Once
+}
+
+var (
+	runningMu sync.Mutex
+	running   = make(map[int64]*runningExecution)
+)
+
+// Annuler une exécution en cours à partir de son ID
+func CancelExecution(id int64) error {
+	runningMu.Lock()
+	r, ok := running[id]
+	runningMu.Unlock()
+	if !ok {
+		return fmt.Errorf("aucune exécution en cours avec l'ID %d", id)
+	}
+	r.once.Do(func() { close(r.cancel) })
+	logger.Log("INFO", "Annulation demandée pour l'exécution %d", id)
+	return nil
+}
+
+// Rendre une exécution annulable depuis l'API ; la fonction renvoyée la retire du registre
+func trackExecution(executionID int64) (*runningExecution, func()) {
+	r := &runningExecution{cancel: make(chan struct{})}
+	if executionID == 0 {
+		return r, func() {}
+	}
+	runningMu.Lock()
+	running[executionID] = r
+	runningMu.Unlock()
+	return r, func() {
+		runningMu.Lock()
+		delete(running, executionID)
+		runningMu.Unlock()
+	}
+}
+
+// Envoyer un signal à tout le groupe de processus du script
+func signalGroup(cmd *exec.Cmd, sig syscall.Signal) {
+	if cmd.Process == nil {
+		return
+	}
+	if err := syscall.Kill(-cmd.Process.Pid, sig); err != nil && err != syscall.ESRCH {
+		logger.Log("ERROR", "Impossible d'envoyer le signal %v au groupe du processus %d : %v", sig, cmd.Process.Pid, err)
+	}
+}
+
+// Lancer la commande dans son propre groupe de processus et l'attendre, en l'arrêtant
+// (SIGTERM puis SIGKILL après le délai de grâce) si le timeout expire ou si l'exécution est annulée.
+// Renvoie le statut de l'exécution et l'erreur de la commande.
+func runProcess(cmd *exec.Cmd, executionID int64, timeout time.Duration) (string, error) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err := cmd.Start(); err != nil {
+		return statusFailed, err
+	}
+
+	r, done := trackExecution(executionID)
+	defer done()
+
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+
+	var deadline <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	status := ""
+	select {
+	case err := <-exited:
+		if err != nil {
+			return statusFailed, err
+		}
+		return statusSuccess, nil
+	case <-deadline:
+		logger.Log("ERROR", "Délai de %s dépassé pour l'exécution %d, arrêt du script", timeout, executionID)
+		status = statusTimeout
+	case <-r.cancel:
+		status = statusCancelled
+	}
+
+	// Arrêt propre puis forcé du groupe de processus
+	signalGroup(cmd, syscall.SIGTERM)
+	grace := time.NewTimer(killGracePeriod())
+	defer grace.Stop()
+	select {
+	case err := <-exited:
+		return status, err
+	case <-grace.C:
+		logger.Log("ERROR", "L'exécution %d ne s'est pas arrêtée après SIGTERM, envoi de SIGKILL", executionID)
+		signalGroup(cmd, syscall.SIGKILL)
+		return status, <-exited
+	}
+}
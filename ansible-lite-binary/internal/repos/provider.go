@@ -0,0 +1,364 @@
+package repos
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"aidalinfo/ansible-lite/internal/logger"
+)
+
+// Nombre maximal de pages parcourues lors de la récupération des tags
+const maxTagPages = 100
+
+// Fournisseur capable de donner le dernier commit d'une branche et la liste des tags d'un dépôt
+type provider interface {
+	// Nom du fournisseur (github, gitlab, gitea, bitbucket)
+	name() string
+	// SHA du dernier commit de la branche
+	latestCommit(branch string) (string, error)
+	// Tags du dépôt, du plus récent au plus ancien quand la forge le permet
+	listTags() ([]string, error)
+	// En-tête d'authentification à ajouter aux requêtes (vide si aucune)
+	authHeader() (string, string)
+}
+
+// Dépôt décomposé à partir de son URL (https, ssh:// ou git@host:owner/repo)
+type repoRef struct {
+	Scheme string
+	Host   string
+	Port   string // Port de l'instance pour une URL http(s), le port ssh ne servant pas à l'API
+	Path   string // owner/repo sans le suffixe .git
+}
+
+// Décomposer l'URL d'un dépôt
+func parseRepoURL(repoURL string) (repoRef, error) {
+	// Forme scp-like : git@host:owner/repo.git
+	if !strings.Contains(repoURL, "://") {
+		at := strings.Index(repoURL, "@")
+		colon := strings.Index(repoURL, ":")
+		if colon > at && colon > 0 {
+			return repoRef{
+				Scheme: "https",
+				Host:   repoURL[at+1 : colon],
+				Path:   strings.TrimSuffix(strings.Trim(repoURL[colon+1:], "/"), ".git"),
+			}, nil
+		}
+		return repoRef{}, fmt.Errorf("URL de dépôt invalide : %s", repoURL)
+	}
+
+	u, err := url.Parse(repoURL)
+	if err != nil {
+		return repoRef{}, fmt.Errorf("URL de dépôt invalide %s : %v", repoURL, err)
+	}
+	scheme, port := u.Scheme, u.Port()
+	if scheme != "http" && scheme != "https" {
+		// Les forges exposent leur API en https même pour un dépôt cloné en ssh
+		scheme, port = "https", ""
+	}
+	return repoRef{
+		Scheme: scheme,
+		Host:   u.Hostname(),
+		Port:   port,
+		Path:   strings.TrimSuffix(strings.Trim(u.Path, "/"), ".git"),
+	}, nil
+}
+
+// Deviner le fournisseur à partir de l'hôte du dépôt
+func detectProvider(host string) string {
+	host = strings.ToLower(host)
+	switch {
+	case host == "github.com":
+		return "github"
+	case host == "bitbucket.org":
+		return "bitbucket"
+	case strings.Contains(host, "gitlab"):
+		return "gitlab"
+	case host == "codeberg.org" || strings.Contains(host, "gitea") || strings.Contains(host, "forgejo"):
+		return "gitea"
+	}
+	return ""
+}
+
+// Construire le fournisseur d'un dépôt selon la configuration de la tâche
+func newProvider(repoURL string, opts JobOptions, ghToken string, auth bool) (provider, error) {
+	switch opts.Detect {
+	case "", detectAPI:
+	case detectLsRemote:
+		env, err := gitEnv(repoURL, opts, ghToken, auth)
+		if err != nil {
+			return nil, err
+		}
+		return &lsRemoteProvider{url: repoURL, env: env}, nil
+	default:
+		return nil, fmt.Errorf("mode de détection inconnu : %s", opts.Detect)
+	}
+
+	ref, err := parseRepoURL(repoURL)
+	if err != nil {
+		return nil, err
+	}
+
+	name := strings.ToLower(opts.Provider)
+	if name == "" {
+		name = detectProvider(ref.Host)
+	}
+
+	// URL de base de l'instance : celle de la configuration ou celle déduite de l'URL du dépôt
+	base := fmt.Sprintf("%s://%s", ref.Scheme, ref.Host)
+	if ref.Port != "" {
+		base = fmt.Sprintf("%s://%s", ref.Scheme, net.JoinHostPort(ref.Host, ref.Port))
+	}
+	project := ref.Path
+	if opts.ProviderURL != "" {
+		baseURL, err := url.Parse(strings.TrimSuffix(opts.ProviderURL, "/"))
+		if err != nil {
+			return nil, fmt.Errorf("provider_url invalide %s : %v", opts.ProviderURL, err)
+		}
+		base = strings.TrimSuffix(baseURL.String(), "/")
+		// Une instance installée dans un sous-répertoire préfixe le chemin des dépôts ; le préfixe
+		// n'est retiré que s'il correspond à des segments entiers (/git ne retire rien de gitops/app)
+		if prefix := strings.Trim(baseURL.Path, "/"); prefix != "" && (project == prefix || strings.HasPrefix(project, prefix+"/")) {
+			project = strings.TrimPrefix(strings.TrimPrefix(project, prefix), "/")
+		}
+	}
+
+	token := ""
+	if auth {
+		token = opts.forgeToken(ghToken)
+	}
+	f := forge{project: project, token: token}
+
+	switch name {
+	case "github":
+		f.api = base + "/api/v3"
+		if ref.Host == "github.com" && opts.ProviderURL == "" {
+			f.api = "https://api.github.com"
+		}
+		return &githubProvider{f}, nil
+	case "gitlab":
+		f.api = base + "/api/v4"
+		return &gitlabProvider{f}, nil
+	case "gitea", "forgejo":
+		f.api = base + "/api/v1"
+		return &giteaProvider{f}, nil
+	case "bitbucket":
+		f.api = "https://api.bitbucket.org/2.0"
+		if opts.ProviderURL != "" {
+			f.api = base
+		}
+		return &bitbucketProvider{f}, nil
+	case "":
+		return nil, fmt.Errorf("fournisseur non détecté pour %s, précisez la clé provider", repoURL)
+	}
+	return nil, fmt.Errorf("fournisseur inconnu : %s", opts.Provider)
+}
+
+// Éléments communs aux fournisseurs HTTP
+type forge struct {
+	api     string // URL de base de l'API
+	project string // owner/repo
+	token   string
+}
+
+var forgeClient = &http.Client{Timeout: 30 * time.Second}
+
+// Effectuer un GET sur l'API de la forge et décoder la réponse JSON
+func (f forge) getJSON(p provider, apiURL string, out interface{}) error {
+	req, err := http.NewRequest("GET", apiURL, nil)
+	if err != nil {
+		logger.Log("ERROR", "Erreur lors de la création de la requête HTTP : %v", err)
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if key, value := p.authHeader(); key != "" {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := forgeClient.Do(req)
+	recordForgeRequest(p, apiURL, resp, err)
+	if err != nil {
+		logger.Log("ERROR", "Erreur lors de la requête HTTP pour %s : %v", f.project, err)
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		logger.Log("ERROR", "Réponse HTTP inattendue de %s pour %s : %s", p.name(), f.project, resp.Status)
+		return fmt.Errorf("réponse HTTP inattendue : %s", resp.Status)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		logger.Log("ERROR", "Erreur lors du décodage de la réponse JSON pour %s : %v", f.project, err)
+		return err
+	}
+	return nil
+}
+
+// Tag tel que renvoyé par les API GitHub, GitLab, Gitea et Bitbucket
+type forgeTag struct {
+	Name string `json:"name"`
+}
+
+// Parcourir les pages numérotées d'une liste de tags jusqu'à obtenir une page vide
+func (f forge) pagedTags(p provider, pageURL func(page int) string) ([]string, error) {
+	var names []string
+	for page := 1; page <= maxTagPages; page++ {
+		var tags []forgeTag
+		if err := f.getJSON(p, pageURL(page), &tags); err != nil {
+			return nil, err
+		}
+		if len(tags) == 0 {
+			break
+		}
+		for _, tag := range tags {
+			names = append(names, tag.Name)
+		}
+	}
+	return names, nil
+}
+
+// GitHub et GitHub Enterprise
+type githubProvider struct{ forge }
+
+func (p *githubProvider) name() string { return "github" }
+
+func (p *githubProvider) authHeader() (string, string) {
+	if p.token == "" {
+		return "", ""
+	}
+	return "Authorization", "token " + p.token
+}
+
+func (p *githubProvider) latestCommit(branch string) (string, error) {
+	var commit struct {
+		SHA string `json:"sha"`
+	}
+	apiURL := fmt.Sprintf("%s/repos/%s/commits/%s", p.api, p.project, url.PathEscape(branch))
+	if err := p.getJSON(p, apiURL, &commit); err != nil {
+		return "", err
+	}
+	return commit.SHA, nil
+}
+
+func (p *githubProvider) listTags() ([]string, error) {
+	return p.pagedTags(p, func(page int) string {
+		return fmt.Sprintf("%s/repos/%s/tags?per_page=100&page=%d", p.api, p.project, page)
+	})
+}
+
+// GitLab (gitlab.com ou instance auto-hébergée)
+type gitlabProvider struct{ forge }
+
+func (p *gitlabProvider) name() string { return "gitlab" }
+
+func (p *gitlabProvider) authHeader() (string, string) {
+	if p.token == "" {
+		return "", ""
+	}
+	return "PRIVATE-TOKEN", p.token
+}
+
+func (p *gitlabProvider) latestCommit(branch string) (string, error) {
+	var b struct {
+		Commit struct {
+			ID string `json:"id"`
+		} `json:"commit"`
+	}
+	apiURL := fmt.Sprintf("%s/projects/%s/repository/branches/%s", p.api, url.PathEscape(p.project), url.PathEscape(branch))
+	if err := p.getJSON(p, apiURL, &b); err != nil {
+		return "", err
+	}
+	return b.Commit.ID, nil
+}
+
+func (p *gitlabProvider) listTags() ([]string, error) {
+	return p.pagedTags(p, func(page int) string {
+		return fmt.Sprintf("%s/projects/%s/repository/tags?order_by=updated&sort=desc&per_page=100&page=%d", p.api, url.PathEscape(p.project), page)
+	})
+}
+
+// Gitea et Forgejo (même API)
+type giteaProvider struct{ forge }
+
+func (p *giteaProvider) name() string { return "gitea" }
+
+func (p *giteaProvider) authHeader() (string, string) {
+	if p.token == "" {
+		return "", ""
+	}
+	return "Authorization", "token " + p.token
+}
+
+func (p *giteaProvider) latestCommit(branch string) (string, error) {
+	var b struct {
+		Commit struct {
+			ID string `json:"id"`
+		} `json:"commit"`
+	}
+	apiURL := fmt.Sprintf("%s/repos/%s/branches/%s", p.api, p.project, url.PathEscape(branch))
+	if err := p.getJSON(p, apiURL, &b); err != nil {
+		return "", err
+	}
+	return b.Commit.ID, nil
+}
+
+func (p *giteaProvider) listTags() ([]string, error) {
+	return p.pagedTags(p, func(page int) string {
+		return fmt.Sprintf("%s/repos/%s/tags?limit=50&page=%d", p.api, p.project, page)
+	})
+}
+
+// Bitbucket Cloud
+type bitbucketProvider struct{ forge }
+
+func (p *bitbucketProvider) name() string { return "bitbucket" }
+
+// Un token "utilisateur:app_password" utilise l'authentification Basic, sinon un access token Bearer
+func (p *bitbucketProvider) authHeader() (string, string) {
+	if p.token == "" {
+		return "", ""
+	}
+	if strings.Contains(p.token, ":") {
+		return "Authorization", "Basic " + base64.StdEncoding.EncodeToString([]byte(p.token))
+	}
+	return "Authorization", "Bearer " + p.token
+}
+
+func (p *bitbucketProvider) latestCommit(branch string) (string, error) {
+	var b struct {
+		Target struct {
+			Hash string `json:"hash"`
+		} `json:"target"`
+	}
+	apiURL := fmt.Sprintf("%s/repositories/%s/refs/branches/%s", p.api, p.project, url.PathEscape(branch))
+	if err := p.getJSON(p, apiURL, &b); err != nil {
+		return "", err
+	}
+	return b.Target.Hash, nil
+}
+
+func (p *bitbucketProvider) listTags() ([]string, error) {
+	var names []string
+	next := fmt.Sprintf("%s/repositories/%s/refs/tags?sort=-target.date&pagelen=100", p.api, p.project)
+	// Bitbucket pagine avec un lien "next" plutôt qu'un numéro de page
+	for page := 0; next != "" && page < maxTagPages; page++ {
+		var resp struct {
+			Values []forgeTag `json:"values"`
+			Next   string     `json:"next"`
+		}
+		if err := p.getJSON(p, next, &resp); err != nil {
+			return nil, err
+		}
+		for _, tag := range resp.Values {
+			names = append(names, tag.Name)
+		}
+		next = resp.Next
+	}
+	return names, nil
+}
@@ -0,0 +1,259 @@
+package repos
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestParseRepoURL(t *testing.T) {
+	tests := []struct {
+		url  string
+		want repoRef
+	}{
+		{"https://github.com/org/infra.git", repoRef{Scheme: "https", Host: "github.com", Path: "org/infra"}},
+		{"https://gitlab.example.com/group/sub/infra", repoRef{Scheme: "https", Host: "gitlab.example.com", Path: "group/sub/infra"}},
+		{"http://git.local:3000/org/infra.git", repoRef{Scheme: "http", Host: "git.local", Port: "3000", Path: "org/infra"}},
+		{"https://git.example.com:8443/org/infra.git/", repoRef{Scheme: "https", Host: "git.example.com", Port: "8443", Path: "org/infra"}},
+		{"ssh://git@git.example.com:2222/org/infra.git", repoRef{Scheme: "https", Host: "git.example.com", Path: "org/infra"}},
+		{"git@gitlab.com:group/infra.git", repoRef{Scheme: "https", Host: "gitlab.com", Path: "group/infra"}},
+	}
+	for _, tt := range tests {
+		got, err := parseRepoURL(tt.url)
+		if err != nil || got != tt.want {
+			t.Errorf("parseRepoURL(%s) = %+v, %v, attendu %+v", tt.url, got, err, tt.want)
+		}
+	}
+	if _, err := parseRepoURL("infra"); err == nil {
+		t.Error("URL sans hôte acceptée")
+	}
+}
+
+func TestDetectProvider(t *testing.T) {
+	tests := map[string]string{
+		"github.com":          "github",
+		"bitbucket.org":       "bitbucket",
+		"gitlab.com":          "gitlab",
+		"gitlab.example.com":  "gitlab",
+		"codeberg.org":        "gitea",
+		"gitea.example.com":   "gitea",
+		"forgejo.example.com": "gitea",
+		"git.example.com":     "",
+	}
+	for host, want := range tests {
+		if got := detectProvider(host); got != want {
+			t.Errorf("detectProvider(%s) = %q, attendu %q", host, got, want)
+		}
+	}
+}
+
+// Forge simulée : réponses par URI de requête, en-têtes reçus conservés
+type fakeForge struct {
+	*httptest.Server
+	mu        sync.Mutex
+	responses map[string]string
+	requests  []string
+	auth      []string
+}
+
+func newFakeForge(t *testing.T, responses map[string]string) *fakeForge {
+	f := &fakeForge{responses: responses}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		f.requests = append(f.requests, r.RequestURI)
+		f.auth = append(f.auth, r.Header.Get("Authorization")+r.Header.Get("PRIVATE-TOKEN"))
+		body, ok := f.responses[r.RequestURI]
+		f.mu.Unlock()
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(strings.ReplaceAll(body, "{{server}}", f.URL)))
+	}))
+	t.Cleanup(f.Close)
+	return f
+}
+
+func TestForgeProviders(t *testing.T) {
+	tests := []struct {
+		name      string
+		repoURL   string // {{server}} : URL du serveur simulé
+		opts      JobOptions
+		branch    string
+		responses map[string]string
+		commit    string
+		tags      []string
+		auth      string
+	}{
+		{
+			name:    "GitHub Enterprise",
+			repoURL: "https://ghe.example.com/org/infra.git",
+			opts:    JobOptions{Provider: "github", ProviderURL: "{{server}}/", Token: "ghp_secret"},
+			branch:  "release/1.x",
+			responses: map[string]string{
+				"/api/v3/repos/org/infra/commits/release%2F1.x":    `{"sha":"1111"}`,
+				"/api/v3/repos/org/infra/tags?per_page=100&page=1": `[{"name":"v2.0.0"},{"name":"v1.0.0"}]`,
+				"/api/v3/repos/org/infra/tags?per_page=100&page=2": `[{"name":"v0.1.0"}]`,
+				"/api/v3/repos/org/infra/tags?per_page=100&page=3": `[]`,
+			},
+			commit: "1111",
+			tags:   []string{"v2.0.0", "v1.0.0", "v0.1.0"},
+			auth:   "token ghp_secret",
+		},
+		{
+			// Instance déduite de l'URL du dépôt, port compris ; sous-groupes encodés dans l'ID du projet
+			name:    "GitLab auto-hébergé, sous-groupes",
+			repoURL: "{{server}}/group/sub/infra.git",
+			opts:    JobOptions{Provider: "gitlab", Token: "glpat-secret"},
+			branch:  "main",
+			responses: map[string]string{
+				"/api/v4/projects/group%2Fsub%2Finfra/repository/branches/main":                                       `{"name":"main","commit":{"id":"2222"}}`,
+				"/api/v4/projects/group%2Fsub%2Finfra/repository/tags?order_by=updated&sort=desc&per_page=100&page=1": `[{"name":"v3"}]`,
+				"/api/v4/projects/group%2Fsub%2Finfra/repository/tags?order_by=updated&sort=desc&per_page=100&page=2": `[]`,
+			},
+			commit: "2222",
+			tags:   []string{"v3"},
+			auth:   "glpat-secret",
+		},
+		{
+			// Instance installée dans un sous-répertoire : le préfixe est retiré du chemin du projet
+			name:    "GitLab dans un sous-répertoire",
+			repoURL: "https://git.example.com/gitlab/group/infra.git",
+			opts:    JobOptions{Provider: "gitlab", ProviderURL: "{{server}}/gitlab"},
+			branch:  "main",
+			responses: map[string]string{
+				"/gitlab/api/v4/projects/group%2Finfra/repository/branches/main":                                       `{"commit":{"id":"3333"}}`,
+				"/gitlab/api/v4/projects/group%2Finfra/repository/tags?order_by=updated&sort=desc&per_page=100&page=1": `[]`,
+			},
+			commit: "3333",
+		},
+		{
+			name:    "Forgejo cloné en ssh",
+			repoURL: "ssh://git@codeberg.example.com:2222/org/infra.git",
+			opts:    JobOptions{Provider: "forgejo", ProviderURL: "{{server}}", Token: "forgejo-secret"},
+			branch:  "main",
+			responses: map[string]string{
+				"/api/v1/repos/org/infra/branches/main":        `{"name":"main","commit":{"id":"4444"}}`,
+				"/api/v1/repos/org/infra/tags?limit=50&page=1": `[{"name":"v1.1"},{"name":"v1.0"}]`,
+				"/api/v1/repos/org/infra/tags?limit=50&page=2": `[]`,
+			},
+			commit: "4444",
+			tags:   []string{"v1.1", "v1.0"},
+			auth:   "token forgejo-secret",
+		},
+		{
+			// Pagination par lien "next" ; utilisateur:app_password en authentification Basic
+			name:    "Bitbucket",
+			repoURL: "https://bitbucket.org/workspace/infra.git",
+			opts:    JobOptions{Provider: "bitbucket", ProviderURL: "{{server}}", Token: "user:app-password"},
+			branch:  "main",
+			responses: map[string]string{
+				"/repositories/workspace/infra/refs/branches/main":                      `{"name":"main","target":{"hash":"5555"}}`,
+				"/repositories/workspace/infra/refs/tags?sort=-target.date&pagelen=100": `{"values":[{"name":"v5"}],"next":"{{server}}/repositories/workspace/infra/refs/tags?page=2"}`,
+				"/repositories/workspace/infra/refs/tags?page=2":                        `{"values":[{"name":"v4"}]}`,
+			},
+			commit: "5555",
+			tags:   []string{"v5", "v4"},
+			auth:   "Basic dXNlcjphcHAtcGFzc3dvcmQ=",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			forge := newFakeForge(t, tt.responses)
+			opts := tt.opts
+			opts.ProviderURL = strings.ReplaceAll(opts.ProviderURL, "{{server}}", forge.URL)
+			p, err := newProvider(strings.ReplaceAll(tt.repoURL, "{{server}}", forge.URL), opts, "", true)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			commit, err := p.latestCommit(tt.branch)
+			if err != nil || commit != tt.commit {
+				t.Errorf("latestCommit = %q, %v, attendu %q (requêtes : %v)", commit, err, tt.commit, forge.requests)
+			}
+			tags, err := p.listTags()
+			if err != nil || !reflect.DeepEqual(tags, tt.tags) {
+				t.Errorf("listTags = %v, %v, attendu %v (requêtes : %v)", tags, err, tt.tags, forge.requests)
+			}
+			for _, auth := range forge.auth {
+				if auth != tt.auth {
+					t.Errorf("authentification %q, attendu %q", auth, tt.auth)
+				}
+			}
+		})
+	}
+}
+
+func TestNewProviderAPIBase(t *testing.T) {
+	tests := []struct {
+		repoURL string
+		opts    JobOptions
+		api     string
+		project string
+	}{
+		{"https://github.com/org/infra.git", JobOptions{}, "https://api.github.com", "org/infra"},
+		{"git@github.com:org/infra.git", JobOptions{}, "https://api.github.com", "org/infra"},
+		{"https://gitlab.com/group/infra.git", JobOptions{}, "https://gitlab.com/api/v4", "group/infra"},
+		{"http://gitea.local:3000/org/infra.git", JobOptions{}, "http://gitea.local:3000/api/v1", "org/infra"},
+		{"https://codeberg.org/org/infra.git", JobOptions{}, "https://codeberg.org/api/v1", "org/infra"},
+		{"https://bitbucket.org/workspace/infra.git", JobOptions{}, "https://api.bitbucket.org/2.0", "workspace/infra"},
+		{"https://git.example.com/org/infra.git", JobOptions{Provider: "GitLab"}, "https://git.example.com/api/v4", "org/infra"},
+		{"https://github.example.com/org/infra.git", JobOptions{Provider: "github"}, "https://github.example.com/api/v3", "org/infra"},
+		// Préfixe d'une instance installée dans un sous-répertoire, retiré par segments entiers
+		{"https://host/git/group/app.git", JobOptions{Provider: "gitlab", ProviderURL: "https://host/git/"}, "https://host/git/api/v4", "group/app"},
+		{"https://host/gitops/app.git", JobOptions{Provider: "gitlab", ProviderURL: "https://host/git"}, "https://host/git/api/v4", "gitops/app"},
+	}
+	for _, tt := range tests {
+		p, err := newProvider(tt.repoURL, tt.opts, "", false)
+		if err != nil {
+			t.Errorf("newProvider(%s) : %v", tt.repoURL, err)
+			continue
+		}
+		var f forge
+		switch p := p.(type) {
+		case *githubProvider:
+			f = p.forge
+		case *gitlabProvider:
+			f = p.forge
+		case *giteaProvider:
+			f = p.forge
+		case *bitbucketProvider:
+			f = p.forge
+		}
+		if f.api != tt.api || f.project != tt.project {
+			t.Errorf("API de %s : %s, projet %s, attendu %s, %s", tt.repoURL, f.api, f.project, tt.api, tt.project)
+		}
+	}
+
+	if _, err := newProvider("https://git.example.com/org/infra.git", JobOptions{}, "", false); err == nil {
+		t.Error("fournisseur non détecté sans erreur")
+	}
+	if _, err := newProvider("https://github.com/org/infra.git", JobOptions{Provider: "svn"}, "", false); err == nil {
+		t.Error("fournisseur inconnu accepté")
+	}
+}
+
+// Sans auth, aucun token n'est envoyé ; une réponse d'erreur de la forge est remontée
+func TestForgeProviderErrors(t *testing.T) {
+	forge := newFakeForge(t, map[string]string{})
+	p, err := newProvider(forge.URL+"/org/infra.git", JobOptions{Provider: "gitea", Token: "secret"}, "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.latestCommit("main"); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("branche absente : %v, attendu une erreur 404", err)
+	}
+	if _, err := p.listTags(); err == nil {
+		t.Error("liste des tags en erreur acceptée")
+	}
+	for _, auth := range forge.auth {
+		if auth != "" {
+			t.Errorf("token envoyé sans auth : %q", auth)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package repos
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"gopkg.in/yaml.v2"
+
+	"aidalinfo/ansible-lite/internal/config"
+	"aidalinfo/ansible-lite/internal/logger"
+)
+
+// Intervalle de vérification de la date de modification de repos.yaml (watch_repos_config)
+const reposConfigWatchInterval = 5 * time.Second
+
+// Entrée du cron d'une tâche et empreinte de la configuration avec laquelle elle a été planifiée
+type scheduledJob struct {
+	id          cron.EntryID
+	fingerprint string
+}
+
+// Résultat d'un rechargement de repos.yaml
+type ReloadResult struct {
+	Added   []string
+	Updated []string
+	Removed []string
+	Failed  []string // Tâches non planifiées, avec l'erreur ; une tâche modifiée garde sa version précédente
+}
+
+var (
+	reloadMu    sync.Mutex // Un seul rechargement à la fois
+	schedulerMu sync.Mutex
+	scheduler   *cron.Cron
+	scheduled   = make(map[string]scheduledJob)
+)
+
+// Tâche de repos.yaml prête à être planifiée
+type plannedJob struct {
+	key         string
+	fingerprint string
+	prepare     func() // Initialisation préalable à la planification (flux : insertion en base)
+	plan        func(c *cron.Cron) (cron.EntryID, error)
+}
+
+// Empreinte d'une tâche : sa configuration sérialisée, pour détecter les modifications
+func fingerprint(job interface{}) string {
+	data, err := yaml.Marshal(job)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// Lister les tâches d'une configuration avec leur fonction de planification
+func plannedJobs(reposConfig *ReposConfig, dbPath, ghToken string) map[string]plannedJob {
+	planned := make(map[string]plannedJob)
+	for name, repo := range reposConfig.Repos {
+		repo := repo
+		repo.Name = name
+		key := jobKey(kindRepo, name)
+		planned[key] = plannedJob{key: key, fingerprint: fingerprint(repo), plan: func(c *cron.Cron) (cron.EntryID, error) {
+			return planRepoCron(c, repo, dbPath, ghToken)
+		}}
+	}
+	for name, flux := range reposConfig.Flux {
+		name, flux := name, flux
+		key := jobKey(kindFlux, name)
+		planned[key] = plannedJob{key: key, fingerprint: fingerprint(flux), prepare: func() {
+			loadFluxs(dbPath, map[string]Flux{name: flux}, ghToken)
+		}, plan: func(c *cron.Cron) (cron.EntryID, error) {
+			return planFluxCron(c, name, flux, dbPath, ghToken)
+		}}
+	}
+	for name, continuous := range reposConfig.Continuous {
+		name, continuous := name, continuous
+		key := jobKey(kindContinuous, name)
+		planned[key] = plannedJob{key: key, fingerprint: fingerprint(continuous), plan: func(c *cron.Cron) (cron.EntryID, error) {
+			return planContinuousCron(c, name, continuous, dbPath, ghToken)
+		}}
+	}
+	return planned
+}
+
+// Mettre le cron en conformité avec la configuration : seules les tâches ajoutées, modifiées
+// ou supprimées sont touchées, les exécutions en cours se poursuivent normalement.
+// Au démarrage, les flux ont déjà été initialisés par LoadReposConfig (reload à false).
+// L'initialisation des flux interroge la forge : elle se fait avant de prendre schedulerMu,
+// nécessaire à chaque déclenchement du cron.
+func applyReposConfig(reposConfig *ReposConfig, dbPath, ghToken string, reload bool) ReloadResult {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	planned := plannedJobs(reposConfig, dbPath, ghToken)
+	if reload {
+		schedulerMu.Lock()
+		previous := make(map[string]string, len(scheduled))
+		for key, job := range scheduled {
+			previous[key] = job.fingerprint
+		}
+		schedulerMu.Unlock()
+		for key, job := range planned {
+			if fp, exists := previous[key]; job.prepare != nil && (!exists || fp != job.fingerprint) {
+				job.prepare()
+			}
+		}
+	}
+
+	schedulerMu.Lock()
+	defer schedulerMu.Unlock()
+
+	var result ReloadResult
+	for key, job := range scheduled {
+		if _, ok := planned[key]; !ok {
+			scheduler.Remove(job.id)
+			unregisterJob(key)
+			forgetJobMetrics(key)
+			delete(scheduled, key)
+			result.Removed = append(result.Removed, key)
+		}
+	}
+
+	for key, job := range planned {
+		previous, exists := scheduled[key]
+		if exists && previous.fingerprint == job.fingerprint {
+			continue
+		}
+		// Nouvelle entrée planifiée avant de retirer l'ancienne : en cas d'échec, la tâche
+		// modifiée reste planifiée avec sa configuration précédente
+		id, err := job.plan(scheduler)
+		if err != nil {
+			if exists {
+				logger.Log("ERROR", "Impossible de replanifier la tâche %s, sa configuration précédente est conservée : %v", key, err)
+			} else {
+				logger.Log("ERROR", "Impossible de planifier la tâche %s : %v", key, err)
+			}
+			result.Failed = append(result.Failed, fmt.Sprintf("%s : %v", key, err))
+			continue
+		}
+		if exists {
+			scheduler.Remove(previous.id)
+		}
+		scheduled[key] = scheduledJob{id: id, fingerprint: job.fingerprint}
+		if exists {
+			result.Updated = append(result.Updated, key)
+		} else {
+			result.Added = append(result.Added, key)
+		}
+	}
+
+	sort.Strings(result.Added)
+	sort.Strings(result.Updated)
+	sort.Strings(result.Removed)
+	sort.Strings(result.Failed)
+	return result
+}
+
+// Horaire prévu du déclenchement en cours d'une tâche planifiée (Prev de son entrée dans le cron)
+func plannedTime(key string) time.Time {
+	schedulerMu.Lock()
+	job, ok := scheduled[key]
+	c := scheduler
+	schedulerMu.Unlock()
+	if !ok || c == nil {
+		return time.Time{}
+	}
+	return c.Entry(job.id).Prev
+}
+
+// Erreur résumant les problèmes détectés dans un fichier de configuration
+func issuesError(issues []config.Issue) error {
+	messages := make([]string, 0, len(issues))
+	for _, issue := range issues {
+		messages = append(messages, issue.String())
+	}
+	return fmt.Errorf("%s", strings.Join(messages, "; "))
+}
+
+// Recharger repos.yaml et replanifier les tâches modifiées ; un fichier invalide est rejeté
+// et la planification en cours est conservée
+func ReloadReposConfig(cfg *config.GlobalConfig) (ReloadResult, error) {
+	schedulerMu.Lock()
+	started := scheduler != nil
+	schedulerMu.Unlock()
+	if !started {
+		return ReloadResult{}, fmt.Errorf("la planification des tâches n'est pas encore démarrée")
+	}
+
+	if issues := CheckReposFile(cfg.Global.ReposConfig); len(issues) > 0 {
+		err := issuesError(issues)
+		logger.Log("ERROR", "Rechargement de %s refusé, la configuration actuelle est conservée : %v", cfg.Global.ReposConfig, err)
+		return ReloadResult{}, err
+	}
+	reposConfig, err := readReposConfig(cfg.Global.ReposConfig)
+	if err != nil {
+		return ReloadResult{}, err
+	}
+
+	registerSecrets(reposConfig)
+	result := applyReposConfig(reposConfig, cfg.Global.DBPath, cfg.Global.GithubToken, true)
+	logger.Log("INFO", "%s rechargé : %d tâche(s) ajoutée(s), %d modifiée(s), %d supprimée(s)",
+		cfg.Global.ReposConfig, len(result.Added), len(result.Updated), len(result.Removed))
+	if len(result.Failed) > 0 {
+		logger.Log("WARN", "%d tâche(s) de %s non planifiée(s) : %s", len(result.Failed), cfg.Global.ReposConfig, strings.Join(result.Failed, "; "))
+	}
+	return result, nil
+}
+
+// Recharger repos.yaml à chaque modification du fichier, avec ReloadReposConfig ou, en mode
+// serveur, la fonction de rechargement du catalogue
+func WatchReposConfig(cfg *config.GlobalConfig, reload func(*config.GlobalConfig) (ReloadResult, error)) {
+	var lastMod time.Time
+	if info, err := os.Stat(cfg.Global.ReposConfig); err == nil {
+		lastMod = info.ModTime()
+	}
+
+	for range time.Tick(reposConfigWatchInterval) {
+		info, err := os.Stat(cfg.Global.ReposConfig)
+		if err != nil || info.ModTime().Equal(lastMod) {
+			continue
+		}
+		lastMod = info.ModTime()
+		logger.Log("INFO", "Modification de %s détectée, rechargement", cfg.Global.ReposConfig)
+		reload(cfg)
+	}
+}
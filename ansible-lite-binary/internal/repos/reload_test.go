@@ -0,0 +1,65 @@
+package repos
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/robfig/cron/v3"
+)
+
+// Une tâche modifiée qui ne peut pas être replanifiée garde sa planification précédente et
+// l'échec est remonté dans le résultat
+func TestApplyReposConfigKeepsPreviousOnFailure(t *testing.T) {
+	schedulerMu.Lock()
+	previousScheduler, previousScheduled := scheduler, scheduled
+	scheduler, scheduled = cron.New(), make(map[string]scheduledJob)
+	schedulerMu.Unlock()
+	defer func() {
+		schedulerMu.Lock()
+		scheduler, scheduled = previousScheduler, previousScheduled
+		schedulerMu.Unlock()
+	}()
+
+	repo := Repo{URL: "https://github.com/org/infra.git", Watcher: "@every 1h", Path: t.TempDir()}
+	result := applyReposConfig(&ReposConfig{Repos: map[string]Repo{"infra": repo}}, "", "", true)
+	if !reflect.DeepEqual(result.Added, []string{"repo/infra"}) || len(result.Failed) != 0 {
+		t.Fatalf("ajout : %+v", result)
+	}
+	before := scheduled["repo/infra"]
+
+	repo.Watcher = "toutes les heures"
+	result = applyReposConfig(&ReposConfig{Repos: map[string]Repo{"infra": repo}}, "", "", true)
+	if len(result.Updated) != 0 || len(result.Failed) != 1 || !strings.HasPrefix(result.Failed[0], "repo/infra : ") {
+		t.Errorf("modification invalide : %+v", result)
+	}
+	if after := scheduled["repo/infra"]; after != before {
+		t.Errorf("planification remplacée : %+v, attendu %+v", after, before)
+	}
+	if len(scheduler.Entries()) != 1 {
+		t.Errorf("%d entrées dans le cron, attendu 1", len(scheduler.Entries()))
+	}
+
+	repo.Watcher = "@every 2h"
+	result = applyReposConfig(&ReposConfig{Repos: map[string]Repo{"infra": repo}}, "", "", true)
+	if !reflect.DeepEqual(result.Updated, []string{"repo/infra"}) || len(scheduler.Entries()) != 1 {
+		t.Errorf("modification : %+v, %d entrées dans le cron", result, len(scheduler.Entries()))
+	}
+}
+
+// Au démarrage, repos.yaml est validé comme au rechargement : une clé inconnue est refusée
+func TestLoadReposConfigRejectsInvalidFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "repos.yaml")
+	content := "repos:\n  infra:\n    url: https://github.com/org/infra.git\n    watcher: \"@every 1h\"\n    branch: main\n    path: /tmp\n    brnach: dev\n"
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if issues := CheckReposFile(path); len(issues) == 0 {
+		t.Fatal("clé inconnue acceptée par CheckReposFile")
+	}
+	if _, err := LoadReposConfig(path, "", ""); err == nil || !strings.Contains(err.Error(), "brnach") {
+		t.Errorf("LoadReposConfig : %v, attendu le refus de la clé brnach", err)
+	}
+}
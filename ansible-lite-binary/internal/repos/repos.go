@@ -2,9 +2,6 @@ package repos
 
 import (
     "fmt"
-    "sync"
-    "net/http"
-    "encoding/json"
     "os"
     "os/exec"
     "path/filepath"
@@ -14,13 +11,9 @@ import (
     "aidalinfo/ansible-lite/internal/logger"
     "database/sql"
     "regexp"
+    "time"
 )
 
-// Structure pour lire la réponse de l'API GitHub
-type GithubCommit struct {
-    SHA string `json:"sha"`
-}
-
 // Structure pour un dépôt individuel
 type Repo struct {
     Name     string 
@@ -30,6 +23,7 @@ type Repo struct {
     Branch   string `yaml:"branch"`
     Path     string `yaml:"path"`
     Auth     bool   `yaml:"auth"`
+    JobOptions `yaml:",inline"`
 }
 
 // // Nouvelle structure pour la liste des dépôts avec une map pour les noms des dépôts
@@ -38,25 +32,31 @@ type Repo struct {
 //     Flux  map[string]Flux `yaml:"flux"`
 // }
 
-func planRepoCron(c *cron.Cron, wg *sync.WaitGroup, repo Repo, dbPath string, ghToken string) {
-    _, err := c.AddFunc(repo.Watcher, func() {
-        logger.Log("INFO", "Tâche planifiée exécutée pour le dépôt %s (%s)", repo.Name, repo.URL)
-        wg.Add(1)
-        go func() {
-            defer wg.Done()
-            err := processRepo(dbPath, repo, ghToken)
-            if err != nil {
-                logger.Log("ERROR", "Erreur lors du traitement du dépôt %s (%s) : %v", repo.Name, repo.URL, err)
-            }
-        }()
+// Ajouter le dépôt au cron et renvoyer l'identifiant de l'entrée créée
+func planRepoCron(c *cron.Cron, repo Repo, dbPath string, ghToken string) (cron.EntryID, error) {
+    spec := jobSpec{Kind: kindRepo, Name: repo.Name, DBPath: dbPath, Options: repo.JobOptions, URLs: []string{repo.URL}, Branch: repo.Branch}
+    spec.run = func(force bool) error {
+        return processRepo(dbPath, repo, ghToken, force)
+    }
+    id, err := c.AddFunc(repo.Watcher, func() {
+        logger.Log("DEBUG", "Tâche planifiée exécutée pour le dépôt %s (%s)", repo.Name, repo.URL)
+        spec.cronPoll()
     })
     if err != nil {
         logger.Log("ERROR", "Erreur lors de l'ajout du cron pour le dépôt %s : %v", repo.Name, err)
+        return 0, err
     }
+    registerJob(spec)
+    return id, nil
 }
 
-func processRepo(dbPath string, repo Repo, ghToken string) error {
-    logger.Log("INFO", "Démarrage du traitement pour le dépôt %s (%s)", repo.Name, repo.URL)
+// Traiter un dépôt : détecter un nouveau commit, cloner et exécuter le script d'init.
+// Une erreur est renvoyée pour que l'échec soit compté par le disjoncteur de la tâche.
+// Avec force, le script est exécuté même si le dernier commit est déjà déployé.
+func processRepo(dbPath string, repo Repo, ghToken string, force bool) error {
+    fields := jobFields(kindRepo, repo.Name)
+    fields["repo_url"] = repo.URL
+    logger.LogFields("INFO", fields, "Démarrage du traitement pour le dépôt %s (%s)", repo.Name, repo.URL)
     
     repoPath := filepath.Join(repo.Path, repoNameFromURL(repo.URL))
     if _, err := os.Stat(repo.Path); os.IsNotExist(err) {
@@ -64,7 +64,7 @@ func processRepo(dbPath string, repo Repo, ghToken string) error {
         err = os.MkdirAll(repo.Path, 0750)
         if err != nil {
             logger.Log("ERROR", "Impossible de créer le répertoire %s : %v", repo.Path, err)
-            return nil // Ne pas arrêter l'application, continuez
+            return err
         }
     }
 
@@ -72,44 +72,66 @@ func processRepo(dbPath string, repo Repo, ghToken string) error {
     lastCommit, err := db.GetLastCommit(dbPath, repo.URL)
     if err != nil && err != sql.ErrNoRows {
         logger.Log("ERROR", "Erreur lors de la récupération du dernier commit pour le dépôt %s : %v", repo.Name, err)
-        return nil // Continuer même en cas d'erreur
+        return err
     }
 
-    // Récupérer le dernier commit depuis GitHub
-    latestCommit, err := getLatestCommit(repo.URL, repo.Branch, ghToken, repo.Auth)
+    // Récupérer le dernier commit depuis la forge
+    var latestCommit string
+    err = withRetry(repo.Retry, phaseDetect, kindRepo, repo.Name, func() error {
+        var err error
+        latestCommit, err = getLatestCommit(repo, ghToken)
+        return err
+    })
+    recordPoll(kindRepo, repo.Name, latestCommit != lastCommit, err)
     if err != nil {
-        logger.Log("ERROR", "Erreur lors de la récupération du dernier commit depuis GitHub pour le dépôt %s : %v", repo.URL, err)
-        return nil // Continuer même en cas d'erreur
+        logger.Log("ERROR", "Erreur lors de la récupération du dernier commit distant pour le dépôt %s : %v", repo.URL, err)
+        return err
     }
 
     // Comparer les commits
-    if lastCommit == latestCommit {
-        logger.Log("INFO", "Aucun nouveau commit pour le dépôt %s, rien à faire", repo.Name)
+    if lastCommit == latestCommit && !force {
+        logger.Log("DEBUG", "Aucun nouveau commit pour le dépôt %s, rien à faire", repo.Name)
         return nil
     }
 
-    // Clonage du dépôt
-    err = cloneRepo(repo.URL, repo.Branch, repoPath, ghToken, repo.Auth)
+    // Un seul clonage/script à la fois dans un même répertoire
+    unlock := lockPath(kindRepo, repo.Name, repoPath)
+    defer unlock()
+
+    // Clonage du dépôt, épinglé sur le commit détecté même si la branche a avancé depuis
+    var deployedCommit string
+    err = withRetry(repo.Retry, phaseClone, kindRepo, repo.Name, func() error {
+        var err error
+        deployedCommit, err = cloneRepo(repo.URL, repo.Branch, checkoutTarget{Commit: latestCommit}, repoPath, ghToken, repo.Auth, repo.JobOptions)
+        return err
+    })
     if err != nil {
         logger.Log("ERROR", "Erreur lors du clonage du dépôt %s : %v", repo.URL, err)
-        return nil // Continuer même en cas d'erreur
+        return err
     }
 
     // Exécution du script d'init
-    err = runInitScript(repo.Init, repoPath)
+    ec := execContext{
+        DBPath: dbPath, Kind: kindRepo, Name: repo.Name, Source: repo.URL, Trigger: latestCommit, Commit: deployedCommit,
+        Previous: lastCommit, RepoURL: repo.URL, Branch: repo.Branch, Env: repo.Env, Vars: repo.Vars, Timeout: repo.scriptTimeout(),
+    }
+    err = withRetry(repo.Retry, phaseScript, kindRepo, repo.Name, func() error {
+        return runJobAction(ec, repo.Init, repo.JobOptions, repoPath)
+    })
     if err != nil {
         logger.Log("ERROR", "Erreur lors de l'exécution du script init pour le dépôt %s : %v", repo.URL, err)
-        return nil // Continuer même en cas d'erreur
+        return err
     }
 
     // Mettre à jour le dernier commit
-    err = db.UpdateLastCommit(dbPath, repo.Name, repo.URL, latestCommit, repo.Watcher, repo.Branch)
+    err = db.UpdateLastCommit(dbPath, repo.Name, repo.URL, deployedCommit, repo.Watcher, repo.Branch)
     if err != nil {
         logger.Log("ERROR", "Erreur lors de la mise à jour du dernier commit dans la base de données pour le dépôt %s : %v", repo.URL, err)
-        return nil // Continuer même en cas d'erreur
+        return err
     }
 
-    logger.Log("INFO", "Traitement du dépôt %s terminé avec succès", repo.Name)
+    fields["commit"] = deployedCommit
+    logger.LogFields("INFO", fields, "Traitement du dépôt %s terminé avec succès", repo.Name)
     return nil
 }
 
@@ -120,57 +142,74 @@ func repoNameFromURL(url string) string {
     return strings.TrimSuffix(name, ".git")
 }
 
-// Fonction pour obtenir le dernier commit depuis GitHub
-func getLatestCommit(repoURL, branch, ghToken string, auth bool) (string, error) {
-    apiURL := convertRepoURLToAPI(repoURL, branch)
+// Fonction pour obtenir le dernier commit depuis la forge du dépôt
+func getLatestCommit(repo Repo, ghToken string) (string, error) {
+    p, err := newProvider(repo.URL, repo.JobOptions, ghToken, repo.Auth)
+    if err != nil {
+        logger.Log("ERROR", "Impossible de déterminer le fournisseur du dépôt %s : %v", repo.URL, err)
+        return "", err
+    }
 
     // Ajoute un log pour voir que l'on tente d'obtenir le dernier commit
-    logger.Log("INFO", "Tentative de récupération du dernier commit pour %s sur la branche %s via %s", repoURL, branch, apiURL)
+    logger.Log("DEBUG", "Tentative de récupération du dernier commit pour %s sur la branche %s via %s", repo.URL, repo.Branch, p.name())
 
-    client := &http.Client{}
-    req, err := http.NewRequest("GET", apiURL, nil)
+    sha, err := p.latestCommit(repo.Branch)
     if err != nil {
-        logger.Log("ERROR", "Erreur lors de la création de la requête HTTP : %v", err)
         return "", err
     }
-
-    if auth {
-        // Ajouter l'authentification par token si auth est vrai
-        req.Header.Set("Authorization", "token "+ghToken)
+    if sha == "" {
+        return "", fmt.Errorf("aucun commit trouvé pour la branche %s", repo.Branch)
     }
 
-    resp, err := client.Do(req)
+    logger.Log("DEBUG", "Dernier commit pour %s : %s", repo.URL, sha)
+    return sha, nil
+}
+
+// Cloner un dépôt (ou le mettre à jour selon la stratégie de la tâche), extraire la révision
+// demandée et renvoyer le SHA réellement extrait
+func cloneRepo(url, branch string, target checkoutTarget, path, ghToken string, auth bool, opts JobOptions) (head string, err error) {
+    started := time.Now()
+    defer func() {
+        cloneDuration.Observe(time.Since(started).Seconds(), logger.Redact(url), resultLabel(err))
+    }()
+
+    // Les identifiants passent par l'environnement : ils n'apparaissent ni dans ps ni dans .git/config
+    env, err := gitEnv(url, opts, ghToken, auth)
     if err != nil {
-        logger.Log("ERROR", "Erreur lors de la requête HTTP pour %s : %v", repoURL, err)
+        logger.Log("ERROR", "Impossible de préparer l'environnement git pour %s : %v", url, err)
         return "", err
     }
-    defer resp.Body.Close()
 
-    if resp.StatusCode != http.StatusOK {
-        logger.Log("ERROR", "Réponse HTTP inattendue pour %s : %s", repoURL, resp.Status)
-        return "", fmt.Errorf("réponse HTTP inattendue : %s", resp.Status)
+    err = fetchOrClone(url, branch, path, env, opts)
+    if err != nil {
+        return "", err
     }
 
-    var commit GithubCommit
-    err = json.NewDecoder(resp.Body).Decode(&commit)
+    head, err = pinCheckout(env, path, branch, target)
     if err != nil {
-        logger.Log("ERROR", "Erreur lors du décodage de la réponse JSON pour %s : %v", repoURL, err)
+        logger.Log("ERROR", "Impossible d'extraire la révision attendue du dépôt %s : %v", url, err)
         return "", err
     }
-
-    logger.Log("INFO", "Dernier commit pour %s : %s", repoURL, commit.SHA)
-    return commit.SHA, nil
+    logger.Log("INFO", "Dépôt %s extrait au commit %s", url, head)
+    return head, nil
 }
 
-// Convertir l'URL du dépôt en URL de l'API GitHub
-func convertRepoURLToAPI(repoURL, branch string) string {
-    repoAPIURL := strings.Replace(repoURL, "https://github.com/", "https://api.github.com/repos/", 1)
-    repoAPIURL = strings.TrimSuffix(repoAPIURL, ".git")
-    return fmt.Sprintf("%s/commits/%s", repoAPIURL, branch)
-}
+// Mettre à jour le dépôt existant ou le cloner sur la tête de la branche
+func fetchOrClone(url, branch, path string, env []string, opts JobOptions) error {
+    switch opts.Strategy {
+    case "", strategyReclone:
+    case strategyFetchReset:
+        // Conserver le répertoire de travail existant, reclone en dernier recours
+        err := fetchReset(url, branch, path, env)
+        if err == nil {
+            logger.Log("INFO", "Mise à jour du dépôt %s terminée avec succès", url)
+            return nil
+        }
+        logger.Log("WARN", "Mise à jour impossible du dépôt %s, nouveau clonage : %v", url, err)
+    default:
+        return fmt.Errorf("stratégie de mise à jour inconnue : %s", opts.Strategy)
+    }
 
-// Cloner un dépôt depuis GitHub en ne récupérant que le dernier commit
-func cloneRepo(url, branch, path, ghToken string, auth bool) error {
     // Vérifier si le répertoire existe déjà
     if _, err := os.Stat(path); !os.IsNotExist(err) {
         // Si le dossier existe déjà, le supprimer
@@ -184,21 +223,8 @@ func cloneRepo(url, branch, path, ghToken string, auth bool) error {
 
     logger.Log("INFO", "Clonage du dépôt %s (branche : %s) dans le répertoire %s", url, branch, path)
 
-    var cmd *exec.Cmd
-    if auth {
-        // Utiliser le token pour l'authentification
-        urlWithAuth := strings.Replace(url, "https://", "https://"+ghToken+"@", 1)
-        cmd = exec.Command("git", "clone", "--branch", branch, "--depth", "1", urlWithAuth, path)
-    } else {
-        // Clonage normal sans token
-        cmd = exec.Command("git", "clone", "--branch", branch, "--depth", "1", url, path)
-    }
-    
-    cmd.Stdout = os.Stdout
-    cmd.Stderr = os.Stderr
-
     // Exécuter la commande de clonage et attendre qu'elle soit terminée
-    err := cmd.Run()
+    _, err := runGit(env, "", "clone", "--branch", branch, "--depth", "1", url, path)
     if err != nil {
         logger.Log("ERROR", "Erreur lors du clonage du dépôt %s : %v", url, err)
         return err
@@ -208,38 +234,59 @@ func cloneRepo(url, branch, path, ghToken string, auth bool) error {
     return nil
 }
 
-// Exécuter le script init.sh dans le dépôt cloné
-func runInitScript(scriptName, repoPath string) error {
+// Exécuter le script init.sh dans le dépôt cloné et enregistrer l'exécution
+func runInitScript(ec execContext, scriptName, repoPath string) error {
     scriptPath := filepath.Join(repoPath, scriptName)
+    started := time.Now()
+    execution := startExecution(ec)
 
     // Vérifier si le script existe
     if _, err := os.Stat(scriptPath); os.IsNotExist(err) {
-        logger.Log("INFO", "Le script %s n'existe pas dans le dépôt %s", scriptName, repoPath)
+        finishExecution(ec, execution, started, statusSkipped, nil, "")
+        logger.LogFields("INFO", executionFields(ec, execution), "Le script %s n'existe pas dans le dépôt %s", scriptName, repoPath)
         return nil // Pas d'erreur, on continue normalement
     }
 
     // Rendre le script exécutable
     err := os.Chmod(scriptPath, 0750)
     if err != nil {
-        logger.Log("ERROR", "Impossible de rendre le script %s exécutable : %v", scriptName, err)
+        finishExecution(ec, execution, started, statusFailed, err, err.Error())
+        logger.LogFields("ERROR", executionFields(ec, execution), "Impossible de rendre le script %s exécutable : %v", scriptName, err)
         return err
     }
 
-    logger.Log("INFO", "Exécution du script %s dans le dépôt %s", scriptName, repoPath)
+    logger.LogFields("INFO", executionFields(ec, execution), "Exécution du script %s dans le dépôt %s (exécution %d)", scriptName, repoPath, execution.ID)
 
+    // Capturer stdout et stderr pour les conserver avec l'exécution
+    output, err := newOutputFile()
+    if err != nil {
+        finishExecution(ec, execution, started, statusFailed, err, err.Error())
+        logger.LogFields("ERROR", executionFields(ec, execution), "Exécution du script %s impossible : %v", scriptName, err)
+        return err
+    }
+    defer output.Close()
     cmd := exec.Command("./" + scriptName)
     cmd.Dir = repoPath
-    cmd.Stdout = os.Stdout
-    cmd.Stderr = os.Stderr
-
-    // Attendre que le script soit complètement exécuté
-    err = cmd.Run()
+    cmd.Env = scriptEnv(ec, execution.ID, repoPath)
+    cmd.Stdout = output.f
+    cmd.Stderr = output.f
+
+    // Attendre que le script soit complètement exécuté, dans la limite du timeout de la tâche
+    status, err := runProcess(cmd, execution.ID, ec.Timeout)
+    switch status {
+    case statusTimeout:
+        err = fmt.Errorf("délai de %s dépassé", ec.Timeout)
+    case statusCancelled:
+        err = errExecutionCancelled
+    }
     if err != nil {
-        logger.Log("ERROR", "Erreur lors de l'exécution du script %s : %v", scriptName, err)
+        finishExecution(ec, execution, started, status, err, logger.Redact(output.String()))
+        logger.LogFields("ERROR", executionFields(ec, execution), "Erreur lors de l'exécution du script %s : %v", scriptName, err)
         return err
     }
 
-    logger.Log("INFO", "Script %s exécuté avec succès", scriptName)
+    finishExecution(ec, execution, started, statusSuccess, nil, logger.Redact(output.String()))
+    logger.LogFields("INFO", executionFields(ec, execution), "Script %s exécuté avec succès", scriptName)
     return nil
 }
 
@@ -0,0 +1,78 @@
+package repos
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"aidalinfo/ansible-lite/internal/db"
+)
+
+// Un script qui laisse un processus en arrière-plan (nohup ./app &) se termine sans attendre ce
+// processus, qui hérite de sa sortie, et sans qu'il soit arrêté
+func TestRunInitScriptBackgroundChild(t *testing.T) {
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "db.sqlite3")
+	if err := db.InitDB(dbPath); err != nil {
+		t.Fatal(err)
+	}
+	script := "#!/bin/sh\necho avant\nsleep 30 &\necho \"pid=$!\"\necho apres\n"
+	if err := os.WriteFile(filepath.Join(dir, "init.sh"), []byte(script), 0750); err != nil {
+		t.Fatal(err)
+	}
+
+	finished := make(chan int64, 1)
+	unregister := OnExecutionFinished(func(e db.Execution) {
+		if e.JobName == "background" {
+			finished <- e.ID
+		}
+	})
+	defer unregister()
+	ec := execContext{DBPath: dbPath, Kind: kindRepo, Name: "background", Timeout: 10 * time.Second}
+	done := make(chan error, 1)
+	go func() { done <- runInitScript(ec, "init.sh", dir) }()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("runInitScript : %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("runInitScript attend encore le processus lancé en arrière-plan")
+	}
+
+	var executionID int64
+	select {
+	case executionID = <-finished:
+	default:
+		t.Fatal("fin de l'exécution non signalée")
+	}
+	e, err := db.GetExecution(dbPath, executionID)
+	if err != nil || e == nil {
+		t.Fatalf("exécution %d introuvable : %v", executionID, err)
+	}
+	if e.Status != statusSuccess {
+		t.Errorf("statut = %q, attendu %q", e.Status, statusSuccess)
+	}
+	if !strings.Contains(e.Output, "avant") || !strings.Contains(e.Output, "apres") {
+		t.Errorf("sortie incomplète : %q", e.Output)
+	}
+
+	// Le processus en arrière-plan tourne toujours
+	i := strings.Index(e.Output, "pid=")
+	if i < 0 {
+		t.Fatalf("PID du processus en arrière-plan absent de la sortie : %q", e.Output)
+	}
+	pid, err := strconv.Atoi(strings.Fields(e.Output[i+len("pid="):])[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer syscall.Kill(pid, syscall.SIGKILL)
+	if err := syscall.Kill(pid, 0); err != nil {
+		t.Errorf("le processus en arrière-plan %d a été arrêté : %v", pid, err)
+	}
+}
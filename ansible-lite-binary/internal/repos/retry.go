@@ -0,0 +1,89 @@
+package repos
+
+import (
+	"errors"
+	"time"
+
+	"aidalinfo/ansible-lite/internal/logger"
+)
+
+// Phases d'une tâche pouvant être relancées
+const (
+	phaseDetect = "detect" // Interrogation de la forge, de git ls-remote ou du registre Docker
+	phaseClone  = "clone"
+	phaseScript = "script"
+)
+
+// Valeurs par défaut d'un bloc retry
+const (
+	defaultRetryAttempts = 3
+	defaultRetryDelay    = 10 * time.Second
+	defaultRetryFactor   = 2.0
+	defaultRetryMaxDelay = 10 * time.Minute
+)
+
+// Une exécution annulée par un opérateur n'est jamais relancée
+var errExecutionCancelled = errors.New("exécution annulée")
+
+// Politique de relance d'une tâche (bloc retry: de repos.yaml)
+type RetryPolicy struct {
+	MaxAttempts   int      `yaml:"max_attempts"`   // Nombre total de tentatives (3 par défaut)
+	InitialDelay  string   `yaml:"initial_delay"`  // Délai avant la première relance (10s par défaut)
+	BackoffFactor float64  `yaml:"backoff_factor"` // Multiplicateur du délai entre deux relances (2 par défaut)
+	MaxDelay      string   `yaml:"max_delay"`      // Délai maximal entre deux relances (10m par défaut)
+	On            []string `yaml:"on"`             // Phases relancées : detect, clone, script (detect et clone par défaut)
+}
+
+// Indiquer si une phase est relancée par la politique
+func (p *RetryPolicy) retries(phase string) bool {
+	if p == nil {
+		return false
+	}
+	if len(p.On) == 0 {
+		return phase == phaseDetect || phase == phaseClone
+	}
+	for _, on := range p.On {
+		if on == phase {
+			return true
+		}
+	}
+	return false
+}
+
+// Exécuter une phase en la relançant avec un délai exponentiel selon la politique de la tâche ;
+// la tâche rend sa place de worker pendant l'attente mais garde ses répertoires verrouillés
+func withRetry(policy *RetryPolicy, phase, kind, name string, fn func() error) error {
+	attempts := 1
+	delay, maxDelay, factor := defaultRetryDelay, defaultRetryMaxDelay, defaultRetryFactor
+	if policy.retries(phase) {
+		attempts = policy.MaxAttempts
+		if attempts <= 0 {
+			attempts = defaultRetryAttempts
+		}
+		if d, err := parseOptionalDuration(policy.InitialDelay); err == nil && d > 0 {
+			delay = d
+		}
+		if d, err := parseOptionalDuration(policy.MaxDelay); err == nil && d > 0 {
+			maxDelay = d
+		}
+		if policy.BackoffFactor >= 1 {
+			factor = policy.BackoffFactor
+		}
+	}
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = fn()
+		if err == nil || errors.Is(err, errExecutionCancelled) || attempt >= attempts {
+			return err
+		}
+		logger.Log("WARN", "Échec de la phase %s pour %s (tentative %d/%d), nouvelle tentative dans %s : %v", phase, name, attempt, attempts, delay, err)
+		resume := suspendJob(kind, name)
+		time.Sleep(delay)
+		resume()
+		delay = time.Duration(float64(delay) * factor)
+		if delay > maxDelay {
+			delay = maxDelay
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package repos
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"aidalinfo/ansible-lite/internal/db"
+)
+
+// Pendant l'attente entre deux tentatives, une tâche en échec rend sa place de worker mais garde
+// le verrou de son répertoire : avec un seul worker, une tâche sur un autre répertoire s'exécute,
+// une tâche sur le même répertoire attend la fin des tentatives sans bloquer le worker
+func TestRetryReleasesWorkerKeepsPathLock(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "db.sqlite3")
+	if err := db.InitDB(dbPath); err != nil {
+		t.Fatal(err)
+	}
+	settingsMu.Lock()
+	previous := workers
+	workers = make(chan struct{}, 1)
+	settingsMu.Unlock()
+	defer func() {
+		settingsMu.Lock()
+		workers = previous
+		settingsMu.Unlock()
+	}()
+
+	path := filepath.Join(t.TempDir(), "shared")
+	policy := &RetryPolicy{MaxAttempts: 2, InitialDelay: "1s", On: []string{phaseScript}}
+	failing := jobSpec{DBPath: dbPath, Kind: kindRepo, Name: "failing"}
+	other := jobSpec{DBPath: dbPath, Kind: kindRepo, Name: "other"}
+	sibling := jobSpec{DBPath: dbPath, Kind: kindRepo, Name: "sibling"}
+
+	retrying := make(chan struct{})
+	failingDone := make(chan struct{})
+	err := dispatchJob(failing, func() error {
+		unlock := lockPath(failing.Kind, failing.Name, path)
+		defer unlock()
+		defer close(failingDone)
+		attempt := 0
+		return withRetry(policy, phaseScript, failing.Kind, failing.Name, func() error {
+			if attempt++; attempt == 1 {
+				close(retrying)
+			}
+			return errors.New("échec")
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-retrying
+
+	otherDone := make(chan struct{})
+	if err := dispatchJob(other, func() error {
+		unlock := lockPath(other.Kind, other.Name, filepath.Join(t.TempDir(), "other"))
+		defer unlock()
+		close(otherDone)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-otherDone:
+	case <-failingDone:
+		t.Fatal("la tâche sur un autre répertoire a attendu la fin des tentatives de la tâche en échec")
+	case <-time.After(5 * time.Second):
+		t.Fatal("la tâche sur un autre répertoire ne s'est pas exécutée")
+	}
+
+	if pathLock(path).TryLock() {
+		pathLock(path).Unlock()
+		t.Fatal("le répertoire n'est plus verrouillé pendant l'attente entre deux tentatives")
+	}
+
+	siblingDone := make(chan struct{})
+	if err := dispatchJob(sibling, func() error {
+		unlock := lockPath(sibling.Kind, sibling.Name, path)
+		defer unlock()
+		close(siblingDone)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-siblingDone:
+	case <-time.After(5 * time.Second):
+		t.Fatal("la tâche sur le même répertoire ne s'est pas exécutée")
+	}
+	select {
+	case <-failingDone:
+	default:
+		t.Error("la tâche sur le même répertoire s'est exécutée pendant l'attente de la tâche en échec")
+	}
+}
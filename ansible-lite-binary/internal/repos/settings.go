@@ -0,0 +1,91 @@
+package repos
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"aidalinfo/ansible-lite/internal/config"
+	"aidalinfo/ansible-lite/internal/logger"
+)
+
+// Délai de grâce par défaut entre SIGTERM et SIGKILL
+const defaultKillGracePeriod = 10 * time.Second
+
+// Nombre de tâches traitées simultanément par défaut
+const defaultMaxWorkers = 4
+
+// Réglages globaux issus de config.yaml
+var (
+	settingsMu     sync.RWMutex
+	defaultTimeout time.Duration
+	killGrace      = defaultKillGracePeriod
+	workers        = make(chan struct{}, defaultMaxWorkers)
+)
+
+// Appliquer les réglages globaux de config.yaml utilisés par les tâches
+func Configure(cfg *config.GlobalConfig) error {
+	timeout, err := parseOptionalDuration(cfg.Global.ScriptTimeout)
+	if err != nil {
+		return fmt.Errorf("script_timeout invalide : %v", err)
+	}
+	grace, err := parseOptionalDuration(cfg.Global.KillGracePeriod)
+	if err != nil {
+		return fmt.Errorf("kill_grace_period invalide : %v", err)
+	}
+	if grace == 0 {
+		grace = defaultKillGracePeriod
+	}
+	if cfg.Global.MaxWorkers < 0 {
+		return fmt.Errorf("max_workers invalide : %d", cfg.Global.MaxWorkers)
+	}
+	maxWorkers := cfg.Global.MaxWorkers
+	if maxWorkers == 0 {
+		maxWorkers = defaultMaxWorkers
+	}
+
+	settingsMu.Lock()
+	defer settingsMu.Unlock()
+	defaultTimeout = timeout
+	killGrace = grace
+	// Les tâches en cours libèrent leur place dans l'ancien sémaphore
+	if cap(workers) != maxWorkers {
+		workers = make(chan struct{}, maxWorkers)
+	}
+	return nil
+}
+
+// Lire une durée Go (ex. 30m, 1h30m), vide signifiant 0
+func parseOptionalDuration(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("durée négative : %s", value)
+	}
+	return d, nil
+}
+
+func killGracePeriod() time.Duration {
+	settingsMu.RLock()
+	defer settingsMu.RUnlock()
+	return killGrace
+}
+
+// Timeout du script de la tâche, ou le timeout global si la tâche n'en définit pas (0 = illimité)
+func (o JobOptions) scriptTimeout() time.Duration {
+	if o.Timeout != "" {
+		d, err := parseOptionalDuration(o.Timeout)
+		if err == nil {
+			return d
+		}
+		logger.Log("ERROR", "Timeout invalide %s, utilisation du timeout global : %v", o.Timeout, err)
+	}
+	settingsMu.RLock()
+	defer settingsMu.RUnlock()
+	return defaultTimeout
+}
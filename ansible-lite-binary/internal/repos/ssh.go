@@ -0,0 +1,34 @@
+package repos
+
+import (
+	"strings"
+)
+
+// Entourer une valeur de quotes simples pour l'interpréteur de GIT_SSH_COMMAND
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// Commande ssh utilisant la clé de déploiement de la tâche (vide si aucune clé n'est configurée)
+func sshCommand(opts JobOptions) string {
+	if opts.SSHKey == "" {
+		return ""
+	}
+
+	args := []string{"ssh", "-i", shellQuote(opts.SSHKey), "-o", "IdentitiesOnly=yes", "-o", "BatchMode=yes"}
+	strict := opts.StrictHostKeyChecking == nil || *opts.StrictHostKeyChecking
+	if strict {
+		args = append(args, "-o", "StrictHostKeyChecking=yes")
+	} else {
+		args = append(args, "-o", "StrictHostKeyChecking=no")
+	}
+
+	switch {
+	case opts.KnownHosts != "":
+		args = append(args, "-o", "UserKnownHostsFile="+shellQuote(opts.KnownHosts))
+	case !strict:
+		// Sans vérification, ne pas polluer le known_hosts de l'utilisateur du service
+		args = append(args, "-o", "UserKnownHostsFile=/dev/null")
+	}
+	return strings.Join(args, " ")
+}
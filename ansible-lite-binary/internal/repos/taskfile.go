@@ -0,0 +1,108 @@
+package repos
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"aidalinfo/ansible-lite/internal/db"
+	"aidalinfo/ansible-lite/internal/facts"
+	"aidalinfo/ansible-lite/internal/logger"
+	"aidalinfo/ansible-lite/internal/tasks"
+)
+
+// Nom de l'hôte dans le récapitulatif : les tâches déclaratives s'exécutent toujours en local
+const tasksHost = "localhost"
+
+// Exécuter un fichier de tâches déclaratives (tasks.yaml) du dépôt cloné
+func runTasks(ec execContext, tasksFile, repoPath string) error {
+	started := time.Now()
+	execution := startExecution(ec)
+	path := filepath.Join(repoPath, tasksFile)
+
+	logger.LogFields("INFO", executionFields(ec, execution), "Exécution des tâches %s dans le dépôt %s (exécution %d)", tasksFile, repoPath, execution.ID)
+
+	// Timeout de la tâche et annulation depuis l'API
+	ctx, cancel := context.Background(), context.CancelFunc(func() {})
+	if ec.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, ec.Timeout)
+	}
+	ctx, stop := context.WithCancel(ctx)
+	defer stop()
+	defer cancel()
+	r, untrack := trackExecution(execution.ID)
+	defer untrack()
+	cancelled := make(chan struct{})
+	go func() {
+		select {
+		case <-r.cancel:
+			close(cancelled)
+			stop()
+		case <-ctx.Done():
+		}
+	}()
+
+	var output tailBuffer
+	report, err := tasks.Run(ctx, path, tasks.Options{
+		BaseDir:   repoPath,
+		Vars:      ec.Vars,
+		Env:       scriptEnv(ec, execution.ID, repoPath),
+		Facts:     facts.Get(),
+		Output:    &output,
+		KillGrace: killGracePeriod(),
+	})
+	if report != nil {
+		execution.Recap = tasksRecap(tasksFile, report)
+	}
+
+	status := statusSuccess
+	switch {
+	case err == nil:
+	case isClosed(cancelled):
+		status, err = statusCancelled, errExecutionCancelled
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		status, err = statusTimeout, fmt.Errorf("délai de %s dépassé", ec.Timeout)
+	default:
+		status = statusFailed
+	}
+
+	if err != nil {
+		output.Write([]byte(err.Error() + "\n"))
+		finishExecution(ec, execution, started, status, err, logger.Redact(output.String()))
+		logger.LogFields("ERROR", executionFields(ec, execution), "Erreur lors de l'exécution des tâches %s : %v", tasksFile, err)
+		return err
+	}
+
+	finishExecution(ec, execution, started, statusSuccess, nil, logger.Redact(output.String()))
+	logger.LogFields("INFO", executionFields(ec, execution), "Tâches %s exécutées avec succès", tasksFile)
+	return nil
+}
+
+// Indiquer si un canal a été fermé
+func isClosed(c chan struct{}) bool {
+	select {
+	case <-c:
+		return true
+	default:
+		return false
+	}
+}
+
+// Récapitulatif des tâches au même format que celui d'un playbook
+func tasksRecap(tasksFile string, report *tasks.Report) *db.PlaybookRecap {
+	recap := &db.PlaybookRecap{Hosts: []db.HostRecap{{
+		Host: tasksHost, Ok: report.Ok, Changed: report.Changed, Failed: report.Failed,
+	}}}
+	for _, result := range report.Results {
+		name := result.Name
+		if result.Handler {
+			name = "handler : " + name
+		}
+		recap.Tasks = append(recap.Tasks, db.TaskRecap{
+			Play: tasksFile, Task: name, Host: tasksHost, Status: result.Status, Message: logger.Redact(result.Message),
+		})
+	}
+	return recap
+}
@@ -0,0 +1,271 @@
+package repos
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"aidalinfo/ansible-lite/internal/logger"
+)
+
+// Préfixes des références git envoyées par les forges
+const (
+	refHeads = "refs/heads/"
+	refTags  = "refs/tags/"
+)
+
+// Signature absente ou invalide pour toutes les tâches concernées par le webhook
+var ErrInvalidSignature = errors.New("signature du webhook invalide")
+
+// Événement push (branche ou tag) reçu d'une forge
+type webhookEvent struct {
+	Ref  string   // refs/heads/<branche> ou refs/tags/<tag>
+	URLs []string // URLs du dépôt (https, ssh, page web)
+}
+
+// Dépôt tel que décrit dans les payloads GitHub et Gitea/Forgejo
+type hookRepository struct {
+	CloneURL string `json:"clone_url"`
+	SSHURL   string `json:"ssh_url"`
+	HTMLURL  string `json:"html_url"`
+}
+
+// Projet tel que décrit dans les payloads GitLab
+type hookProject struct {
+	HTTPURL string `json:"git_http_url"`
+	SSHURL  string `json:"git_ssh_url"`
+	WebURL  string `json:"web_url"`
+}
+
+// Décoder un événement push ; ok est faux pour les événements ignorés (ping, issues...)
+func parseWebhook(providerName string, header http.Header, body []byte) (webhookEvent, bool, error) {
+	var event string
+	switch providerName {
+	case "github":
+		event = header.Get("X-GitHub-Event")
+	case "gitea", "forgejo":
+		event = header.Get("X-Gitea-Event")
+		if event == "" {
+			event = header.Get("X-Forgejo-Event")
+		}
+	case "gitlab":
+		event = header.Get("X-Gitlab-Event")
+	case "bitbucket":
+		event = header.Get("X-Event-Key")
+	default:
+		return webhookEvent{}, false, fmt.Errorf("fournisseur de webhook inconnu : %s", providerName)
+	}
+
+	switch providerName {
+	case "gitlab":
+		if event != "Push Hook" && event != "Tag Push Hook" {
+			return webhookEvent{}, false, nil
+		}
+		var payload struct {
+			Ref        string      `json:"ref"`
+			Project    hookProject `json:"project"`
+			Repository hookProject `json:"repository"`
+		}
+		if err := json.Unmarshal(body, &payload); err != nil {
+			return webhookEvent{}, false, fmt.Errorf("payload invalide : %v", err)
+		}
+		return webhookEvent{Ref: payload.Ref, URLs: []string{
+			payload.Project.HTTPURL, payload.Project.SSHURL, payload.Project.WebURL,
+			payload.Repository.HTTPURL, payload.Repository.SSHURL,
+		}}, true, nil
+	case "bitbucket":
+		if event != "repo:push" {
+			return webhookEvent{}, false, nil
+		}
+		var payload struct {
+			Push struct {
+				Changes []struct {
+					New *struct {
+						Type string `json:"type"` // branch ou tag
+						Name string `json:"name"`
+					} `json:"new"`
+				} `json:"changes"`
+			} `json:"push"`
+			Repository struct {
+				Links struct {
+					HTML struct {
+						Href string `json:"href"`
+					} `json:"html"`
+				} `json:"links"`
+			} `json:"repository"`
+		}
+		if err := json.Unmarshal(body, &payload); err != nil {
+			return webhookEvent{}, false, fmt.Errorf("payload invalide : %v", err)
+		}
+		// Bitbucket décrit les références poussées sans préfixe ; seule la première créée ou mise
+		// à jour est retenue (une suppression n'a pas de "new")
+		for _, change := range payload.Push.Changes {
+			if change.New == nil {
+				continue
+			}
+			prefix := refHeads
+			if change.New.Type == "tag" {
+				prefix = refTags
+			}
+			return webhookEvent{Ref: prefix + change.New.Name, URLs: []string{payload.Repository.Links.HTML.Href}}, true, nil
+		}
+		return webhookEvent{}, false, nil
+	default:
+		if event != "push" {
+			return webhookEvent{}, false, nil
+		}
+		var payload struct {
+			Ref        string         `json:"ref"`
+			Repository hookRepository `json:"repository"`
+		}
+		if err := json.Unmarshal(body, &payload); err != nil {
+			return webhookEvent{}, false, fmt.Errorf("payload invalide : %v", err)
+		}
+		return webhookEvent{Ref: payload.Ref, URLs: []string{
+			payload.Repository.CloneURL, payload.Repository.SSHURL, payload.Repository.HTMLURL,
+		}}, true, nil
+	}
+}
+
+// Vérifier la signature d'un webhook avec le secret d'une tâche
+func verifyWebhook(providerName string, header http.Header, body []byte, secret string) bool {
+	if secret == "" {
+		return false
+	}
+	// GitLab transmet le secret tel quel
+	if providerName == "gitlab" {
+		token := header.Get("X-Gitlab-Token")
+		return subtle.ConstantTimeCompare([]byte(token), []byte(secret)) == 1
+	}
+
+	var signature string
+	switch providerName {
+	case "github":
+		signature = strings.TrimPrefix(header.Get("X-Hub-Signature-256"), "sha256=")
+	case "bitbucket":
+		signature = strings.TrimPrefix(header.Get("X-Hub-Signature"), "sha256=")
+	default:
+		signature = header.Get("X-Gitea-Signature")
+		if signature == "" {
+			signature = header.Get("X-Forgejo-Signature")
+		}
+	}
+	expected, err := hex.DecodeString(signature)
+	if err != nil || len(expected) == 0 {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(mac.Sum(nil), expected)
+}
+
+// Identifier un dépôt indépendamment du protocole : hôte/owner/repo en minuscules
+func repoIdentity(repoURL string) string {
+	if repoURL == "" {
+		return ""
+	}
+	ref, err := parseRepoURL(repoURL)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(ref.Host + "/" + ref.Path)
+}
+
+// Indiquer si la tâche surveille la référence poussée sur l'un des dépôts de l'événement
+func (spec jobSpec) watches(event webhookEvent) bool {
+	if spec.run == nil {
+		return false
+	}
+
+	matchesURL := false
+	for _, watched := range spec.URLs {
+		id := repoIdentity(watched)
+		for _, u := range event.URLs {
+			if id != "" && id == repoIdentity(u) {
+				matchesURL = true
+			}
+		}
+	}
+	if !matchesURL {
+		return false
+	}
+
+	switch spec.Kind {
+	case kindRepo:
+		return event.Ref == refHeads+spec.Branch
+	case kindFlux:
+		if !strings.HasPrefix(event.Ref, refTags) {
+			return false
+		}
+		re, err := compileRegex(spec.Regex)
+		if err != nil {
+			return false
+		}
+		return re.MatchString(strings.TrimPrefix(event.Ref, refTags))
+	}
+	return false
+}
+
+// Traiter un webhook de forge et déclencher immédiatement les tâches correspondantes.
+// Seules les tâches dont le webhook_secret valide la signature sont déclenchées ;
+// la surveillance par cron reste active en parallèle. Sans tâche correspondante, la signature
+// est vérifiée avec les secrets de toutes les tâches : un appelant qui ne connaît aucun secret
+// reçoit la même erreur qu'un dépôt ou une branche surveillés soient concernés ou non.
+func HandleWebhook(providerName string, header http.Header, body []byte) ([]string, error) {
+	providerName = strings.ToLower(providerName)
+	event, ok, err := parseWebhook(providerName, header, body)
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	jobsMu.Lock()
+	var candidates []jobSpec
+	var secrets []string
+	for _, spec := range configured {
+		if spec.watches(event) {
+			candidates = append(candidates, spec)
+		}
+		if spec.Options.WebhookSecret != "" {
+			secrets = append(secrets, spec.Options.WebhookSecret)
+		}
+	}
+	jobsMu.Unlock()
+
+	if len(candidates) == 0 {
+		for _, secret := range secrets {
+			if verifyWebhook(providerName, header, body, secret) {
+				logger.Log("INFO", "Webhook %s reçu pour %s sans tâche correspondante", providerName, event.Ref)
+				return nil, nil
+			}
+		}
+		logger.Log("ERROR", "Webhook %s reçu pour %s avec une signature invalide", providerName, event.Ref)
+		return nil, ErrInvalidSignature
+	}
+
+	verified := false
+	var triggered []string
+	for _, spec := range candidates {
+		if !verifyWebhook(providerName, header, body, spec.Options.WebhookSecret) {
+			continue
+		}
+		verified = true
+		key := jobKey(spec.Kind, spec.Name)
+		logger.Log("INFO", "Webhook %s reçu pour %s, déclenchement de la tâche %s", providerName, event.Ref, key)
+		if dispatchJob(spec, spec.poll) == nil {
+			triggered = append(triggered, key)
+		}
+	}
+	if !verified {
+		logger.Log("ERROR", "Webhook %s reçu pour %s avec une signature invalide", providerName, event.Ref)
+		return nil, ErrInvalidSignature
+	}
+	sort.Strings(triggered)
+	return triggered, nil
+}
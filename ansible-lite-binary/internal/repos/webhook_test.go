@@ -0,0 +1,217 @@
+package repos
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"testing"
+)
+
+func sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerifyWebhook(t *testing.T) {
+	const secret = "secret-partagé"
+	body := []byte(`{"ref":"refs/heads/main"}`)
+	valid := sign(secret, body)
+	wrongSecret := sign("autre-secret", body)
+	otherBody := sign(secret, []byte(`{"ref":"refs/heads/autre"}`))
+
+	tests := []struct {
+		name     string
+		provider string
+		header   map[string]string
+		secret   string
+		want     bool
+	}{
+		{"github valide", "github", map[string]string{"X-Hub-Signature-256": "sha256=" + valid}, secret, true},
+		{"github sans préfixe", "github", map[string]string{"X-Hub-Signature-256": valid}, secret, true},
+		{"github autre secret", "github", map[string]string{"X-Hub-Signature-256": "sha256=" + wrongSecret}, secret, false},
+		{"github autre corps", "github", map[string]string{"X-Hub-Signature-256": "sha256=" + otherBody}, secret, false},
+		{"github signature tronquée", "github", map[string]string{"X-Hub-Signature-256": "sha256=" + valid[:32]}, secret, false},
+		{"github signature non hexadécimale", "github", map[string]string{"X-Hub-Signature-256": "sha256=zz"}, secret, false},
+		{"github en-tête SHA-1 seul", "github", map[string]string{"X-Hub-Signature": "sha1=" + valid}, secret, false},
+		{"github en-tête absent", "github", nil, secret, false},
+		{"github secret vide", "github", map[string]string{"X-Hub-Signature-256": "sha256=" + sign("", body)}, "", false},
+
+		{"gitea valide", "gitea", map[string]string{"X-Gitea-Signature": valid}, secret, true},
+		{"forgejo valide", "forgejo", map[string]string{"X-Forgejo-Signature": valid}, secret, true},
+		{"gitea autre secret", "gitea", map[string]string{"X-Gitea-Signature": wrongSecret}, secret, false},
+		{"forgejo autre corps", "forgejo", map[string]string{"X-Forgejo-Signature": otherBody}, secret, false},
+		{"gitea en-tête absent", "gitea", nil, secret, false},
+		{"gitea secret vide", "gitea", map[string]string{"X-Gitea-Signature": sign("", body)}, "", false},
+
+		{"bitbucket valide", "bitbucket", map[string]string{"X-Hub-Signature": "sha256=" + valid}, secret, true},
+		{"bitbucket autre secret", "bitbucket", map[string]string{"X-Hub-Signature": "sha256=" + wrongSecret}, secret, false},
+		{"bitbucket autre corps", "bitbucket", map[string]string{"X-Hub-Signature": "sha256=" + otherBody}, secret, false},
+		{"bitbucket en-tête absent", "bitbucket", nil, secret, false},
+		{"bitbucket secret vide", "bitbucket", map[string]string{"X-Hub-Signature": "sha256=" + sign("", body)}, "", false},
+
+		{"gitlab valide", "gitlab", map[string]string{"X-Gitlab-Token": secret}, secret, true},
+		{"gitlab autre jeton", "gitlab", map[string]string{"X-Gitlab-Token": "autre-secret"}, secret, false},
+		{"gitlab préfixe du secret", "gitlab", map[string]string{"X-Gitlab-Token": secret[:6]}, secret, false},
+		{"gitlab signature HMAC", "gitlab", map[string]string{"X-Gitlab-Token": valid}, secret, false},
+		{"gitlab en-tête absent", "gitlab", nil, secret, false},
+		{"gitlab secret vide", "gitlab", map[string]string{"X-Gitlab-Token": ""}, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			for k, v := range tt.header {
+				header.Set(k, v)
+			}
+			if got := verifyWebhook(tt.provider, header, body, tt.secret); got != tt.want {
+				t.Errorf("verifyWebhook = %v, attendu %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseWebhook(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider string
+		header   map[string]string
+		body     string
+		ok       bool
+		ref      string
+		url      string
+	}{
+		{"github push", "github", map[string]string{"X-GitHub-Event": "push"},
+			`{"ref":"refs/heads/main","repository":{"clone_url":"https://github.com/org/infra.git"}}`,
+			true, "refs/heads/main", "https://github.com/org/infra.git"},
+		{"github ping ignoré", "github", map[string]string{"X-GitHub-Event": "ping"}, `{"zen":"..."}`, false, "", ""},
+		{"gitea tag", "gitea", map[string]string{"X-Gitea-Event": "push"},
+			`{"ref":"refs/tags/v1.2.0","repository":{"ssh_url":"git@gitea.example.com:org/infra.git"}}`,
+			true, "refs/tags/v1.2.0", "git@gitea.example.com:org/infra.git"},
+		{"forgejo push", "forgejo", map[string]string{"X-Forgejo-Event": "push"},
+			`{"ref":"refs/heads/main","repository":{"html_url":"https://codeberg.org/org/infra"}}`,
+			true, "refs/heads/main", "https://codeberg.org/org/infra"},
+		{"gitlab tag", "gitlab", map[string]string{"X-Gitlab-Event": "Tag Push Hook"},
+			`{"ref":"refs/tags/v2","project":{"git_http_url":"https://gitlab.com/org/infra.git"}}`,
+			true, "refs/tags/v2", "https://gitlab.com/org/infra.git"},
+		{"gitlab merge request ignorée", "gitlab", map[string]string{"X-Gitlab-Event": "Merge Request Hook"}, `{}`, false, "", ""},
+		{"bitbucket branche", "bitbucket", map[string]string{"X-Event-Key": "repo:push"},
+			`{"push":{"changes":[{"new":{"type":"branch","name":"main"}}]},"repository":{"links":{"html":{"href":"https://bitbucket.org/org/infra"}}}}`,
+			true, "refs/heads/main", "https://bitbucket.org/org/infra"},
+		{"bitbucket tag après suppression", "bitbucket", map[string]string{"X-Event-Key": "repo:push"},
+			`{"push":{"changes":[{"new":null},{"new":{"type":"tag","name":"v3"}}]},"repository":{"links":{"html":{"href":"https://bitbucket.org/org/infra"}}}}`,
+			true, "refs/tags/v3", "https://bitbucket.org/org/infra"},
+		{"bitbucket suppression seule", "bitbucket", map[string]string{"X-Event-Key": "repo:push"},
+			`{"push":{"changes":[{"new":null}]}}`, false, "", ""},
+		{"bitbucket autre événement", "bitbucket", map[string]string{"X-Event-Key": "pullrequest:created"}, `{}`, false, "", ""},
+		{"en-tête d'événement absent", "github", nil, `{"ref":"refs/heads/main"}`, false, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			for k, v := range tt.header {
+				header.Set(k, v)
+			}
+			event, ok, err := parseWebhook(tt.provider, header, []byte(tt.body))
+			if err != nil {
+				t.Fatalf("parseWebhook : %v", err)
+			}
+			if ok != tt.ok || event.Ref != tt.ref {
+				t.Fatalf("parseWebhook = (%q, %v), attendu (%q, %v)", event.Ref, ok, tt.ref, tt.ok)
+			}
+			if !tt.ok {
+				return
+			}
+			found := false
+			for _, u := range event.URLs {
+				found = found || u == tt.url
+			}
+			if !found {
+				t.Errorf("URL %s absente de %v", tt.url, event.URLs)
+			}
+		})
+	}
+
+	if _, _, err := parseWebhook("inconnu", http.Header{}, nil); err == nil {
+		t.Error("fournisseur inconnu accepté")
+	}
+	if _, _, err := parseWebhook("github", http.Header{"X-Github-Event": {"push"}}, []byte("{")); err == nil {
+		t.Error("payload invalide accepté")
+	}
+}
+
+// Les URLs des payloads désignent le dépôt surveillé quel que soit le protocole
+func TestJobWatchesWebhookEvent(t *testing.T) {
+	run := func(bool) error { return nil }
+	repo := jobSpec{Kind: kindRepo, URLs: []string{"https://bitbucket.org/Org/infra.git"}, Branch: "main", run: run}
+	flux := jobSpec{Kind: kindFlux, URLs: []string{"git@github.com:org/infra.git"}, Regex: `^v\d+`, run: run}
+
+	tests := []struct {
+		name  string
+		spec  jobSpec
+		event webhookEvent
+		want  bool
+	}{
+		{"branche surveillée", repo, webhookEvent{Ref: "refs/heads/main", URLs: []string{"https://bitbucket.org/org/infra"}}, true},
+		{"autre branche", repo, webhookEvent{Ref: "refs/heads/dev", URLs: []string{"https://bitbucket.org/org/infra"}}, false},
+		{"tag sur un dépôt", repo, webhookEvent{Ref: "refs/tags/main", URLs: []string{"https://bitbucket.org/org/infra"}}, false},
+		{"autre dépôt", repo, webhookEvent{Ref: "refs/heads/main", URLs: []string{"https://bitbucket.org/org/autre"}}, false},
+		{"tag correspondant", flux, webhookEvent{Ref: "refs/tags/v1.0", URLs: []string{"https://github.com/org/infra.git"}}, true},
+		{"tag non correspondant", flux, webhookEvent{Ref: "refs/tags/release-1", URLs: []string{"https://github.com/org/infra.git"}}, false},
+		{"branche sur un flux", flux, webhookEvent{Ref: "refs/heads/v1", URLs: []string{"https://github.com/org/infra.git"}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.spec.watches(tt.event); got != tt.want {
+				t.Errorf("watches = %v, attendu %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// Sans signature valide, la réponse est la même que le dépôt et la branche soient surveillés ou
+// non ; avec le secret d'une tâche, un push sans tâche correspondante est simplement ignoré
+func TestHandleWebhookDoesNotRevealJobs(t *testing.T) {
+	const secret = "secret-partagé"
+	jobsMu.Lock()
+	previous := configured
+	configured = map[string]jobSpec{
+		"repo/infra": {Kind: kindRepo, Name: "infra", URLs: []string{"https://github.com/org/infra.git"}, Branch: "main",
+			Options: JobOptions{WebhookSecret: secret}, run: func(bool) error { return nil }},
+	}
+	jobsMu.Unlock()
+	defer func() {
+		jobsMu.Lock()
+		configured = previous
+		jobsMu.Unlock()
+	}()
+
+	push := func(ref, repoURL string) []byte {
+		return []byte(`{"ref":"` + ref + `","repository":{"clone_url":"` + repoURL + `"}}`)
+	}
+	tests := []struct {
+		name    string
+		body    []byte
+		secret  string
+		wantErr error
+	}{
+		{"dépôt surveillé sans signature", push("refs/heads/main", "https://github.com/org/infra.git"), "", ErrInvalidSignature},
+		{"autre branche sans signature", push("refs/heads/dev", "https://github.com/org/infra.git"), "", ErrInvalidSignature},
+		{"autre dépôt sans signature", push("refs/heads/main", "https://github.com/org/autre.git"), "", ErrInvalidSignature},
+		{"autre dépôt, autre secret", push("refs/heads/main", "https://github.com/org/autre.git"), "autre-secret", ErrInvalidSignature},
+		{"autre branche signée", push("refs/heads/dev", "https://github.com/org/infra.git"), secret, nil},
+		{"autre dépôt signé", push("refs/heads/main", "https://github.com/org/autre.git"), secret, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{"X-Github-Event": {"push"}}
+			if tt.secret != "" {
+				header.Set("X-Hub-Signature-256", "sha256="+sign(tt.secret, tt.body))
+			}
+			triggered, err := HandleWebhook("github", header, tt.body)
+			if err != tt.wantErr || len(triggered) != 0 {
+				t.Errorf("HandleWebhook = %v, %v, attendu aucune tâche et %v", triggered, err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package tasks
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Module command : commande shell, ignorée si creates existe ou si unless réussit
+type CommandModule struct {
+	Cmd     string `yaml:"cmd"`
+	Chdir   string `yaml:"chdir"`   // Répertoire d'exécution (répertoire cloné par défaut)
+	Creates string `yaml:"creates"` // Ne rien faire si ce chemin existe
+	Unless  string `yaml:"unless"`  // Ne rien faire si cette commande réussit
+}
+
+// Accepter aussi la forme courte : command: "systemctl daemon-reload"
+func (m *CommandModule) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var cmd string
+	if err := unmarshal(&cmd); err == nil {
+		m.Cmd = cmd
+		return nil
+	}
+	type plain CommandModule
+	return unmarshal((*plain)(m))
+}
+
+func (m *CommandModule) run(rc *runContext) (bool, error) {
+	if m.Cmd == "" {
+		return false, fmt.Errorf("cmd obligatoire")
+	}
+	if m.Creates != "" {
+		if _, err := os.Stat(rc.path(m.Creates)); err == nil {
+			return false, nil
+		}
+	}
+	dir := rc.baseDir
+	if m.Chdir != "" {
+		dir = rc.path(m.Chdir)
+	}
+	if m.Unless != "" {
+		if err := rc.shell(dir, m.Unless, false); err == nil {
+			return false, nil
+		}
+	}
+	if err := rc.shell(dir, m.Cmd, true); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Lancer une commande shell ; sa sortie est journalisée si verbose. Elle passe par un fichier
+// temporaire et non par un tube, pour que cmd.Wait() n'attende pas les processus laissés en
+// arrière-plan par la commande (nohup ./app &)
+func (rc *runContext) shell(dir, command string, verbose bool) error {
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Dir = dir
+	cmd.Env = rc.env
+	if !verbose {
+		return rc.runCommand(cmd)
+	}
+
+	output, err := os.CreateTemp("", "ansible-lite-output-")
+	if err != nil {
+		return fmt.Errorf("impossible de créer le fichier de sortie de la commande : %v", err)
+	}
+	os.Remove(output.Name())
+	defer output.Close()
+	cmd.Stdout = output
+	cmd.Stderr = output
+	err = rc.runCommand(cmd)
+
+	// Sortie écrite jusqu'à la fin de la commande
+	if info, statErr := output.Stat(); statErr == nil {
+		io.Copy(rc.output, io.NewSectionReader(output, 0, info.Size()))
+	}
+	return err
+}
+
+// Lancer la commande dans son propre groupe de processus et l'attendre ; au timeout ou à
+// l'annulation, tout le groupe est arrêté (SIGTERM puis SIGKILL après le délai de grâce),
+// comme les scripts et les playbooks
+func (rc *runContext) runCommand(cmd *exec.Cmd) error {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+
+	select {
+	case err := <-exited:
+		return err
+	case <-rc.ctx.Done():
+	}
+
+	syscall.Kill(-cmd.Process.Pid, syscall.SIGTERM)
+	grace := time.NewTimer(rc.grace)
+	defer grace.Stop()
+	select {
+	case <-exited:
+	case <-grace.C:
+		syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		<-exited
+	}
+	return rc.ctx.Err()
+}
+
+// Module service : état et activation d'une unité systemd
+type ServiceModule struct {
+	Name    string `yaml:"name"`
+	State   string `yaml:"state"`   // started, stopped, restarted ou reloaded
+	Enabled *bool  `yaml:"enabled"` // Activer ou désactiver l'unité au démarrage
+}
+
+func (m *ServiceModule) run(rc *runContext) (bool, error) {
+	if m.Name == "" {
+		return false, fmt.Errorf("name obligatoire")
+	}
+	systemctl := func(args ...string) error {
+		return rc.shell(rc.baseDir, "systemctl "+strings.Join(append(args, shellQuote(m.Name)), " "), false)
+	}
+	changed := false
+
+	if m.Enabled != nil {
+		enabled := systemctl("is-enabled", "--quiet") == nil
+		if enabled != *m.Enabled {
+			action := "disable"
+			if *m.Enabled {
+				action = "enable"
+			}
+			if err := systemctl(action); err != nil {
+				return false, fmt.Errorf("systemctl %s %s : %v", action, m.Name, err)
+			}
+			changed = true
+		}
+	}
+
+	active := func() bool { return systemctl("is-active", "--quiet") == nil }
+	var action string
+	switch m.State {
+	case "":
+	case "started":
+		if !active() {
+			action = "start"
+		}
+	case "stopped":
+		if active() {
+			action = "stop"
+		}
+	case "restarted":
+		action = "restart"
+	case "reloaded":
+		action = "reload"
+	default:
+		return false, fmt.Errorf("state inconnu %q", m.State)
+	}
+	if action != "" {
+		if err := systemctl(action); err != nil {
+			return changed, fmt.Errorf("systemctl %s %s : %v", action, m.Name, err)
+		}
+		changed = true
+	}
+	return changed, nil
+}
+
+// Protéger une valeur pour le shell
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
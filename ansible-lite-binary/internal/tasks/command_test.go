@@ -0,0 +1,61 @@
+package tasks
+
+import (
+	"context"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Indiquer si un processus tourne encore (un zombie en attente de son parent est terminé)
+func processRunning(pid int) bool {
+	data, err := ioutil.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+	if err != nil {
+		return false
+	}
+	fields := strings.Fields(string(data[strings.LastIndex(string(data), ")")+1:]))
+	return len(fields) > 0 && fields[0] != "Z"
+}
+
+// Au timeout, tout le groupe de processus de la commande est arrêté, pas seulement sh
+func TestShellTimeoutKillsProcessGroup(t *testing.T) {
+	rc := testContext(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	rc.ctx = ctx
+	rc.grace = time.Second
+
+	started := time.Now()
+	err := rc.shell(rc.baseDir, "sleep 30 & echo $! > enfant.pid; wait", true)
+	if err != context.DeadlineExceeded {
+		t.Errorf("erreur %v, attendu %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(started); elapsed > 5*time.Second {
+		t.Errorf("commande arrêtée après %s", elapsed)
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(readFile(t, rc.path("enfant.pid"))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(2 * time.Second); processRunning(pid); {
+		if time.Now().After(deadline) {
+			t.Errorf("le processus %d lancé par la commande tourne encore", pid)
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// Sans timeout, l'erreur de la commande est remontée telle quelle
+func TestShellExitStatus(t *testing.T) {
+	rc := testContext(t)
+	if err := rc.shell(rc.baseDir, "exit 3", false); err == nil || !strings.Contains(err.Error(), "exit status 3") {
+		t.Errorf("erreur %v, attendu exit status 3", err)
+	}
+	if err := rc.shell(rc.baseDir, "true", false); err != nil {
+		t.Errorf("commande réussie : %v", err)
+	}
+}
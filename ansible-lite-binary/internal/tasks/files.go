@@ -0,0 +1,368 @@
+package tasks
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/template"
+)
+
+// Attributs communs des fichiers gérés
+type fileAttrs struct {
+	Mode  string `yaml:"mode"` // Permissions en octal (ex. "0644")
+	Owner string `yaml:"owner"`
+	Group string `yaml:"group"`
+}
+
+// Appliquer permissions et propriétaire, en indiquant si quelque chose a changé
+func (a fileAttrs) apply(path string) (bool, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return false, err
+	}
+	changed := false
+
+	if a.Mode != "" {
+		mode, err := strconv.ParseUint(a.Mode, 8, 32)
+		if err != nil {
+			return false, fmt.Errorf("mode invalide %q", a.Mode)
+		}
+		// Les permissions d'un lien symbolique sont celles de sa cible, modifiée par os.Chmod
+		target, err := os.Stat(path)
+		if err != nil {
+			return false, err
+		}
+		if target.Mode().Perm() != os.FileMode(mode).Perm() {
+			if err := os.Chmod(path, os.FileMode(mode)); err != nil {
+				return false, err
+			}
+			changed = true
+		}
+	}
+
+	if a.Owner == "" && a.Group == "" {
+		return changed, nil
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return changed, fmt.Errorf("propriétaire de %s non disponible", path)
+	}
+	uid, gid := int(stat.Uid), int(stat.Gid)
+	if a.Owner != "" {
+		if uid, err = lookupID(a.Owner, func(name string) (string, error) {
+			u, err := user.Lookup(name)
+			if err != nil {
+				return "", err
+			}
+			return u.Uid, nil
+		}); err != nil {
+			return changed, err
+		}
+	}
+	if a.Group != "" {
+		if gid, err = lookupID(a.Group, func(name string) (string, error) {
+			g, err := user.LookupGroup(name)
+			if err != nil {
+				return "", err
+			}
+			return g.Gid, nil
+		}); err != nil {
+			return changed, err
+		}
+	}
+	if uid != int(stat.Uid) || gid != int(stat.Gid) {
+		if err := os.Lchown(path, uid, gid); err != nil {
+			return changed, err
+		}
+		changed = true
+	}
+	return changed, nil
+}
+
+// Identifiant numérique d'un utilisateur ou d'un groupe, donné par son nom ou directement
+func lookupID(name string, lookup func(string) (string, error)) (int, error) {
+	if id, err := strconv.Atoi(name); err == nil {
+		return id, nil
+	}
+	id, err := lookup(name)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(id)
+}
+
+// Remplacer le contenu d'un fichier de façon atomique : écriture dans un fichier temporaire du
+// même répertoire puis renommage, pour qu'un service ne lise jamais un fichier à moitié écrit.
+// Un fichier existant garde ses permissions et, si possible, son propriétaire ; un lien
+// symbolique est conservé et c'est sa cible qui est remplacée
+func replaceFile(path string, content []byte) error {
+	if target, err := filepath.EvalSymlinks(path); err == nil {
+		path = target
+	}
+	perm, uid, gid := os.FileMode(0644), -1, -1
+	if info, err := os.Stat(path); err == nil {
+		perm = info.Mode().Perm()
+		if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+			uid, gid = int(stat.Uid), int(stat.Gid)
+		}
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	if uid >= 0 {
+		// Sans les droits root, le fichier appartient à l'utilisateur du service
+		os.Lchown(tmp.Name(), uid, gid)
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Écrire un fichier seulement si son contenu diffère, puis appliquer ses attributs
+func writeFile(path string, content []byte, attrs fileAttrs) (bool, error) {
+	existing, err := ioutil.ReadFile(path)
+	changed := false
+	if err != nil || !bytes.Equal(existing, content) {
+		if err != nil && !os.IsNotExist(err) {
+			return false, err
+		}
+		if err := replaceFile(path, content); err != nil {
+			return false, err
+		}
+		changed = true
+	}
+	attrsChanged, err := attrs.apply(path)
+	return changed || attrsChanged, err
+}
+
+// Module file : répertoire, fichier, lien symbolique ou suppression
+type FileModule struct {
+	Path      string `yaml:"path"`
+	State     string `yaml:"state"` // file (défaut), directory, touch, link, absent
+	Src       string `yaml:"src"`   // Cible du lien (state: link)
+	fileAttrs `yaml:",inline"`
+}
+
+func (m *FileModule) run(rc *runContext) (bool, error) {
+	if m.Path == "" {
+		return false, fmt.Errorf("path obligatoire")
+	}
+	path := rc.path(m.Path)
+	_, statErr := os.Lstat(path)
+	exists := statErr == nil
+
+	switch m.State {
+	case "", "file":
+		if !exists {
+			return false, fmt.Errorf("%s n'existe pas (state: touch pour le créer)", path)
+		}
+		return m.apply(path)
+	case "directory":
+		changed := false
+		if !exists {
+			if err := os.MkdirAll(path, 0755); err != nil {
+				return false, err
+			}
+			changed = true
+		}
+		attrsChanged, err := m.apply(path)
+		return changed || attrsChanged, err
+	case "touch":
+		changed := false
+		if !exists {
+			f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, 0644)
+			if err != nil {
+				return false, err
+			}
+			f.Close()
+			changed = true
+		}
+		attrsChanged, err := m.apply(path)
+		return changed || attrsChanged, err
+	case "link":
+		if m.Src == "" {
+			return false, fmt.Errorf("src obligatoire pour un lien")
+		}
+		if target, err := os.Readlink(path); err == nil && target == m.Src {
+			return false, nil
+		}
+		if exists {
+			if err := os.Remove(path); err != nil {
+				return false, err
+			}
+		}
+		return true, os.Symlink(m.Src, path)
+	case "absent":
+		if !exists {
+			return false, nil
+		}
+		return true, os.RemoveAll(path)
+	}
+	return false, fmt.Errorf("state inconnu %q", m.State)
+}
+
+func (m *FileModule) apply(path string) (bool, error) {
+	return m.fileAttrs.apply(path)
+}
+
+// Module copy : fichier du dépôt ou contenu littéral copié vers dest
+type CopyModule struct {
+	Src       string `yaml:"src"`     // Relatif au répertoire cloné
+	Content   string `yaml:"content"` // Contenu littéral, à la place de src
+	Dest      string `yaml:"dest"`
+	fileAttrs `yaml:",inline"`
+}
+
+func (m *CopyModule) run(rc *runContext) (bool, error) {
+	if m.Dest == "" {
+		return false, fmt.Errorf("dest obligatoire")
+	}
+	content := []byte(m.Content)
+	if m.Src != "" {
+		data, err := ioutil.ReadFile(rc.path(m.Src))
+		if err != nil {
+			return false, err
+		}
+		content = data
+	}
+	return writeFile(rc.path(m.Dest), content, m.fileAttrs)
+}
+
+// Module template : fichier text/template du dépôt rendu vers dest
+type TemplateModule struct {
+	Src       string `yaml:"src"`
+	Dest      string `yaml:"dest"`
+	fileAttrs `yaml:",inline"`
+}
+
+func (m *TemplateModule) run(rc *runContext) (bool, error) {
+	if m.Src == "" || m.Dest == "" {
+		return false, fmt.Errorf("src et dest obligatoires")
+	}
+	tmpl, err := template.New(filepath.Base(m.Src)).Option("missingkey=error").ParseFiles(rc.path(m.Src))
+	if err != nil {
+		return false, err
+	}
+	var rendered bytes.Buffer
+	if err := tmpl.Execute(&rendered, rc.data); err != nil {
+		return false, err
+	}
+	return writeFile(rc.path(m.Dest), rendered.Bytes(), m.fileAttrs)
+}
+
+// Module lineinfile : garantir la présence ou l'absence d'une ligne dans un fichier
+type LineInFileModule struct {
+	Path   string `yaml:"path"`
+	Line   string `yaml:"line"`
+	Regexp string `yaml:"regexp"` // Ligne à remplacer (present) ou à supprimer (absent)
+	State  string `yaml:"state"`  // present (défaut) ou absent
+	Create bool   `yaml:"create"` // Créer le fichier s'il n'existe pas
+}
+
+func (m *LineInFileModule) run(rc *runContext) (bool, error) {
+	if m.Path == "" {
+		return false, fmt.Errorf("path obligatoire")
+	}
+	// Sans regexp ni line, absent supprimerait les lignes vides
+	if m.State == "absent" && m.Regexp == "" && m.Line == "" {
+		return false, fmt.Errorf("regexp ou line obligatoire avec state: absent")
+	}
+	path := rc.path(m.Path)
+	var re *regexp.Regexp
+	if m.Regexp != "" {
+		var err error
+		if re, err = regexp.Compile(m.Regexp); err != nil {
+			return false, err
+		}
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		if m.State == "absent" {
+			return false, nil
+		}
+		if !m.Create {
+			return false, fmt.Errorf("%s n'existe pas (create: true pour le créer)", path)
+		}
+	} else if err != nil {
+		return false, err
+	}
+
+	text := string(data)
+	trailingNewline := text == "" || strings.HasSuffix(text, "\n")
+	var lines []string
+	if text != "" {
+		lines = strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	}
+	matches := func(l string) bool {
+		if re != nil {
+			return re.MatchString(l)
+		}
+		return l == m.Line
+	}
+
+	switch m.State {
+	case "absent":
+		kept := lines[:0]
+		for _, l := range lines {
+			if !matches(l) {
+				kept = append(kept, l)
+			}
+		}
+		if len(kept) == len(lines) {
+			return false, nil
+		}
+		lines = kept
+	case "", "present":
+		// La dernière ligne correspondant à regexp est remplacée, sinon la ligne est ajoutée
+		index := -1
+		for i, l := range lines {
+			if matches(l) {
+				index = i
+			}
+		}
+		switch {
+		case index >= 0 && lines[index] == m.Line:
+			return false, nil
+		case index >= 0:
+			lines[index] = m.Line
+		default:
+			for _, l := range lines {
+				if l == m.Line {
+					return false, nil
+				}
+			}
+			lines = append(lines, m.Line)
+		}
+	default:
+		return false, fmt.Errorf("state inconnu %q", m.State)
+	}
+
+	out := strings.Join(lines, "\n")
+	if len(lines) > 0 && trailingNewline {
+		out += "\n"
+	}
+	return true, replaceFile(path, []byte(out))
+}
@@ -0,0 +1,222 @@
+package tasks
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func testContext(t *testing.T) *runContext {
+	t.Helper()
+	return &runContext{ctx: context.Background(), baseDir: t.TempDir(), output: ioutil.Discard, data: TemplateData{
+		Vars: map[string]string{"port": "8080"},
+		Env:  map[string]string{},
+	}}
+}
+
+// Exécuter deux fois un module : la première exécution change le système, la seconde non
+func assertIdempotent(t *testing.T, rc *runContext, m module) {
+	t.Helper()
+	changed, err := m.run(rc)
+	if err != nil {
+		t.Fatalf("première exécution : %v", err)
+	}
+	if !changed {
+		t.Error("première exécution : changed=false, attendu true")
+	}
+	changed, err = m.run(rc)
+	if err != nil {
+		t.Fatalf("seconde exécution : %v", err)
+	}
+	if changed {
+		t.Error("seconde exécution : changed=true, attendu false")
+	}
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFileModuleIdempotent(t *testing.T) {
+	rc := testContext(t)
+	writeTestFile(t, rc.path("existant"), "")
+
+	tests := []struct {
+		name string
+		m    *FileModule
+	}{
+		{"directory", &FileModule{Path: "conf.d", State: "directory", fileAttrs: fileAttrs{Mode: "0750"}}},
+		{"touch", &FileModule{Path: "conf.d/vide", State: "touch", fileAttrs: fileAttrs{Mode: "0600"}}},
+		{"file mode", &FileModule{Path: "existant", fileAttrs: fileAttrs{Mode: "0640"}}},
+		{"link", &FileModule{Path: "lien", State: "link", Src: "existant"}},
+		{"mode via un lien", &FileModule{Path: "lien", fileAttrs: fileAttrs{Mode: "0600"}}},
+		{"absent", &FileModule{Path: "conf.d", State: "absent"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertIdempotent(t, rc, tt.m)
+		})
+	}
+
+	info, err := os.Stat(rc.path("existant"))
+	if err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("mode de existant : %v, %v", info.Mode().Perm(), err)
+	}
+	if target, err := os.Readlink(rc.path("lien")); err != nil || target != "existant" {
+		t.Errorf("lien : %q, %v", target, err)
+	}
+	if _, err := os.Stat(rc.path("conf.d")); !os.IsNotExist(err) {
+		t.Errorf("conf.d existe encore : %v", err)
+	}
+}
+
+func TestCopyModuleIdempotent(t *testing.T) {
+	rc := testContext(t)
+	writeTestFile(t, rc.path("source.conf"), "port=8080\n")
+
+	t.Run("content", func(t *testing.T) {
+		assertIdempotent(t, rc, &CopyModule{Content: "debug=false\n", Dest: "app.conf", fileAttrs: fileAttrs{Mode: "0600"}})
+		if got := readFile(t, rc.path("app.conf")); got != "debug=false\n" {
+			t.Errorf("contenu : %q", got)
+		}
+	})
+	t.Run("src", func(t *testing.T) {
+		assertIdempotent(t, rc, &CopyModule{Src: "source.conf", Dest: "copie.conf"})
+		if got := readFile(t, rc.path("copie.conf")); got != "port=8080\n" {
+			t.Errorf("contenu : %q", got)
+		}
+	})
+	t.Run("contenu modifié", func(t *testing.T) {
+		assertIdempotent(t, rc, &CopyModule{Content: "debug=true\n", Dest: "app.conf"})
+	})
+}
+
+func TestTemplateModuleIdempotent(t *testing.T) {
+	rc := testContext(t)
+	writeTestFile(t, rc.path("app.conf.tmpl"), "listen={{ .Vars.port }}\n")
+
+	assertIdempotent(t, rc, &TemplateModule{Src: "app.conf.tmpl", Dest: "app.conf"})
+	if got := readFile(t, rc.path("app.conf")); got != "listen=8080\n" {
+		t.Errorf("contenu : %q", got)
+	}
+
+	rc.data.Vars["port"] = "9090"
+	assertIdempotent(t, rc, &TemplateModule{Src: "app.conf.tmpl", Dest: "app.conf"})
+	if got := readFile(t, rc.path("app.conf")); got != "listen=9090\n" {
+		t.Errorf("contenu après changement de variable : %q", got)
+	}
+}
+
+func TestLineInFileModuleIdempotent(t *testing.T) {
+	tests := []struct {
+		name    string
+		initial string
+		m       *LineInFileModule
+		want    string
+	}{
+		{"ajout", "a=1\n", &LineInFileModule{Line: "debug=false"}, "a=1\ndebug=false\n"},
+		{"remplacement par regexp", "debug=true\na=1\n", &LineInFileModule{Regexp: "^debug=", Line: "debug=false"}, "debug=false\na=1\n"},
+		{"suppression d'une ligne", "a=1\ndebug=true\n\nb=2\n", &LineInFileModule{Line: "debug=true", State: "absent"}, "a=1\n\nb=2\n"},
+		{"suppression par regexp", "debug=1\na=1\ndebug=2\n", &LineInFileModule{Regexp: "^debug=", State: "absent"}, "a=1\n"},
+		{"sans saut de ligne final", "a=1", &LineInFileModule{Line: "b=2"}, "a=1\nb=2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rc := testContext(t)
+			tt.m.Path = "app.conf"
+			writeTestFile(t, rc.path("app.conf"), tt.initial)
+			assertIdempotent(t, rc, tt.m)
+			if got := readFile(t, rc.path("app.conf")); got != tt.want {
+				t.Errorf("contenu : %q, attendu %q", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("create", func(t *testing.T) {
+		rc := testContext(t)
+		assertIdempotent(t, rc, &LineInFileModule{Path: "nouveau.conf", Line: "a=1", Create: true})
+		if got := readFile(t, rc.path("nouveau.conf")); got != "a=1\n" {
+			t.Errorf("contenu : %q", got)
+		}
+	})
+}
+
+// state: absent sans regexp ni line est refusé au lieu de supprimer les lignes vides
+func TestLineInFileAbsentRequiresLineOrRegexp(t *testing.T) {
+	rc := testContext(t)
+	writeTestFile(t, rc.path("app.conf"), "a=1\n\nb=2\n")
+	if _, err := (&LineInFileModule{Path: "app.conf", State: "absent"}).run(rc); err == nil {
+		t.Error("state: absent sans regexp ni line accepté")
+	}
+	if got := readFile(t, rc.path("app.conf")); got != "a=1\n\nb=2\n" {
+		t.Errorf("fichier modifié : %q", got)
+	}
+}
+
+// Le fichier est remplacé par renommage et garde ses permissions ; un lien symbolique est conservé
+func TestReplaceFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.conf")
+	if err := ioutil.WriteFile(path, []byte("ancien\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	before, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("app.conf", filepath.Join(dir, "lien.conf")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := replaceFile(filepath.Join(dir, "lien.conf"), []byte("nouveau\n")); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, path); got != "nouveau\n" {
+		t.Errorf("contenu : %q", got)
+	}
+	after, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.Mode().Perm() != 0600 {
+		t.Errorf("permissions : %v, attendu 0600", after.Mode().Perm())
+	}
+	if before.Sys().(*syscall.Stat_t).Ino == after.Sys().(*syscall.Stat_t).Ino {
+		t.Error("le fichier a été réécrit sur place au lieu d'être remplacé")
+	}
+	if target, err := os.Readlink(filepath.Join(dir, "lien.conf")); err != nil || target != "app.conf" {
+		t.Errorf("lien remplacé : %q, %v", target, err)
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("fichiers temporaires restants : %d fichiers dans %s", len(entries), dir)
+	}
+
+	// Nouveau fichier : 0644
+	created := filepath.Join(dir, "nouveau.conf")
+	if err := replaceFile(created, []byte("a=1\n")); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(created); err != nil || info.Mode().Perm() != 0644 {
+		t.Errorf("nouveau fichier : %v, %v", info.Mode().Perm(), err)
+	}
+}
@@ -0,0 +1,283 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/yaml.v2"
+
+	"aidalinfo/ansible-lite/internal/facts"
+)
+
+// Statuts d'une tâche
+const (
+	StatusOk      = "ok"
+	StatusChanged = "changed"
+	StatusFailed  = "failed"
+)
+
+// Fichier tasks.yaml : variables, tâches et handlers
+type File struct {
+	Vars     map[string]string `yaml:"vars"`
+	Tasks    []Task            `yaml:"tasks"`
+	Handlers []Task            `yaml:"handlers"`
+}
+
+// Tâche : un nom, exactement un module et les handlers à notifier si elle change quelque chose
+type Task struct {
+	Name       string            `yaml:"name"`
+	File       *FileModule       `yaml:"file"`
+	Copy       *CopyModule       `yaml:"copy"`
+	Template   *TemplateModule   `yaml:"template"`
+	LineInFile *LineInFileModule `yaml:"lineinfile"`
+	Command    *CommandModule    `yaml:"command"`
+	Service    *ServiceModule    `yaml:"service"`
+	Notify     stringList        `yaml:"notify"`
+}
+
+// Liste acceptant aussi une valeur unique (notify: restart app)
+type stringList []string
+
+func (l *stringList) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var single string
+	if err := unmarshal(&single); err == nil {
+		*l = stringList{single}
+		return nil
+	}
+	var list []string
+	if err := unmarshal(&list); err != nil {
+		return err
+	}
+	*l = list
+	return nil
+}
+
+// Module idempotent : indique s'il a modifié le système
+type module interface {
+	run(rc *runContext) (changed bool, err error)
+}
+
+// Module de la tâche et son nom
+func (t Task) module() (string, module, error) {
+	var name string
+	var m module
+	count := 0
+	add := func(n string, candidate module, set bool) {
+		if set {
+			name, m = n, candidate
+			count++
+		}
+	}
+	add("file", t.File, t.File != nil)
+	add("copy", t.Copy, t.Copy != nil)
+	add("template", t.Template, t.Template != nil)
+	add("lineinfile", t.LineInFile, t.LineInFile != nil)
+	add("command", t.Command, t.Command != nil)
+	add("service", t.Service, t.Service != nil)
+
+	switch count {
+	case 0:
+		return "", nil, fmt.Errorf("tâche %q : aucun module (file, copy, template, lineinfile, command, service)", t.Name)
+	case 1:
+		return name, m, nil
+	}
+	return "", nil, fmt.Errorf("tâche %q : un seul module par tâche", t.Name)
+}
+
+// Données disponibles dans les templates : {{ .Vars.nom }}, {{ .Env.NOM }}, {{ .Facts.Hostname }}
+type TemplateData struct {
+	Vars  map[string]string
+	Env   map[string]string
+	Facts *facts.Facts
+}
+
+// Paramètres d'exécution d'un fichier de tâches
+type Options struct {
+	BaseDir   string            // Répertoire de référence des chemins relatifs (répertoire cloné)
+	Vars      map[string]string // Variables de la tâche, prioritaires sur celles de tasks.yaml
+	Env       []string          // Environnement des commandes, exposé aussi aux templates
+	Facts     *facts.Facts      // Faits de la machine exposés aux templates
+	Output    io.Writer         // Journal d'exécution
+	KillGrace time.Duration     // Délai entre SIGTERM et SIGKILL pour arrêter une commande (timeout, annulation)
+}
+
+// Résultat d'une tâche ou d'un handler
+type Result struct {
+	Name    string
+	Module  string
+	Handler bool
+	Status  string // ok, changed, failed
+	Message string
+}
+
+// Résultat de l'exécution d'un fichier de tâches
+type Report struct {
+	Results []Result
+	Ok      int
+	Changed int
+	Failed  int
+}
+
+// Contexte partagé par les modules pendant une exécution
+type runContext struct {
+	ctx     context.Context
+	baseDir string
+	env     []string
+	data    TemplateData
+	output  io.Writer
+	grace   time.Duration
+}
+
+// Résoudre un chemin relatif par rapport au répertoire de référence
+func (rc *runContext) path(p string) string {
+	if p == "" || filepath.IsAbs(p) {
+		return p
+	}
+	return filepath.Join(rc.baseDir, p)
+}
+
+// Lire et vérifier un fichier de tâches (clés inconnues refusées)
+func Load(path string) (*File, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f File
+	if err := yaml.UnmarshalStrict(data, &f); err != nil {
+		return nil, fmt.Errorf("%s : %v", path, err)
+	}
+
+	handlers := make(map[string]bool)
+	for _, h := range f.Handlers {
+		if _, _, err := h.module(); err != nil {
+			return nil, fmt.Errorf("%s : handler %v", path, err)
+		}
+		handlers[h.Name] = true
+	}
+	for _, t := range f.Tasks {
+		if _, _, err := t.module(); err != nil {
+			return nil, fmt.Errorf("%s : %v", path, err)
+		}
+		for _, n := range t.Notify {
+			if !handlers[n] {
+				return nil, fmt.Errorf("%s : tâche %q : handler inconnu %q", path, t.Name, n)
+			}
+		}
+	}
+	return &f, nil
+}
+
+// Exécuter un fichier de tâches : les tâches dans l'ordre, arrêt à la première en échec,
+// puis les handlers notifiés par une tâche ayant changé quelque chose, une seule fois chacun
+func Run(ctx context.Context, path string, opts Options) (*Report, error) {
+	f, err := Load(path)
+	if err != nil {
+		return nil, err
+	}
+
+	output := opts.Output
+	if output == nil {
+		output = ioutil.Discard
+	}
+	rc := &runContext{ctx: ctx, baseDir: opts.BaseDir, env: opts.Env, output: output, grace: opts.KillGrace, data: TemplateData{
+		Vars:  make(map[string]string),
+		Env:   make(map[string]string),
+		Facts: opts.Facts,
+	}}
+	for key, value := range f.Vars {
+		rc.data.Vars[key] = value
+	}
+	for key, value := range opts.Vars {
+		rc.data.Vars[key] = value
+	}
+	for _, kv := range opts.Env {
+		for i := 0; i < len(kv); i++ {
+			if kv[i] == '=' {
+				rc.data.Env[kv[:i]] = kv[i+1:]
+				break
+			}
+		}
+	}
+
+	report := &Report{}
+	notified := make(map[string]bool)
+	for _, t := range f.Tasks {
+		result := runTask(rc, t, false)
+		report.add(result)
+		if result.Status == StatusFailed {
+			report.print(output)
+			return report, fmt.Errorf("tâche %q en échec : %s", result.Name, result.Message)
+		}
+		if result.Status == StatusChanged {
+			for _, n := range t.Notify {
+				notified[n] = true
+			}
+		}
+	}
+
+	for _, h := range f.Handlers {
+		if !notified[h.Name] {
+			continue
+		}
+		result := runTask(rc, h, true)
+		report.add(result)
+		if result.Status == StatusFailed {
+			report.print(output)
+			return report, fmt.Errorf("handler %q en échec : %s", result.Name, result.Message)
+		}
+	}
+
+	report.print(output)
+	return report, nil
+}
+
+// Exécuter une tâche et journaliser son résultat
+func runTask(rc *runContext, t Task, handler bool) Result {
+	name, m, _ := t.module()
+	result := Result{Name: t.Name, Module: name, Handler: handler, Status: StatusOk}
+	if result.Name == "" {
+		result.Name = name
+	}
+
+	label := "TASK"
+	if handler {
+		label = "HANDLER"
+	}
+	fmt.Fprintf(rc.output, "%s [%s]\n", label, result.Name)
+
+	if err := rc.ctx.Err(); err != nil {
+		result.Status, result.Message = StatusFailed, err.Error()
+	} else if changed, err := m.run(rc); err != nil {
+		result.Status, result.Message = StatusFailed, err.Error()
+	} else if changed {
+		result.Status = StatusChanged
+	}
+
+	if result.Message != "" {
+		fmt.Fprintf(rc.output, "%s : %s\n", result.Status, result.Message)
+	} else {
+		fmt.Fprintf(rc.output, "%s\n", result.Status)
+	}
+	return result
+}
+
+// Ligne de récapitulatif en fin de journal
+func (r *Report) print(output io.Writer) {
+	fmt.Fprintf(output, "RECAP : ok=%d changed=%d failed=%d\n", r.Ok, r.Changed, r.Failed)
+}
+
+func (r *Report) add(result Result) {
+	r.Results = append(r.Results, result)
+	switch result.Status {
+	case StatusOk:
+		r.Ok++
+	case StatusChanged:
+		r.Changed++
+	case StatusFailed:
+		r.Failed++
+	}
+}
@@ -0,0 +1,25 @@
+// Package testutil regroupe les fixtures partagées par les tests des autres packages
+package testutil
+
+import (
+	"path/filepath"
+	"testing"
+
+	"aidalinfo/ansible-lite/internal/config"
+	"aidalinfo/ansible-lite/internal/db"
+)
+
+// Token administrateur (credentials) de la configuration de test
+const Credentials = "token-administrateur"
+
+// Configuration minimale avec une base SQLite initialisée dans un répertoire temporaire
+func Config(t *testing.T) *config.GlobalConfig {
+	t.Helper()
+	cfg := &config.GlobalConfig{}
+	cfg.Global.Credentials = Credentials
+	cfg.Global.DBPath = filepath.Join(t.TempDir(), "db.sqlite3")
+	if err := db.InitDB(cfg.Global.DBPath); err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
@@ -0,0 +1,220 @@
+package token
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"aidalinfo/ansible-lite/internal/config"
+	"aidalinfo/ansible-lite/internal/db"
+	"aidalinfo/ansible-lite/internal/logger"
+)
+
+// Droits d'un token de l'API, chacun comprenant les précédents :
+// read consulte, trigger lance des exécutions, admin recharge la configuration, change l'état des
+// tâches et gère les tokens, les agents et le niveau de log
+const (
+	ScopeRead    = "read"
+	ScopeTrigger = "trigger"
+	ScopeAdmin   = "admin"
+)
+
+var scopeRanks = map[string]int{ScopeRead: 1, ScopeTrigger: 2, ScopeAdmin: 3}
+
+// Nom du token credentials de config.yaml, administrateur sans expiration
+const BootstrapName = "credentials"
+
+// Intervalle minimal entre deux mises à jour de la date de dernière utilisation d'un token
+const touchInterval = time.Minute
+
+var (
+	ErrInvalid = errors.New("token invalide ou manquant")
+	ErrExpired = errors.New("token expiré")
+	ErrUnknown = errors.New("token inconnu")
+)
+
+// Noms acceptés pour les tokens : lettres, chiffres, ., _ et -
+var validName = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// Identité authentifiée par un token
+type Identity struct {
+	Name   string
+	Scopes []string
+}
+
+// Indiquer si les droits permettent une action du niveau demandé
+func (id *Identity) Allows(scope string) bool {
+	for _, s := range id.Scopes {
+		if scopeRanks[s] >= scopeRanks[scope] {
+			return true
+		}
+	}
+	return false
+}
+
+// Vérifier une liste de droits séparés par des virgules (read,trigger...)
+func ParseScopes(value string) ([]string, error) {
+	var scopes []string
+	for _, s := range strings.Split(value, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		if _, ok := scopeRanks[s]; !ok {
+			return nil, fmt.Errorf("droit inconnu : %s (read, trigger ou admin)", s)
+		}
+		scopes = append(scopes, s)
+	}
+	if len(scopes) == 0 {
+		return nil, fmt.Errorf("au moins un droit est obligatoire (read, trigger ou admin)")
+	}
+	return scopes, nil
+}
+
+// Durée de validité : durée Go (720h) ou nombre de jours (90d) ; vide ou 0 : sans expiration
+func ParseTTL(value string) (time.Duration, error) {
+	if value == "" || value == "0" {
+		return 0, nil
+	}
+	if days := strings.TrimSuffix(value, "d"); days != value {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("durée de validité invalide %q (exemples : 90d, 720h)", value)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("durée de validité invalide %q (exemples : 90d, 720h)", value)
+	}
+	return d, nil
+}
+
+func expiry(now time.Time, ttl time.Duration) string {
+	if ttl <= 0 {
+		return ""
+	}
+	return now.Add(ttl).Format(time.RFC3339)
+}
+
+// Créer un token nommé ; le token en clair n'est renvoyé qu'à sa création
+func Create(cfg *config.GlobalConfig, name string, scopes []string, ttl time.Duration) (string, *db.APIToken, error) {
+	if !validName.MatchString(name) || name == BootstrapName {
+		return "", nil, fmt.Errorf("nom de token invalide %q (lettres, chiffres, ., _ et -, hors %s)", name, BootstrapName)
+	}
+	existing, err := db.GetAPIToken(cfg.Global.DBPath, name)
+	if err != nil {
+		return "", nil, err
+	}
+	if existing != nil {
+		return "", nil, fmt.Errorf("le token %s existe déjà (rotate pour le renouveler)", name)
+	}
+
+	secret, err := GenerateToken(32)
+	if err != nil {
+		return "", nil, err
+	}
+	now := time.Now()
+	t := &db.APIToken{
+		Name:      name,
+		TokenHash: Hash(secret),
+		Scopes:    scopes,
+		CreatedAt: now.Format(time.RFC3339),
+		ExpiresAt: expiry(now, ttl),
+	}
+	if err := db.CreateAPIToken(cfg.Global.DBPath, t); err != nil {
+		return "", nil, err
+	}
+	logger.AddSecrets(secret)
+	logger.Log("INFO", "Token %s créé (%s)", name, strings.Join(scopes, ","))
+	return secret, t, nil
+}
+
+// Remplacer le token en clair d'un token nommé, qui garde ses droits ; sans durée, la validité
+// initiale est reprise à partir de maintenant. L'ancien token cesse immédiatement de fonctionner
+func Rotate(cfg *config.GlobalConfig, name string, ttl time.Duration) (string, *db.APIToken, error) {
+	t, err := db.GetAPIToken(cfg.Global.DBPath, name)
+	if err != nil {
+		return "", nil, err
+	}
+	if t == nil {
+		return "", nil, ErrUnknown
+	}
+	if ttl == 0 && t.ExpiresAt != "" {
+		created, errCreated := time.Parse(time.RFC3339, t.CreatedAt)
+		expires, errExpires := time.Parse(time.RFC3339, t.ExpiresAt)
+		if errCreated == nil && errExpires == nil {
+			ttl = expires.Sub(created)
+		}
+	}
+
+	secret, err := GenerateToken(32)
+	if err != nil {
+		return "", nil, err
+	}
+	now := time.Now()
+	t.TokenHash, t.CreatedAt, t.ExpiresAt, t.LastUsedAt = Hash(secret), now.Format(time.RFC3339), expiry(now, ttl), ""
+	found, err := db.RotateAPIToken(cfg.Global.DBPath, name, t.TokenHash, t.CreatedAt, t.ExpiresAt)
+	if err != nil {
+		return "", nil, err
+	}
+	if !found {
+		return "", nil, ErrUnknown
+	}
+	logger.AddSecrets(secret)
+	logger.Log("INFO", "Token %s renouvelé", name)
+	return secret, t, nil
+}
+
+// Révoquer un token nommé
+func Revoke(cfg *config.GlobalConfig, name string) error {
+	found, err := db.DeleteAPIToken(cfg.Global.DBPath, name)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return ErrUnknown
+	}
+	logger.Log("INFO", "Token %s révoqué", name)
+	return nil
+}
+
+// Authentifier le token d'un en-tête Authorization : credentials de config.yaml (administrateur),
+// puis tokens nommés, retrouvés par leur empreinte
+func Authenticate(cfg *config.GlobalConfig, header string) (*Identity, error) {
+	secret := FromHeader(header)
+	if secret == "" {
+		return nil, ErrInvalid
+	}
+
+	// Comparaison en temps constant, sur les empreintes pour ne pas dépendre de la longueur
+	if cfg.Global.Credentials != "" {
+		presented, expected := sha256.Sum256([]byte(secret)), sha256.Sum256([]byte(cfg.Global.Credentials))
+		if subtle.ConstantTimeCompare(presented[:], expected[:]) == 1 {
+			return &Identity{Name: BootstrapName, Scopes: []string{ScopeAdmin}}, nil
+		}
+	}
+
+	t, err := db.GetAPITokenByHash(cfg.Global.DBPath, Hash(secret))
+	if err != nil {
+		return nil, err
+	}
+	if t == nil {
+		return nil, ErrInvalid
+	}
+	now := time.Now()
+	if t.ExpiresAt != "" {
+		if expires, err := time.Parse(time.RFC3339, t.ExpiresAt); err == nil && now.After(expires) {
+			return nil, ErrExpired
+		}
+	}
+	if last, err := time.Parse(time.RFC3339, t.LastUsedAt); err != nil || now.Sub(last) >= touchInterval {
+		db.TouchAPIToken(cfg.Global.DBPath, t.Name, now.Format(time.RFC3339))
+	}
+	return &Identity{Name: t.Name, Scopes: t.Scopes}, nil
+}
@@ -0,0 +1,223 @@
+package token
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"aidalinfo/ansible-lite/internal/db"
+	"aidalinfo/ansible-lite/internal/testutil"
+)
+
+func TestHash(t *testing.T) {
+	// SHA-256 de "abc"
+	if got := Hash("abc"); got != "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad" {
+		t.Errorf("Hash(abc) = %s", got)
+	}
+	if Hash("abc") == Hash("abd") {
+		t.Error("deux tokens différents ont la même empreinte")
+	}
+}
+
+func TestFromHeader(t *testing.T) {
+	tests := map[string]string{
+		"":                "",
+		"secret":          "secret",
+		"Bearer secret":   "secret",
+		"bearer  secret":  "secret",
+		" Bearer secret ": "secret",
+		"Bearer ":         "Bearer",
+	}
+	for header, want := range tests {
+		if got := FromHeader(header); got != want {
+			t.Errorf("FromHeader(%q) = %q, attendu %q", header, got, want)
+		}
+	}
+}
+
+func TestAllows(t *testing.T) {
+	tests := []struct {
+		scopes []string
+		scope  string
+		want   bool
+	}{
+		{[]string{ScopeRead}, ScopeRead, true},
+		{[]string{ScopeRead}, ScopeTrigger, false},
+		{[]string{ScopeRead}, ScopeAdmin, false},
+		{[]string{ScopeTrigger}, ScopeRead, true},
+		{[]string{ScopeTrigger}, ScopeTrigger, true},
+		{[]string{ScopeTrigger}, ScopeAdmin, false},
+		{[]string{ScopeAdmin}, ScopeRead, true},
+		{[]string{ScopeAdmin}, ScopeAdmin, true},
+		{[]string{ScopeRead, ScopeTrigger}, ScopeTrigger, true},
+		{nil, ScopeRead, false},
+		{[]string{"inconnu"}, ScopeRead, false},
+	}
+	for _, tt := range tests {
+		id := &Identity{Scopes: tt.scopes}
+		if got := id.Allows(tt.scope); got != tt.want {
+			t.Errorf("%v autorise %s = %v, attendu %v", tt.scopes, tt.scope, got, tt.want)
+		}
+	}
+}
+
+func TestParseScopes(t *testing.T) {
+	scopes, err := ParseScopes(" read, trigger ,")
+	if err != nil || strings.Join(scopes, ",") != "read,trigger" {
+		t.Errorf("ParseScopes = %v, %v", scopes, err)
+	}
+	for _, value := range []string{"", " , ", "read,root"} {
+		if _, err := ParseScopes(value); err == nil {
+			t.Errorf("ParseScopes(%q) accepté", value)
+		}
+	}
+}
+
+func TestParseTTL(t *testing.T) {
+	tests := map[string]time.Duration{
+		"":     0,
+		"0":    0,
+		"90d":  90 * 24 * time.Hour,
+		"720h": 720 * time.Hour,
+		"30m":  30 * time.Minute,
+	}
+	for value, want := range tests {
+		if got, err := ParseTTL(value); err != nil || got != want {
+			t.Errorf("ParseTTL(%q) = %v, %v, attendu %v", value, got, err, want)
+		}
+	}
+	for _, value := range []string{"d", "-1d", "-5h", "trois jours"} {
+		if _, err := ParseTTL(value); err == nil {
+			t.Errorf("ParseTTL(%q) accepté", value)
+		}
+	}
+}
+
+func TestCreateStoresOnlyHash(t *testing.T) {
+	cfg := testutil.Config(t)
+	secret, created, err := Create(cfg, "ci", []string{ScopeRead, ScopeTrigger}, 24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored, err := db.GetAPIToken(cfg.Global.DBPath, "ci")
+	if err != nil || stored == nil {
+		t.Fatalf("token ci introuvable : %v", err)
+	}
+	if stored.TokenHash != Hash(secret) || stored.TokenHash == secret || created.TokenHash != stored.TokenHash {
+		t.Error("la base doit contenir l'empreinte du token et non le token en clair")
+	}
+	if stored.ExpiresAt == "" {
+		t.Error("expiration absente")
+	}
+
+	if _, _, err := Create(cfg, "ci", []string{ScopeRead}, 0); err == nil {
+		t.Error("un second token ci a été créé")
+	}
+	for _, name := range []string{"", BootstrapName, "avec espace", "a/b"} {
+		if _, _, err := Create(cfg, name, []string{ScopeRead}, 0); err == nil {
+			t.Errorf("nom de token %q accepté", name)
+		}
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	cfg := testutil.Config(t)
+	secret, _, err := Create(cfg, "lecture", []string{ScopeRead}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := Authenticate(cfg, "Bearer "+secret)
+	if err != nil || id.Name != "lecture" || !id.Allows(ScopeRead) || id.Allows(ScopeTrigger) {
+		t.Errorf("token nommé : %+v, %v", id, err)
+	}
+	if stored, _ := db.GetAPIToken(cfg.Global.DBPath, "lecture"); stored == nil || stored.LastUsedAt == "" {
+		t.Error("date de dernière utilisation non enregistrée")
+	}
+
+	id, err = Authenticate(cfg, cfg.Global.Credentials)
+	if err != nil || id.Name != BootstrapName || !id.Allows(ScopeAdmin) {
+		t.Errorf("credentials : %+v, %v", id, err)
+	}
+
+	for _, header := range []string{"", "Bearer ", "Bearer inconnu", Hash(secret), cfg.Global.Credentials + "x"} {
+		if _, err := Authenticate(cfg, header); err != ErrInvalid {
+			t.Errorf("Authenticate(%q) : %v, attendu ErrInvalid", header, err)
+		}
+	}
+
+	// Sans credentials dans config.yaml, un token vide ne doit pas correspondre
+	cfg.Global.Credentials = ""
+	if _, err := Authenticate(cfg, ""); err != ErrInvalid {
+		t.Errorf("token vide sans credentials : %v, attendu ErrInvalid", err)
+	}
+}
+
+func TestAuthenticateExpired(t *testing.T) {
+	cfg := testutil.Config(t)
+	past := time.Now().Add(-time.Hour)
+	err := db.CreateAPIToken(cfg.Global.DBPath, &db.APIToken{
+		Name:      "expire",
+		TokenHash: Hash("secret-expire"),
+		Scopes:    []string{ScopeAdmin},
+		CreatedAt: past.Add(-time.Hour).Format(time.RFC3339),
+		ExpiresAt: past.Format(time.RFC3339),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Authenticate(cfg, "secret-expire"); err != ErrExpired {
+		t.Errorf("token expiré : %v, attendu ErrExpired", err)
+	}
+}
+
+func TestRevoke(t *testing.T) {
+	cfg := testutil.Config(t)
+	secret, _, err := Create(cfg, "ci", []string{ScopeTrigger}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Revoke(cfg, "ci"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Authenticate(cfg, secret); err != ErrInvalid {
+		t.Errorf("token révoqué : %v, attendu ErrInvalid", err)
+	}
+	if err := Revoke(cfg, "ci"); err != ErrUnknown {
+		t.Errorf("seconde révocation : %v, attendu ErrUnknown", err)
+	}
+}
+
+func TestRotate(t *testing.T) {
+	cfg := testutil.Config(t)
+	old, created, err := Create(cfg, "ci", []string{ScopeRead, ScopeTrigger}, 48*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	renewed, rotated, err := Rotate(cfg, "ci", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if renewed == old {
+		t.Fatal("la rotation a conservé le token en clair")
+	}
+	if _, err := Authenticate(cfg, old); err != ErrInvalid {
+		t.Errorf("ancien token après rotation : %v, attendu ErrInvalid", err)
+	}
+	id, err := Authenticate(cfg, renewed)
+	if err != nil || id.Name != "ci" || strings.Join(id.Scopes, ",") != strings.Join(created.Scopes, ",") {
+		t.Errorf("nouveau token après rotation : %+v, %v", id, err)
+	}
+
+	// Sans durée, la validité initiale (48h) est reprise à partir de la rotation
+	createdAt, _ := time.Parse(time.RFC3339, rotated.CreatedAt)
+	expiresAt, _ := time.Parse(time.RFC3339, rotated.ExpiresAt)
+	if expiresAt.Sub(createdAt) != 48*time.Hour {
+		t.Errorf("validité après rotation : %v, attendu 48h", expiresAt.Sub(createdAt))
+	}
+
+	if _, _, err := Rotate(cfg, "inconnu", 0); err != ErrUnknown {
+		t.Errorf("rotation d'un token inconnu : %v, attendu ErrUnknown", err)
+	}
+}
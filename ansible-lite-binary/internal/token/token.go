@@ -2,8 +2,10 @@ package token
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"log"
+	"strings"
 )
 
 // Générer un token aléatoire de longueur donnée
@@ -15,3 +17,18 @@ func GenerateToken(length int) (string, error) {
 	}
 	return hex.EncodeToString(bytes), nil
 }
+
+// Empreinte d'un token, seule conservée en base
+func Hash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Token d'un en-tête Authorization, présenté seul ou sous la forme "Bearer <token>"
+func FromHeader(header string) string {
+	header = strings.TrimSpace(header)
+	if len(header) > 7 && strings.EqualFold(header[:7], "Bearer ") {
+		return strings.TrimSpace(header[7:])
+	}
+	return header
+}